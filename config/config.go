@@ -16,15 +16,34 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 )
 
 var (
-	MongoURI     = os.Getenv("MONGO_URI")
-	AccessSecret = os.Getenv("ACCESS_SECRET")
-	CORSConfig   = cors.Config{
+	MongoURI              = os.Getenv("MONGO_URI")
+	MongoConnectTimeout   = duration("MONGO_CONNECT_TIMEOUT", 10*time.Second)
+	MongoOperationTimeout = duration("MONGO_OPERATION_TIMEOUT", 5*time.Second)
+	AccessSecret          = os.Getenv("ACCESS_SECRET")
+	AccessTokenTTL        = duration("ACCESS_TOKEN_TTL", 30*time.Minute)
+	RefreshTokenTTL       = duration("REFRESH_TOKEN_TTL", 14*24*time.Hour)
+	MasterPassword        = os.Getenv("MASTER_PASSWORD")
+	PasswordMinLength     = integer("PASSWORD_MIN_LENGTH", 8)
+	PasswordRequireLetter = boolean("PASSWORD_REQUIRE_LETTER", true)
+	PasswordRequireDigit  = boolean("PASSWORD_REQUIRE_DIGIT", true)
+	PasswordRequireSymbol = boolean("PASSWORD_REQUIRE_SYMBOL", false)
+	SMTPAddr              = os.Getenv("SMTP_ADDR")
+	SMTPFrom              = os.Getenv("SMTP_FROM")
+	SMTPUsername          = os.Getenv("SMTP_USERNAME")
+	SMTPPassword          = os.Getenv("SMTP_PASSWORD")
+	ReminderInterval      = duration("REMINDER_INTERVAL", time.Hour)
+	ReminderDays          = text("REMINDER_DAYS", "-3,1,7")
+	ReminderThrottle      = duration("REMINDER_THROTTLE", 24*time.Hour)
+	TrustedProxies        = list("TRUSTED_PROXIES", nil)
+	CORSConfig            = cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"*"},
 		AllowHeaders:     []string{"*"},
@@ -32,3 +51,58 @@ var (
 		MaxAge:           6 * time.Hour,
 	}
 )
+
+// duration returns the duration of the environment variable key (e.g. "5s"),
+// or def if it is not set or malformed.
+func duration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// integer returns the integer of the environment variable key,
+// or def if it is not set or malformed.
+func integer(key string, def int) int {
+	i, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// boolean returns the boolean of the environment variable key (e.g. "true"),
+// or def if it is not set or malformed.
+func boolean(key string, def bool) bool {
+	b, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// list returns the comma-separated values of the environment variable key (e.g. "10.0.0.1,10.1.0.0/16"),
+// or def if it is not set.
+func list(key string, def []string) []string {
+	str, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(str, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// text returns the environment variable key, or def if it is not set.
+func text(key, def string) string {
+	if str, ok := os.LookupEnv(key); ok {
+		return str
+	}
+	return def
+}
@@ -16,17 +16,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/akamensky/argparse"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kmu-kcc/buddy-backend/config"
-	"github.com/kmu-kcc/buddy-backend/web/api/v1/activity"
-	"github.com/kmu-kcc/buddy-backend/web/api/v1/fee"
-	"github.com/kmu-kcc/buddy-backend/web/api/v1/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/mail"
+	"github.com/kmu-kcc/buddy-backend/pkg/reminder"
 )
 
 func main() {
@@ -42,62 +41,41 @@ func main() {
 	// argparse is redundant due to the `flag` package in the standard library.
 	// This would be removed in v1.1.0.
 	port := parser.Int("p", "port", &argparse.Options{Required: true, Help: "Port to run the server"})
+	store := parser.Selector("s", "store", []string{"mongo", "memory"}, &argparse.Options{Default: "mongo", Help: "Storage backend"})
 
 	if err := parser.Parse(os.Args); err != nil {
 		log.Fatalln(parser.Usage(err))
 	}
 
+	closeStore, err := setupStore(*store)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err = startReminder(); err != nil {
+		log.Fatalln(err)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 
-	engine := gin.Default()
+	engine := newRouter()
 
-	engine.Use(cors.New(config.CORSConfig))
+	err = engine.Run(fmt.Sprintf(":%d", *port))
+	closeStore()
+	log.Fatalln(err)
+}
+
+// startReminder starts the payment reminders in the background, if the SMTP server is configured.
+func startReminder() error {
+	if config.SMTPAddr == "" {
+		return nil
+	}
 
-	api := engine.Group("/api")
-	{
-		v1 := api.Group("/v1")
-		{
-			members := v1.Group("/member")
-			{
-				members.POST("/signin", member.SignIn())
-				members.POST("/signup", member.SignUp())
-				members.GET("/signups", member.SignUps())
-				members.PUT("/approve", member.Approve())
-				members.DELETE("/delete", member.Delete())
-				members.PUT("/exit", member.Exit())
-				members.GET("/exits", member.Exits())
-				members.POST("/my", member.My())
-				members.GET("/search", member.Search())
-				members.PUT("/update", member.Update())
-				members.GET("/active", member.Active())
-				members.PUT("/activate", member.Activate())
-				members.GET("/graduates", member.Graduates())
-				members.PUT("/updaterole", member.UpdateRole())
-			}
-			activities := v1.Group("/activity")
-			{
-				activities.POST("/create", activity.Create())
-				activities.GET("/search", activity.Search())
-				activities.GET("/private", activity.Private())
-				activities.PUT("/update", activity.Update())
-				activities.DELETE("/delete", activity.Delete())
-				activities.POST("/upload", activity.Upload())
-				activities.POST("/download", activity.Download())
-				activities.POST("/deletefile", activity.DeleteFile())
-			}
-			fees := v1.Group("/fee")
-			{
-				fees.POST("/create", fee.Create())
-				fees.POST("/amount", fee.Amount())
-				fees.POST("/payers", fee.Payers())
-				fees.POST("/deptors", fee.Deptors())
-				fees.POST("/search", fee.Search())
-				fees.POST("/pay", fee.Pay())
-				fees.POST("/deposit", fee.Deposit())
-				fees.POST("/exempt", fee.Exempt())
-			}
-		}
+	days, err := reminder.ParseDays(config.ReminderDays)
+	if err != nil {
+		return err
 	}
 
-	log.Fatalln(engine.Run(fmt.Sprintf(":%d", *port)))
+	reminder.SetSender(mail.NewSMTPSender(config.SMTPAddr, config.SMTPFrom, config.SMTPUsername, config.SMTPPassword))
+	go reminder.Start(context.Background(), config.ReminderInterval, reminder.Schedule{Days: days, Throttle: config.ReminderThrottle})
+	return nil
 }
@@ -0,0 +1,435 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/config"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+)
+
+// requirement is the authorization requirement of a route.
+type requirement struct {
+	public bool   // anyone
+	role   bool   // the members who have some permission
+	self   string // the member whose ID is the field, unless it is empty
+}
+
+var (
+	ctx = context.Background()
+
+	anyone     = requirement{public: true}
+	authed     = requirement{}
+	privileged = requirement{role: true}
+)
+
+func self(field string) requirement { return requirement{self: field} }
+
+// routes lists every route of the router with its requirement.
+// A new route must be listed here, or TestRoutes fails.
+var routes = map[string]requirement{
+	"POST /api/v1/member/signin":            anyone,
+	"POST /api/v1/member/refresh":           anyone,
+	"PUT /api/v1/member/password":           anyone,
+	"POST /api/v1/member/logout":            authed,
+	"GET /api/v1/member/sessions":           authed,
+	"DELETE /api/v1/member/sessions":        authed,
+	"PUT /api/v1/member/forcelogout":        privileged,
+	"POST /api/v1/member/signup":            anyone,
+	"GET /api/v1/member/signups":            privileged,
+	"PUT /api/v1/member/approve":            privileged,
+	"DELETE /api/v1/member/delete":          privileged,
+	"PUT /api/v1/member/exit":               self("id"),
+	"GET /api/v1/member/exits":              privileged,
+	"POST /api/v1/member/my":                self("id"),
+	"GET /api/v1/member/search":             authed,
+	"PUT /api/v1/member/update":             self("id"),
+	"GET /api/v1/member/active":             anyone,
+	"PUT /api/v1/member/activate":           privileged,
+	"GET /api/v1/member/graduates":          privileged,
+	"POST /api/v1/activity/create":          privileged,
+	"GET /api/v1/activity/search":           anyone,
+	"GET /api/v1/activity/private":          privileged,
+	"PUT /api/v1/activity/update":           privileged,
+	"DELETE /api/v1/activity/delete":        privileged,
+	"POST /api/v1/activity/upload":          privileged,
+	"POST /api/v1/activity/download":        authed,
+	"POST /api/v1/activity/deletefile":      privileged,
+	"POST /api/v1/activity/rsvp":            authed,
+	"POST /api/v1/activity/cancel":          authed,
+	"GET /api/v1/activity/attendees":        privileged,
+	"POST /api/v1/activity/opencheckin":     privileged,
+	"POST /api/v1/activity/closecheckin":    privileged,
+	"GET /api/v1/activity/checkincode":      privileged,
+	"POST /api/v1/activity/checkin":         authed,
+	"GET /api/v1/activity/attendance":       privileged,
+	"GET /api/v1/activity/memberattendance": self("member_id"),
+	"POST /api/v1/activity/createseries":    privileged,
+	"GET /api/v1/activity/series":           privileged,
+	"GET /api/v1/activity/occurrences":      anyone,
+	"GET /api/v1/activity/calendar.ics":     anyone,
+	"POST /api/v1/activity/feed":            authed,
+	"DELETE /api/v1/activity/feed":          authed,
+	"PUT /api/v1/activity/updateseries":     privileged,
+	"DELETE /api/v1/activity/deleteseries":  privileged,
+	"POST /api/v1/fee/create":               privileged,
+	"POST /api/v1/fee/setpolicy":            privileged,
+	"POST /api/v1/fee/policy":               privileged,
+	"POST /api/v1/fee/additem":              privileged,
+	"POST /api/v1/fee/items":                authed,
+	"POST /api/v1/fee/itempayers":           privileged,
+	"POST /api/v1/fee/itemdeptors":          privileged,
+	"POST /api/v1/fee/amount":               self("member_id"),
+	"POST /api/v1/fee/payers":               privileged,
+	"POST /api/v1/fee/deptors":              privileged,
+	"POST /api/v1/fee/search":               authed,
+	"POST /api/v1/fee/statement":            authed,
+	"POST /api/v1/fee/memberstatement":      privileged,
+	"POST /api/v1/fee/pay":                  privileged,
+	"POST /api/v1/fee/deposit":              privileged,
+	"POST /api/v1/fee/exempt":               privileged,
+	"POST /api/v1/fee/revoke":               privileged,
+	"POST /api/v1/fee/reverse":              privileged,
+	"POST /api/v1/fee/import":               privileged,
+	"POST /api/v1/fee/remittances":          privileged,
+	"POST /api/v1/fee/resolve":              privileged,
+	"POST /api/v1/fee/dismiss":              privileged,
+	"POST /api/v1/fee/expend":               privileged,
+	"POST /api/v1/fee/attach":               privileged,
+	"POST /api/v1/fee/attachment":           privileged,
+	"POST /api/v1/fee/receipt":              authed,
+	"POST /api/v1/fee/memberreceipt":        privileged,
+	"POST /api/v1/fee/receipts":             privileged,
+	"POST /api/v1/fee/expenses":             privileged,
+	"POST /api/v1/fee/check":                privileged,
+	"POST /api/v1/fee/trialbalance":         privileged,
+	"POST /api/v1/fee/accountstatement":     privileged,
+	"POST /api/v1/fee/close":                privileged,
+	"POST /api/v1/fee/reopen":               privileged,
+	"POST /api/v1/fee/recompute":            privileged,
+	"POST /api/v1/fee/chain":                privileged,
+	"GET /api/v1/role/list":                 privileged,
+	"GET /api/v1/role/permissions":          privileged,
+	"POST /api/v1/role/create":              privileged,
+	"PUT /api/v1/role/update":               privileged,
+	"DELETE /api/v1/role/delete":            privileged,
+	"PUT /api/v1/role/assign":               privileged,
+	"PUT /api/v1/role/unassign":             privileged,
+	"GET /api/v1/role/grants":               privileged,
+	"GET /api/v1/audit/search":              privileged,
+	"GET /api/v1/reminder/preference":       authed,
+	"PUT /api/v1/reminder/optout":           authed,
+	"GET /api/v1/reminder/deliveries":       privileged,
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = ioutil.Discard
+
+	config.AccessSecret = "secret"
+	config.MasterPassword = "master"
+	if _, err := setupStore("memory"); err != nil {
+		panic(err)
+	}
+
+	for _, id := range []string{"20210001", "20210002"} {
+		if err := member.New(id, "Test", "Department", "010-0000-0000", "testmail", 1, member.Attending).SignUp(ctx); err != nil {
+			panic(err)
+		}
+	}
+	if err := member.Approve(ctx, []string{"20210001", "20210002"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRoutes(t *testing.T) {
+	router := newRouter()
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if _, ok := routes[key]; !ok {
+			t.Errorf("%s: no requirement is declared", key)
+		}
+	}
+	for key := range routes {
+		if !registered[key] {
+			t.Errorf("%s: not registered", key)
+		}
+	}
+
+	for key, req := range routes {
+		if req.public {
+			continue
+		}
+		method, path := split(key)
+
+		// anonymous and forged callers are rejected for every non-public route
+		for _, token := range []string{"", "forged"} {
+			if code := serve(router, method, path, token, ""); code != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: expected %d, got %d", key, token, http.StatusUnauthorized, code)
+			}
+		}
+
+		switch {
+		case req.role:
+			if code := serve(router, method, path, issue(t, "20210001"), ""); code != http.StatusForbidden {
+				t.Errorf("%s by a member: expected %d, got %d", key, http.StatusForbidden, code)
+			}
+			if code := serve(router, method, path, issue(t, member.MASTER), ""); code == http.StatusUnauthorized || code == http.StatusForbidden {
+				t.Errorf("%s by the master: got %d", key, code)
+			}
+		case req.self != "" && method == http.MethodGet:
+			own := path + "?" + req.self + "=20210001"
+			for _, other := range []struct{ path, body string }{
+				{path + "?" + req.self + "=20210002", ""},
+				{path + "?" + strings.ToUpper(req.self) + "=20210002", ""},
+				{path, `{"` + req.self + `": "20210002"}`},
+			} {
+				if code := serve(router, method, other.path, issue(t, "20210001"), other.body); code != http.StatusForbidden {
+					t.Errorf("%s on the other member by %s %s: expected %d, got %d", key, other.path, other.body, http.StatusForbidden, code)
+				}
+			}
+			if code := serve(router, method, own, issue(t, "20210001"), ""); code == http.StatusUnauthorized || code == http.StatusForbidden {
+				t.Errorf("%s on the member itself: got %d", key, code)
+			}
+		case req.self != "":
+			for _, other := range []struct{ path, body string }{
+				{path, `{"` + req.self + `": "20210002"}`},
+				{path + "?" + req.self + "=20210001", `{"` + req.self + `": "20210002"}`},
+				{path, `{"` + strings.ToUpper(req.self) + `": "20210002"}`},
+				{path, `{"` + req.self + `": "20210001", "` + strings.ToUpper(req.self) + `": "20210002"}`},
+			} {
+				if code := serve(router, method, other.path, issue(t, "20210001"), other.body); code != http.StatusForbidden {
+					t.Errorf("%s on the other member by %s %s: expected %d, got %d", key, other.path, other.body, http.StatusForbidden, code)
+				}
+			}
+			own := `{"` + req.self + `": "20210001"}`
+			if code := serve(router, method, path, issue(t, "20210001"), own); code == http.StatusUnauthorized || code == http.StatusForbidden {
+				t.Errorf("%s on the member itself: got %d", key, code)
+			}
+		default:
+			if code := serve(router, method, path, issue(t, "20210001"), ""); code == http.StatusUnauthorized || code == http.StatusForbidden {
+				t.Errorf("%s by a member: got %d", key, code)
+			}
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router := newRouter()
+	token := issue(t, "20210001")
+
+	if code := serve(router, http.MethodPost, "/api/v1/member/logout", token, ""); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+	if code := serve(router, http.MethodGet, "/api/v1/member/sessions", token, ""); code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	router := newRouter()
+
+	// the password is changed only with the current one, even by the member managers
+	for _, req := range []struct{ id, token string }{
+		{member.MASTER, issue(t, member.MASTER)},
+		{"20210001", issue(t, member.MASTER)},
+		{"20210001", issue(t, "20210001")},
+	} {
+		body := `{"id": "` + req.id + `", "update": {"password": "takeover2021"}}`
+		if code := serve(router, http.MethodPut, "/api/v1/member/update", req.token, body); code != http.StatusBadRequest {
+			t.Errorf("password update of %s: expected %d, got %d", req.id, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestCustomRole(t *testing.T) {
+	router := newRouter()
+
+	if err := rbac.New("treasurer", "총무", rbac.Permissions{rbac.FeeRead}).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(router, http.MethodPost, "/api/v1/fee/payers", issue(t, "20210002"), ""); code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, code)
+	}
+
+	expiredAt := time.Now().Add(time.Hour).Unix()
+	if err := rbac.Assign(ctx, "treasurer", []string{"20210002"}, expiredAt, member.MASTER); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(router, http.MethodPost, "/api/v1/fee/payers", issue(t, "20210002"), ""); code == http.StatusForbidden {
+		t.Errorf("expected not %d, got %d", http.StatusForbidden, code)
+	}
+	if code := serve(router, http.MethodPost, "/api/v1/fee/pay", issue(t, "20210002"), ""); code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, code)
+	}
+
+	if err := rbac.Unassign(ctx, "treasurer", []string{"20210002"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(router, http.MethodPost, "/api/v1/fee/payers", issue(t, "20210002"), ""); code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	router := newRouter()
+	token := issue(t, member.MASTER)
+
+	if code := serve(router, http.MethodPost, "/api/v1/fee/create", token, `{"year": 2000, "semester": 1, "amount": 10000}`); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit/search?action=fee.create&target=fee:2000-1&format=csv", nil)
+	req.Header.Set("Authorization", token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and an entry, got %q", rec.Body.String())
+	}
+	// httptest requests come from 192.0.2.1
+	if fields := strings.Split(lines[1], ","); fields[2] != member.MASTER || fields[3] != "192.0.2.1" || fields[4] != "fee.create" {
+		t.Errorf("unexpected entry: %s", lines[1])
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	defer func(proxies []string) { config.TrustedProxies = proxies }(config.TrustedProxies)
+	token := issue(t, member.MASTER)
+
+	// httptest requests come from 192.0.2.1, and the client forges the first hop of X-Forwarded-For
+	for idx, tc := range []struct {
+		proxies  []string
+		expected string
+	}{
+		{nil, "192.0.2.1"},
+		{[]string{"192.0.2.0/24"}, "203.0.113.9"},
+		{[]string{"192.0.2.1", "203.0.113.0/24"}, "198.51.100.7"},
+	} {
+		config.TrustedProxies = tc.proxies
+		router := newRouter()
+		year := 2001 + idx
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/fee/create", strings.NewReader(fmt.Sprintf(`{"year": %d, "semester": 1, "amount": 10000}`, year)))
+		req.Header.Set("Authorization", token)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1, 198.51.100.7, 203.0.113.9")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		entries, err := audit.Search(ctx, audit.Filter{Actions: []string{audit.FeeCreate}, Target: fmt.Sprintf("fee:%d-1", year)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].IP != tc.expected {
+			t.Errorf("proxies %v: expected %s, got %v", tc.proxies, tc.expected, entries)
+		}
+	}
+}
+
+func TestActivityVisibility(t *testing.T) {
+	router := newRouter()
+	master := issue(t, member.MASTER)
+
+	for _, level := range []string{"public", "members", "managers"} {
+		body := `{"title": "visibility ` + level + `", "start": "1", "end": "1", "type": 2, "participants": [], "visibility": "` + level + `"}`
+		if code := serve(router, http.MethodPost, "/api/v1/activity/create", master, body); code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, code)
+		}
+	}
+	if code := serve(router, http.MethodPost, "/api/v1/activity/create", master, `{"title": "invalid", "visibility": "friends"}`); code != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, code)
+	}
+	if code := serve(router, http.MethodGet, "/api/v1/activity/search", "forged", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		token    string
+		expected []string
+	}{
+		{"anonymous", "", []string{"public"}},
+		{"member", issue(t, "20210001"), []string{"public", "members"}},
+		{"manager", master, []string{"public", "members", "managers"}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/activity/search?query=visibility", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", tc.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", tc.name, http.StatusOK, rec.Code)
+		}
+		if count := strings.Count(rec.Body.String(), `"title":"visibility `); count != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %s", tc.name, tc.expected, rec.Body.String())
+		}
+		for _, level := range tc.expected {
+			if !strings.Contains(rec.Body.String(), `"title":"visibility `+level+`"`) {
+				t.Errorf("%s: expected to find %s, got %s", tc.name, level, rec.Body.String())
+			}
+		}
+	}
+}
+
+// issue signs in the member of id on a new session, and returns its access token.
+func issue(t *testing.T, id string) string {
+	pair, err := oauth2.Issue(ctx, id, oauth2.Device{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pair.AccessToken)
+}
+
+// serve serves the request to router, and returns its status code.
+func serve(router http.Handler, method, path, token, body string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func split(key string) (method, path string) {
+	idx := strings.Index(key, " ")
+	return key[:idx], key[idx+1:]
+}
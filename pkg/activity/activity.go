@@ -17,13 +17,12 @@ package activity
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 
-	"github.com/kmu-kcc/buddy-backend/config"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -32,22 +31,99 @@ const (
 	Etc
 )
 
+// The visibility levels of the activities.
+const (
+	Public       = "public"       // anyone, including the anonymous visitors
+	Members      = "members"      // the authenticated members
+	Managers     = "managers"     // the club managers
+	Participants = "participants" // the participants and the club managers
+)
+
+var (
+	ErrInvalidVisibility = errors.New("invalid visibility")
+	ErrFileNotFound      = errors.New("file not found")
+)
+
 // Activity represents a club activity state.
 type Activity struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id"`
-	Title        string             `json:"title" bson:"title"`
-	Start        int64              `json:"start,string" bson:"start"`
-	End          int64              `json:"end,string" bson:"end"`
-	Place        string             `json:"place" bson:"place"`
-	Type         int                `json:"type" bson:"type"`
-	Description  string             `json:"description" bson:"description"`
-	Participants []string           `json:"participants" bson:"participants"`
-	Private      bool               `json:"private" bson:"private"`
-	Files        Files              `json:"files" bson:"files"`
+	ID           primitive.ObjectID  `json:"id" bson:"_id"`
+	Title        string              `json:"title" bson:"title"`
+	Start        int64               `json:"start,string" bson:"start"`
+	End          int64               `json:"end,string" bson:"end"`
+	Place        string              `json:"place" bson:"place"`
+	Type         int                 `json:"type" bson:"type"`
+	Description  string              `json:"description" bson:"description"`
+	Participants []string            `json:"participants" bson:"participants"`
+	Private      bool                `json:"private" bson:"private"` // whether it is not public, kept for the old clients
+	Visibility   string              `json:"visibility" bson:"visibility"`
+	Capacity     int                 `json:"capacity" bson:"capacity"`                                // maximum number of the participants (zero for unlimited)
+	RSVPDeadline int64               `json:"rsvp_deadline,string" bson:"rsvp_deadline"`               // when the RSVP closes (zero for the start)
+	Waitlist     []string            `json:"waitlist" bson:"waitlist"`                                // members waiting for a vacancy in order
+	SeriesID     *primitive.ObjectID `json:"series_id,omitempty" bson:"series_id,omitempty"`          // series the activity is an occurrence of
+	Occurrence   int64               `json:"occurrence,string,omitempty" bson:"occurrence,omitempty"` // start of the occurrence in the series, before edited (RECURRENCE-ID)
+	Overridden   bool                `json:"overridden,omitempty" bson:"overridden,omitempty"`        // whether the occurrence is edited apart from the series
+	Files        Files               `json:"files" bson:"files"`
 }
 
 type Activities []Activity
 
+// Viewer represents whom the activities are read by.
+// The zero value is an anonymous visitor.
+type Viewer struct {
+	MemberID string // student ID of the authenticated member (empty for anonymous)
+	Manager  bool   // whether the viewer can read every activity
+}
+
+// level returns the visibility level of a.
+// An activity without the level is for the managers if it is private, and public otherwise.
+func (a Activity) level() string {
+	switch {
+	case a.Visibility != "":
+		return a.Visibility
+	case a.Private:
+		return Managers
+	default:
+		return Public
+	}
+}
+
+// VisibleTo reports whether v can read a.
+func (a Activity) VisibleTo(v Viewer) bool {
+	switch a.level() {
+	case Public:
+		return true
+	case Members:
+		return v.MemberID != "" || v.Manager
+	case Participants:
+		if v.MemberID != "" {
+			for _, id := range a.Participants {
+				if id == v.MemberID {
+					return true
+				}
+			}
+		}
+	}
+	return v.Manager
+}
+
+// normalize sets the visibility level of a from its private flag if it is empty,
+// and the private flag from the level.
+func (a *Activity) normalize() error {
+	a.Visibility = a.level()
+	switch a.Visibility {
+	case Public, Members, Managers, Participants:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidVisibility, a.Visibility)
+	}
+	a.Private = a.Visibility != Public
+
+	if a.Capacity < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidCapacity, a.Capacity)
+	}
+	a.fit()
+	return nil
+}
+
 // New returns a new activity.
 func New(title string, start, end int64, place, description string, typ int, participants []string, private bool) *Activity {
 	return &Activity{
@@ -70,108 +146,117 @@ func New(title string, start, end int64, place, description string, typ int, par
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (a Activity) Create() (err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
+func (a Activity) Create(ctx context.Context) error {
+	if err := a.normalize(); err != nil {
+		return err
 	}
-	defer client.Disconnect(ctx)
-
-	_, err = client.Database("club").Collection("activities").InsertOne(ctx, a)
-	return err
-}
-
-// Search returns search results with query.
-//
-// NOTE:
-//
-// If private, it is a privileged operation:
-//	Only the club managers can access to this operation.
-func Search(query string, private bool) (activities Activities, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
+	if err := store.Insert(ctx, a); err != nil {
+		return err
 	}
-	defer client.Disconnect(ctx)
+	return audit.Record(ctx, audit.ActivityCreate, target(a.ID), nil, a)
+}
 
-	var filter bson.D
-	activity := new(Activity)
+// Search returns search results with query, which v can read.
+func Search(ctx context.Context, query string, v Viewer) (Activities, error) {
+	var filter Filter
 
 	switch strings.TrimSpace(query) {
 	case "창립제":
-		filter = bson.D{bson.E{Key: "type", Value: FoundingEvent}}
+		typ := FoundingEvent
+		filter.Type = &typ
 	case "스터디":
 		fallthrough
 	case "study":
-		filter = bson.D{bson.E{Key: "type", Value: Study}}
+		typ := Study
+		filter.Type = &typ
 	default:
-		filter = bson.D{
-			bson.E{Key: "$or", Value: bson.A{
-				bson.D{
-					bson.E{Key: "title", Value: bson.D{
-						bson.E{Key: "$regex", Value: query}}}},
-				bson.D{
-					bson.E{Key: "place", Value: bson.D{
-						bson.E{Key: "$regex", Value: query}}}},
-				bson.D{
-					bson.E{Key: "description", Value: bson.D{
-						bson.E{Key: "$regex", Value: query}}}}}}}
-	}
-
-	cur, err := client.Database("club").Collection("activities").Find(ctx, filter)
+		filter.Query = query
+	}
+
+	activities, err := store.Find(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
+		return nil, err
 	}
+	return activities.visibleTo(v), nil
+}
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(activity); err != nil {
-			return
+// visibleTo returns the activities of as which v can read.
+func (as Activities) visibleTo(v Viewer) Activities {
+	visible := Activities{}
+	for _, a := range as {
+		if a.VisibleTo(v) {
+			visible = append(visible, a)
 		}
-		activities = append(activities, *activity)
 	}
+	return visible
+}
+
+// Download returns the file of FILENAME of an activity which v can read.
+// It returns ErrFileNotFound if there is no such file, so that the hidden files are not revealed.
+func Download(ctx context.Context, filename string, v Viewer) (File, error) {
+	file := NewFile(filename)
 
-	return activities, cur.Close(ctx)
+	activities, err := store.Find(ctx, Filter{File: file})
+	if err != nil {
+		return "", err
+	}
+	if len(activities.visibleTo(v)) == 0 {
+		return "", ErrFileNotFound
+	}
+	return file, nil
 }
 
 // Update updates a to update.
+// The participants, the waitlist and the files are not updated, but changed by their own operations.
 //
 // NOTE:
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (a Activity) Update() error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
+func (a Activity) Update(ctx context.Context) error {
+	if err := a.normalize(); err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	return mutate(ctx, a.ID, audit.ActivityUpdate, func() error {
+		old, err := store.Get(ctx, a.ID)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// an occurrence stays in its series, but is no longer updated along with it.
+		a.SeriesID, a.Occurrence, a.Overridden = old.SeriesID, old.Occurrence, old.SeriesID != nil
+		if err = store.Update(ctx, a); err != nil {
+			return err
+		}
 
-	_, err = client.Database("club").Collection("activities").UpdateByID(ctx, a.ID, bson.M{"$set": a})
-	return err
+		// the attendees are kept as stored, but fit into the capacity updated.
+		return swap(ctx, a.ID, func(a *Activity) error {
+			a.fit()
+			return nil
+		})
+	})
 }
 
 // Delete deletes a club activity of id.
+// An occurrence of a series is cancelled in the series too, so that it is not expanded again.
 //
 // NOTE:
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Delete(id primitive.ObjectID) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
-
-	_, err = client.Database("club").Collection("activities").DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: id}})
-	return err
+func Delete(ctx context.Context, id primitive.ObjectID) error {
+	return mutate(ctx, id, audit.ActivityDelete, func() error {
+		return transactor.Transaction(ctx, func(ctx context.Context) error {
+			if a, err := store.Get(ctx, id); err == nil && a.SeriesID != nil {
+				if err = cancel(ctx, *a.SeriesID, a.Occurrence); err != nil {
+					return err
+				}
+			}
+			return store.Delete(ctx, id)
+		})
+	})
 }
 
 // Upload saves file of FILENAME into a.
@@ -180,16 +265,8 @@ func Delete(id primitive.ObjectID) error {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (a Activity) Upload(filename string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
-
-	_, err = client.Database("club").Collection("activities").UpdateByID(ctx, a.ID, bson.D{bson.E{Key: "$push", Value: bson.D{bson.E{Key: "files", Value: NewFile(filename)}}}})
-	return err
+func (a Activity) Upload(ctx context.Context, filename string) error {
+	return mutate(ctx, a.ID, audit.ActivityUpload, func() error { return store.PushFile(ctx, a.ID, NewFile(filename)) })
 }
 
 // DeleteFile deletes file of FILENAME from a.
@@ -198,16 +275,46 @@ func (a Activity) Upload(filename string) error {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (a Activity) DeleteFile(filename string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
+func (a Activity) DeleteFile(ctx context.Context, filename string) error {
+	file := NewFile(filename)
+
+	// the file is moved aside before the activity is updated, and removed only after,
+	// so that neither the activity nor the registry is left referring to a half-deleted file.
+	if err := file.stash(); err != nil {
+		return err
+	}
+	if err := mutate(ctx, a.ID, audit.ActivityDeleteFile, func() error { return store.PullFile(ctx, a.ID, file) }); err != nil {
+		if rerr := file.restore(); rerr != nil {
+			return fmt.Errorf("%v (restoring %s: %v)", err, file, rerr)
+		}
+		return err
+	}
+	return file.purge()
+}
+
+// mutate runs fn which mutates the activity of id,
+// and records action with the states of the activity around it.
+// Nothing is recorded if there is no such activity.
+func mutate(ctx context.Context, id primitive.ObjectID, action string, fn func() error) error {
+	before, err := load(ctx, id)
+	if err == ErrNotFound {
+		return fn()
+	} else if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
 
-	if _, err = client.Database("club").Collection("activities").UpdateByID(ctx, a.ID, bson.D{bson.E{Key: "$pull", Value: bson.D{bson.E{Key: "files", Value: bson.D{bson.E{Key: "$in", Value: bson.A{filename}}}}}}}); err != nil {
+	if err = fn(); err != nil {
 		return err
 	}
-	return NewFile(filename).Delete()
+
+	after, err := store.Get(ctx, id)
+	if err == ErrNotFound {
+		return audit.Record(ctx, action, target(id), before, nil)
+	} else if err != nil {
+		return err
+	}
+	return audit.Record(ctx, action, target(id), before, after)
 }
+
+// target returns the audit target of the activity of id.
+func target(id primitive.ObjectID) string { return audit.Target("activity", id.Hex()) }
@@ -15,12 +15,35 @@
 package activity_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ctx           = context.Background()
+	memberStore   = member.NewMemoryStore()
+	activityStore = activity.NewMemoryStore()
+	seriesStore   = activity.NewMemorySeriesStore()
+	transactor    = activity.NewMemoryTransactor(activityStore, seriesStore)
+)
+
+func TestMain(m *testing.M) {
+	member.SetStore(memberStore)
+	activity.SetStore(activityStore, seriesStore, activity.NewMemoryCheckInStore(), activity.NewMemoryFeedStore(), transactor)
+	audit.SetStore(audit.NewMemoryStore())
+	os.Exit(m.Run())
+}
+
 func TestCreate(t *testing.T) {
 	acts := []*activity.Activity{
 		activity.New("study", 1, 1, "cafe", "study", 0, []string{}, true),
@@ -28,27 +51,90 @@ func TestCreate(t *testing.T) {
 	}
 
 	for _, act := range acts {
-		if err := act.Create(); err != nil {
+		if err := act.Create(ctx); err != nil {
 			t.Error(err)
 		}
 	}
 }
 
 func TestSearch(t *testing.T) {
-	if activities, err := activity.Search("te", false); err != nil {
+	if activities, err := activity.Search(ctx, "te", activity.Viewer{}); err != nil {
 		t.Error(err)
 	} else {
 		t.Log(activities)
 	}
 }
 
+func TestVisibility(t *testing.T) {
+	acts := map[string]*activity.Activity{
+		activity.Public:       activity.New("visibility public", 1, 1, "cafe", "", activity.Etc, []string{}, false),
+		activity.Members:      activity.New("visibility members", 1, 1, "cafe", "", activity.Etc, []string{}, false),
+		activity.Managers:     activity.New("visibility managers", 1, 1, "cafe", "", activity.Etc, []string{}, false),
+		activity.Participants: activity.New("visibility participants", 1, 1, "cafe", "", activity.Etc, []string{"20210002"}, false),
+	}
+	for level, act := range acts {
+		act.Visibility = level
+		act.Files = activity.Files{activity.NewFile(level + ".pdf")}
+		if err := act.Create(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := activity.New("visibility legacy", 1, 1, "cafe", "", activity.Etc, []string{}, true)
+	if err := legacy.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	invalid := activity.New("visibility invalid", 1, 1, "cafe", "", activity.Etc, []string{}, false)
+	invalid.Visibility = "friends"
+	if err := invalid.Create(ctx); !errors.Is(err, activity.ErrInvalidVisibility) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidVisibility, err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		viewer   activity.Viewer
+		expected []string
+	}{
+		{"anonymous", activity.Viewer{}, []string{activity.Public}},
+		{"member", activity.Viewer{MemberID: "20210001"}, []string{activity.Public, activity.Members}},
+		{"participant", activity.Viewer{MemberID: "20210002"}, []string{activity.Public, activity.Members, activity.Participants}},
+		{"manager", activity.Viewer{MemberID: "20210003", Manager: true}, []string{activity.Public, activity.Members, activity.Managers, activity.Participants, "legacy"}},
+	} {
+		activities, err := activity.Search(ctx, "^visibility", tc.viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]bool)
+		for _, act := range activities {
+			found[strings.TrimPrefix(act.Title, "visibility ")] = true
+		}
+		if len(found) != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, activities)
+		}
+		for _, level := range tc.expected {
+			if !found[level] {
+				t.Errorf("%s: expected to find %s, got %v", tc.name, level, activities)
+			}
+		}
+
+		for level := range acts {
+			_, err := activity.Download(ctx, level+".pdf", tc.viewer)
+			if visible := found[level]; visible && err != nil {
+				t.Errorf("%s: expected to download %s, got %v", tc.name, level, err)
+			} else if !visible && err != activity.ErrFileNotFound {
+				t.Errorf("%s: expected %v on %s, got %v", tc.name, activity.ErrFileNotFound, level, err)
+			}
+		}
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	objectId, err := primitive.ObjectIDFromHex("6113ed60c7913f56af94f532")
 	if err != nil {
 		t.Error(err)
 	}
 
-	if err = (activity.Activity{ID: objectId, Type: 1}).Update(); err != nil {
+	if err = (activity.Activity{ID: objectId, Type: 1}).Update(ctx); err != nil {
 		t.Error(err)
 	}
 }
@@ -59,7 +145,471 @@ func TestDelete(t *testing.T) {
 		t.Error(err)
 	}
 
-	if err := activity.Delete(objectId); err != nil {
+	if err := activity.Delete(ctx, objectId); err != nil {
 		t.Error(err)
 	}
 }
+
+func TestRSVP(t *testing.T) {
+	for _, id := range []string{"20220001", "20220002", "20220003", "20220004"} {
+		if err := memberStore.Insert(ctx, member.Member{ID: id, Name: "RSVP " + id, Approved: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viewer := func(id string) activity.Viewer { return activity.Viewer{MemberID: id} }
+
+	start := time.Now().Add(48 * time.Hour).Unix()
+	act := activity.New("rsvp", start, start, "cafe", "", activity.Study, []string{}, false)
+	act.Visibility, act.Capacity = activity.Members, 2
+	if err := act.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := activity.RSVP(ctx, act.ID, activity.Viewer{}); err != activity.ErrNotFound {
+		t.Errorf("expected %v for an anonymous visitor, got %v", activity.ErrNotFound, err)
+	}
+	for idx, expected := range []string{activity.Going, activity.Going, activity.Waitlisted, activity.Waitlisted} {
+		id := []string{"20220001", "20220002", "20220003", "20220004"}[idx]
+		if status, err := activity.RSVP(ctx, act.ID, viewer(id)); err != nil || status != expected {
+			t.Errorf("%s: expected %s, got %s, %v", id, expected, status, err)
+		}
+	}
+	if _, err := activity.RSVP(ctx, act.ID, viewer("20220003")); err != activity.ErrAlreadyRSVPed {
+		t.Errorf("expected %v, got %v", activity.ErrAlreadyRSVPed, err)
+	}
+
+	// the first on the waitlist is promoted
+	if err := activity.Cancel(ctx, act.ID, "20220001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := activity.Cancel(ctx, act.ID, "20220001"); err != activity.ErrNotRSVPed {
+		t.Errorf("expected %v, got %v", activity.ErrNotRSVPed, err)
+	}
+
+	attendees, err := activity.AttendeesOf(ctx, act.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := activity.Attendees{
+		{MemberID: "20220002", Name: "RSVP 20220002", Status: activity.Going},
+		{MemberID: "20220003", Name: "RSVP 20220003", Status: activity.Going},
+		{MemberID: "20220004", Name: "RSVP 20220004", Status: activity.Waitlisted},
+	}
+	if len(attendees) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, attendees)
+	}
+	for idx := range expected {
+		if attendees[idx] != expected[idx] {
+			t.Errorf("expected %v, got %v", expected[idx], attendees[idx])
+		}
+	}
+
+	buf := new(strings.Builder)
+	if err = attendees.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 4 || lines[3] != "20220004,RSVP 20220004,,,,waitlisted" {
+		t.Errorf("unexpected CSV: %q", buf.String())
+	}
+
+	// raising the capacity promotes the waitlist
+	updated, err := activity.Search(ctx, "^rsvp$", viewer("20220001"))
+	if err != nil || len(updated) != 1 {
+		t.Fatalf("expected the activity, got %v, %v", updated, err)
+	}
+	updated[0].Capacity = 3
+	if err = updated[0].Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if attendees, err = activity.AttendeesOf(ctx, act.ID); err != nil || len(attendees) != 3 || attendees[2].Status != activity.Going {
+		t.Errorf("expected the waitlist promoted, got %v, %v", attendees, err)
+	}
+
+	// an edit without the attendees keeps them, and lowering the capacity moves the rest to the waitlist
+	edit := activity.Activity{ID: act.ID, Title: "rsvp edited", Start: start, End: start, Visibility: activity.Members, Capacity: 1}
+	if err = edit.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if attendees, err = activity.AttendeesOf(ctx, act.ID); err != nil || len(attendees) != 3 {
+		t.Fatalf("expected the attendees kept, got %v, %v", attendees, err)
+	}
+	for idx, expected := range []string{activity.Going, activity.Waitlisted, activity.Waitlisted} {
+		if attendees[idx].MemberID != []string{"20220002", "20220003", "20220004"}[idx] || attendees[idx].Status != expected {
+			t.Errorf("expected %s, got %v", expected, attendees[idx])
+		}
+	}
+
+	closed := activity.New("rsvp closed", start, start, "cafe", "", activity.Study, []string{}, false)
+	closed.RSVPDeadline = time.Now().Add(-time.Hour).Unix()
+	if err = closed.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = activity.RSVP(ctx, closed.ID, viewer("20220001")); err != activity.ErrRSVPClosed {
+		t.Errorf("expected %v, got %v", activity.ErrRSVPClosed, err)
+	}
+
+	invalid := activity.New("rsvp invalid", start, start, "cafe", "", activity.Study, []string{}, false)
+	invalid.Capacity = -1
+	if err = invalid.Create(ctx); !errors.Is(err, activity.ErrInvalidCapacity) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidCapacity, err)
+	}
+}
+
+func TestCheckIn(t *testing.T) {
+	viewer := func(id string) activity.Viewer { return activity.Viewer{MemberID: id} }
+
+	act := activity.New("check-in", 1, 1, "cafe", "", activity.Study, []string{}, false)
+	act.Visibility = activity.Members
+	if err := act.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := activity.CheckIn(ctx, act.ID, "000000", viewer("20220001")); err != activity.ErrCheckInClosed {
+		t.Errorf("expected %v before opening, got %v", activity.ErrCheckInClosed, err)
+	}
+	if _, err := activity.OpenCheckIn(ctx, act.ID, 0); !errors.Is(err, activity.ErrInvalidDuration) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidDuration, err)
+	}
+	if _, err := activity.OpenCheckIn(ctx, act.ID, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := activity.CurrentCode(ctx, act.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code.Code) != 6 || !strings.Contains(code.Payload, act.ID.Hex()) || !strings.Contains(code.Payload, code.Code) {
+		t.Errorf("unexpected code: %+v", code)
+	}
+
+	if _, err = activity.CheckIn(ctx, act.ID, "abcdef", viewer("20220001")); err != activity.ErrInvalidCode {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidCode, err)
+	}
+	if _, err = activity.CheckIn(ctx, act.ID, code.Code, activity.Viewer{}); err != activity.ErrNotFound {
+		t.Errorf("expected %v for an anonymous visitor, got %v", activity.ErrNotFound, err)
+	}
+	for _, id := range []string{"20220001", "20220002"} {
+		if attendance, err := activity.CheckIn(ctx, act.ID, code.Code, viewer(id)); err != nil {
+			t.Fatal(err)
+		} else if attendance.MemberID != id || attendance.ActivityID != act.ID || attendance.CheckedAt == 0 {
+			t.Errorf("unexpected attendance: %+v", attendance)
+		}
+	}
+	if _, err = activity.CheckIn(ctx, act.ID, code.Code, viewer("20220001")); err != activity.ErrAlreadyCheckedIn {
+		t.Errorf("expected %v, got %v", activity.ErrAlreadyCheckedIn, err)
+	}
+
+	if attendances, err := activity.AttendanceOf(ctx, act.ID); err != nil || len(attendances) != 2 {
+		t.Errorf("expected 2 attendances, got %v, %v", attendances, err)
+	}
+	if attendances, err := activity.MemberAttendance(ctx, "20220002"); err != nil || len(attendances) != 1 || attendances[0].ActivityID != act.ID {
+		t.Errorf("expected the attendance of 20220002, got %v, %v", attendances, err)
+	}
+
+	// the member who ran out of the attempts cannot check in even with the right code, until the window is reopened
+	for i := 0; i < activity.MaxCheckInAttempts; i++ {
+		if _, err = activity.CheckIn(ctx, act.ID, "abcdef", viewer("20220004")); err != activity.ErrInvalidCode {
+			t.Errorf("expected %v, got %v", activity.ErrInvalidCode, err)
+		}
+	}
+	if _, err = activity.CheckIn(ctx, act.ID, code.Code, viewer("20220004")); err != activity.ErrInvalidCode {
+		t.Errorf("expected %v after %d attempts, got %v", activity.ErrInvalidCode, activity.MaxCheckInAttempts, err)
+	}
+	if _, err = activity.OpenCheckIn(ctx, act.ID, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if code, err = activity.CurrentCode(ctx, act.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = activity.CheckIn(ctx, act.ID, code.Code, viewer("20220004")); err != nil {
+		t.Errorf("expected the check-in after reopening, got %v", err)
+	}
+
+	if err = activity.CloseCheckIn(ctx, act.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = activity.CurrentCode(ctx, act.ID); err != activity.ErrCheckInClosed {
+		t.Errorf("expected %v after closing, got %v", activity.ErrCheckInClosed, err)
+	}
+	if _, err = activity.CheckIn(ctx, act.ID, code.Code, viewer("20220003")); err != activity.ErrCheckInClosed {
+		t.Errorf("expected %v after closing, got %v", activity.ErrCheckInClosed, err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	errAbort := errors.New("abort")
+	act := activity.New("transaction", 1, 1, "cafe", "", activity.Etc, []string{}, false)
+	series := activity.NewSeries(activity.Activity{Title: "transaction", Start: 1, End: 1}, "FREQ=DAILY")
+
+	if err := transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := activityStore.Insert(ctx, *act); err != nil {
+			return err
+		}
+		if err := seriesStore.Insert(ctx, *series); err != nil {
+			return err
+		}
+		return errAbort
+	}); err != errAbort {
+		t.Fatalf("expected %v, got %v", errAbort, err)
+	}
+
+	if _, err := activityStore.Get(ctx, act.ID); err != activity.ErrNotFound {
+		t.Errorf("expected the activity to be rolled back, got %v", err)
+	}
+	if _, err := seriesStore.Get(ctx, series.ID); err != activity.ErrSeriesNotFound {
+		t.Errorf("expected the series to be rolled back, got %v", err)
+	}
+}
+
+// occurrences returns the occurrences of the series of id in [from, to) which v can read.
+func occurrences(t *testing.T, id primitive.ObjectID, from, to time.Time, v activity.Viewer) activity.Activities {
+	t.Helper()
+
+	activities, err := activity.Occurrences(ctx, from.Unix(), to.Unix(), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	occurrences := activity.Activities{}
+	for _, a := range activities {
+		if a.SeriesID != nil && *a.SeriesID == id {
+			occurrences = append(occurrences, a)
+		}
+	}
+	return occurrences
+}
+
+func TestRRule(t *testing.T) {
+	kst := time.FixedZone("KST", 9*60*60)
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 0, 0, 0, kst)
+	}
+
+	for _, test := range []struct {
+		rule     string
+		start    time.Time
+		expected []time.Time
+	}{
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20300107", day(2030, 1, 1), []time.Time{day(2030, 1, 1), day(2030, 1, 3), day(2030, 1, 5), day(2030, 1, 7)}},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=4", day(2030, 1, 4), []time.Time{day(2030, 1, 4), day(2030, 1, 14), day(2030, 1, 18), day(2030, 1, 28)}},
+		{"FREQ=MONTHLY;BYDAY=2TU;COUNT=3", day(2030, 1, 8), []time.Time{day(2030, 1, 8), day(2030, 2, 12), day(2030, 3, 12)}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", day(2030, 1, 31), []time.Time{day(2030, 1, 31), day(2030, 2, 28), day(2030, 3, 31)}},
+		{"FREQ=MONTHLY;COUNT=3", day(2030, 1, 31), []time.Time{day(2030, 1, 31), day(2030, 3, 31), day(2030, 5, 31)}},
+		{"FREQ=YEARLY;BYMONTH=3,9;BYDAY=-1FR;COUNT=2", day(2030, 1, 1), []time.Time{day(2030, 3, 29), day(2030, 9, 27)}},
+	} {
+		s := activity.NewSeries(activity.Activity{Title: "rrule", Start: test.start.Unix(), End: test.start.Unix(), Visibility: activity.Public}, test.rule)
+		if err := s.Create(ctx); err != nil {
+			t.Fatalf("%s: %v", test.rule, err)
+		}
+
+		got := occurrences(t, s.ID, day(2030, 1, 1), day(2030, 12, 31), activity.Viewer{})
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: expected %d occurrences, got %d", test.rule, len(test.expected), len(got))
+			continue
+		}
+		for idx, a := range got {
+			if a.Start != test.expected[idx].Unix() {
+				t.Errorf("%s: expected %v, got %v", test.rule, test.expected[idx], time.Unix(a.Start, 0).In(kst))
+			}
+		}
+	}
+
+	for _, rule := range []string{"", "FREQ=HOURLY", "FREQ=DAILY;COUNT=0", "FREQ=DAILY;COUNT=2;UNTIL=20300101", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=DAILY;BYSETPOS=1"} {
+		if err := activity.NewSeries(activity.Activity{Start: 1, End: 1}, rule).Create(ctx); !errors.Is(err, activity.ErrInvalidRRule) {
+			t.Errorf("%q: expected %v, got %v", rule, activity.ErrInvalidRRule, err)
+		}
+	}
+	if err := activity.NewSeries(activity.Activity{}, "FREQ=DAILY").Create(ctx); !errors.Is(err, activity.ErrInvalidSeries) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidSeries, err)
+	}
+	if _, err := activity.Occurrences(ctx, 2, 1, activity.Viewer{}); !errors.Is(err, activity.ErrInvalidRange) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidRange, err)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	kst := time.FixedZone("KST", 9*60*60)
+	at := func(day, hour int) time.Time { return time.Date(2030, 3, day, hour, 0, 0, 0, kst) }
+	from, to := at(1, 0), at(31, 0)
+	viewer := activity.Viewer{MemberID: "20220001"}
+
+	// every Tuesday and Thursday from March 5th, 2030
+	s := activity.NewSeries(activity.Activity{
+		Title:        "series",
+		Start:        at(5, 19).Unix(),
+		End:          at(5, 21).Unix(),
+		Place:        "cafe",
+		Type:         activity.Study,
+		Visibility:   activity.Members,
+		RSVPDeadline: at(5, 18).Unix(),
+	}, "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=6")
+	if err := s.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(stage string, expected ...time.Time) activity.Activities {
+		t.Helper()
+		got := occurrences(t, s.ID, from, to, viewer)
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %d occurrences, got %v", stage, len(expected), got)
+		}
+		for idx, a := range got {
+			if a.Start != expected[idx].Unix() {
+				t.Errorf("%s: expected %v, got %v", stage, expected[idx], time.Unix(a.Start, 0).In(kst))
+			}
+		}
+		return got
+	}
+
+	got := expect("created", at(5, 19), at(7, 19), at(12, 19), at(14, 19), at(19, 19), at(21, 19))
+	if got[1].End != at(7, 21).Unix() || got[1].RSVPDeadline != at(7, 18).Unix() || got[1].Title != "series" {
+		t.Errorf("unexpected occurrence: %+v", got[1])
+	}
+	if anonymous := occurrences(t, s.ID, from, to, activity.Viewer{}); len(anonymous) != 0 {
+		t.Errorf("expected no occurrences for an anonymous visitor, got %v", anonymous)
+	}
+
+	// an occurrence is stored on RSVP, and a cancelled one is not expanded
+	if status, err := activity.RSVP(ctx, got[1].ID, viewer); err != nil || status != activity.Going {
+		t.Fatalf("expected %s, got %s, %v", activity.Going, status, err)
+	}
+	if err := activity.Delete(ctx, got[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := activity.UpdateSeries(ctx, got[3].ID, activity.ScopeThis, activity.Activity{Title: "moved", Start: at(14, 20).Unix(), End: at(14, 22).Unix(), Visibility: activity.Members}, ""); err != nil {
+		t.Fatal(err)
+	}
+	got = expect("edited", at(5, 19), at(7, 19), at(14, 20), at(19, 19), at(21, 19))
+	if len(got[1].Participants) != 1 || !got[2].Overridden || got[2].Title != "moved" {
+		t.Errorf("unexpected occurrences: %+v, %+v", got[1], got[2])
+	}
+
+	// the whole series moves to 6 p.m., but the overridden occurrence
+	if err := activity.UpdateSeries(ctx, got[0].ID, activity.ScopeAll, activity.Activity{Title: "renamed", Start: at(19, 18).Unix(), End: at(19, 20).Unix(), Visibility: activity.Members}, ""); err != nil {
+		t.Fatal(err)
+	}
+	got = expect("renamed", at(5, 18), at(7, 18), at(14, 20), at(19, 18), at(21, 18))
+	if got[1].Title != "renamed" || len(got[1].Participants) != 1 || got[2].Title != "moved" {
+		t.Errorf("unexpected occurrences: %+v, %+v", got[1], got[2])
+	}
+
+	// this and the following occurrences are split into a new series
+	if err := activity.UpdateSeries(ctx, got[3].ID, activity.ScopeFollowing, activity.Activity{Title: "advanced", Visibility: activity.Members}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expect("split", at(5, 18), at(7, 18), at(14, 20))
+
+	all, err := activity.Occurrences(ctx, from.Unix(), to.Unix(), viewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tail *primitive.ObjectID
+	for _, a := range all {
+		if a.Title == "advanced" {
+			tail = a.SeriesID
+		}
+	}
+	if tail == nil || *tail == s.ID {
+		t.Fatalf("expected a new series, got %v", all)
+	}
+	if advanced := occurrences(t, *tail, from, to, viewer); len(advanced) != 2 || advanced[0].Start != at(19, 18).Unix() || advanced[1].Start != at(21, 18).Unix() {
+		t.Errorf("unexpected occurrences of the new series: %v", advanced)
+	}
+
+	if head, err := activity.GetSeries(ctx, s.ID); err != nil || !strings.Contains(head.RRule, "UNTIL=") || strings.Contains(head.RRule, "COUNT=") {
+		t.Errorf("expected the series to end, got %v, %v", head, err)
+	}
+
+	// an occurrence edited alone keeps its RSVPs
+	if err = activity.UpdateSeries(ctx, got[1].ID, activity.ScopeThis, activity.Activity{Title: "alone", Start: at(7, 18).Unix(), End: at(7, 20).Unix(), Visibility: activity.Members}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if edited := occurrences(t, s.ID, from, to, viewer); len(edited) != 3 || edited[1].Title != "alone" || len(edited[1].Participants) != 1 {
+		t.Errorf("expected the occurrence edited with its RSVPs, got %v", edited)
+	}
+
+	if err = activity.UpdateSeries(ctx, got[0].ID, "some", activity.Activity{}, ""); !errors.Is(err, activity.ErrInvalidScope) {
+		t.Errorf("expected %v, got %v", activity.ErrInvalidScope, err)
+	}
+
+	if err = activity.DeleteSeries(ctx, *tail); err != nil {
+		t.Fatal(err)
+	}
+	if advanced := occurrences(t, *tail, from, to, viewer); len(advanced) != 0 {
+		t.Errorf("expected the series deleted, got %v", advanced)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	public := activity.New("calendar public", start.Unix(), start.Add(2*time.Hour).Unix(), "cafe; room 2", "line one, \\ line two\n"+strings.Repeat("가", 40), activity.Etc, []string{}, false)
+	members := activity.New("calendar members", start.Unix(), start.Unix(), "cafe", "", activity.Etc, []string{}, false)
+	public.Visibility, members.Visibility = activity.Public, activity.Members
+	for _, act := range []*activity.Activity{public, members} {
+		if err := act.Create(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ics := func(v activity.Viewer) string {
+		t.Helper()
+		activities, err := activity.Calendar(ctx, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(strings.Builder)
+		if err = activities.WriteICS(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	anonymous := ics(activity.Viewer{})
+	if !strings.Contains(anonymous, "UID:"+public.ID.Hex()+"@buddy.kmu-kcc\r\n") || strings.Contains(anonymous, members.ID.Hex()) {
+		t.Errorf("expected the public activity only, got %q", anonymous)
+	}
+	if mine := ics(activity.Viewer{MemberID: "20210001"}); !strings.Contains(mine, "UID:"+members.ID.Hex()+"@buddy.kmu-kcc\r\n") {
+		t.Errorf("expected the members activity, got %q", mine)
+	}
+
+	if !strings.HasPrefix(anonymous, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(anonymous, "END:VCALENDAR\r\n") {
+		t.Errorf("unexpected calendar: %q", anonymous)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(anonymous, "\r\n"), "\r\n") {
+		if len(line) > 75 || strings.ContainsRune(line, '\n') || !utf8.ValidString(line) {
+			t.Errorf("unexpected line: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(anonymous, "\r\n ", "")
+	for _, expected := range []string{
+		"DTSTART:" + start.UTC().Format("20060102T150405Z") + "\r\n",
+		"LOCATION:cafe\\; room 2\r\n",
+		"DESCRIPTION:line one\\, \\\\ line two\\n" + strings.Repeat("가", 40) + "\r\n",
+		"CLASS:PUBLIC\r\n",
+	} {
+		if !strings.Contains(unfolded, expected) {
+			t.Errorf("expected %q in %q", expected, unfolded)
+		}
+	}
+
+	// a feed token is replaced on issuance, and invalid on revocation
+	old, err := activity.IssueFeed(ctx, "20210001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := activity.IssueFeed(ctx, "20210001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := activity.FeedMember(ctx, token); err != nil || id != "20210001" {
+		t.Errorf("expected 20210001, got %s, %v", id, err)
+	}
+	if _, err = activity.FeedMember(ctx, old); err != activity.ErrFeedNotFound {
+		t.Errorf("expected %v, got %v", activity.ErrFeedNotFound, err)
+	}
+	if err = activity.RevokeFeed(ctx, "20210001"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = activity.FeedMember(ctx, token); err != activity.ErrFeedNotFound {
+		t.Errorf("expected %v, got %v", activity.ErrFeedNotFound, err)
+	}
+}
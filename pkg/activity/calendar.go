@@ -0,0 +1,208 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+)
+
+// The range of the occurrences of the series in the calendar, around now.
+const (
+	calendarPast   = 90 * 24 * time.Hour
+	calendarFuture = 365 * 24 * time.Hour
+)
+
+// icsTime is the layout of the UTC date-times of iCalendar.
+const icsTime = "20060102T150405Z"
+
+var ErrFeedNotFound = errors.New("feed not found")
+
+// Feed represents the secret calendar feed of a member.
+// The token of the feed is never stored, only its SHA-256 hash.
+type Feed struct {
+	MemberID  string `json:"member_id" bson:"_id"`
+	Hash      string `json:"-" bson:"hash"`                       // SHA-256 hash of the token
+	CreatedAt int64  `json:"created_at,string" bson:"created_at"` // when issued - Unix timestamp
+}
+
+// icsEscaper escapes the TEXT values of iCalendar.
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Calendar returns the activities v can read, in order of the start.
+// The occurrences of the series are expanded from 90 days ago to a year later.
+func Calendar(ctx context.Context, v Viewer) (Activities, error) {
+	activities, err := store.Find(ctx, Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if activities, err = expandAll(ctx, activities, now.Add(-calendarPast).Unix(), now.Add(calendarFuture).Unix()); err != nil {
+		return nil, err
+	}
+	return activities.visibleTo(v), nil
+}
+
+// IssueFeed issues a new calendar feed token of the member of id.
+// The token issued before is no longer valid.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to this operation.
+func IssueFeed(ctx context.Context, id string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	feed := Feed{MemberID: id, Hash: feedHash(token), CreatedAt: time.Now().Unix()}
+	if err := feedStore.Upsert(ctx, feed); err != nil {
+		return "", err
+	}
+	if err := audit.Record(ctx, audit.ActivityFeed, audit.Target("member", id), nil, feed); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeFeed revokes the calendar feed token of the member of id.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to this operation.
+func RevokeFeed(ctx context.Context, id string) error {
+	if err := feedStore.Delete(ctx, id); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityFeed, audit.Target("member", id), nil, nil)
+}
+
+// FeedMember returns the ID of the member whose calendar feed token is token.
+// It returns ErrFeedNotFound if token is not valid.
+func FeedMember(ctx context.Context, token string) (string, error) {
+	feed, err := feedStore.Find(ctx, feedHash(token))
+	if err != nil {
+		return "", err
+	}
+	return feed.MemberID, nil
+}
+
+// WriteICS writes as to w in iCalendar (RFC 5545) with a VEVENT for each activity.
+// The UIDs of the events are made of the IDs of the activities,
+// so that the calendar clients update the events they already have.
+func (as Activities) WriteICS(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	line := func(name, value string) {
+		buf.WriteString(fold(name + ":" + value))
+		buf.WriteString("\r\n")
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//KMU KCC//Buddy System//KO")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "KCC 활동")
+
+	stamp := time.Now().UTC().Format(icsTime)
+	for _, a := range as {
+		line("BEGIN", "VEVENT")
+		line("UID", a.ID.Hex()+"@buddy.kmu-kcc")
+		line("DTSTAMP", stamp)
+		line("DTSTART", time.Unix(a.Start, 0).UTC().Format(icsTime))
+		if a.End > a.Start {
+			line("DTEND", time.Unix(a.End, 0).UTC().Format(icsTime))
+		}
+		line("SUMMARY", icsEscaper.Replace(a.Title))
+		if a.Place != "" {
+			line("LOCATION", icsEscaper.Replace(a.Place))
+		}
+		if a.Description != "" {
+			line("DESCRIPTION", icsEscaper.Replace(a.Description))
+		}
+		if a.level() == Public {
+			line("CLASS", "PUBLIC")
+		} else {
+			line("CLASS", "PRIVATE")
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// expandAll adds the occurrences of every series which start in [from, to) to activities,
+// unless they are stored already, and sorts them in order of the start.
+func expandAll(ctx context.Context, activities Activities, from, to int64) (Activities, error) {
+	series, err := seriesStore.Find(ctx, SeriesFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range series {
+		stored, err := s.stored(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.expand(from, to, func(start int64) {
+			if !stored[date(start)] {
+				activities = append(activities, s.occurrence(start))
+			}
+		})
+	}
+
+	sort.SliceStable(activities, func(i, j int) bool { return activities[i].Start < activities[j].Start })
+	return activities, nil
+}
+
+// fold folds line into the lines of 75 octets at most, without splitting a UTF-8 character.
+func fold(line string) string {
+	var b strings.Builder
+	for limit := 75; len(line) > limit; limit = 74 {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// feedHash returns the hash of the feed token.
+func feedHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CodeStep           = 30 // seconds for which a check-in code is displayed
+	MaxCheckInAttempts = 5  // check-in attempts of a member allowed while a window is open
+	codeDigits         = 6
+	codeModulo         = 1000000 // 10^codeDigits
+)
+
+var (
+	ErrInvalidDuration  = errors.New("invalid check-in duration")
+	ErrCheckInClosed    = errors.New("check-in closed")
+	ErrInvalidCode      = errors.New("invalid check-in code")
+	ErrAlreadyCheckedIn = errors.New("already checked in")
+)
+
+// Window represents the check-in window of an activity.
+// The check-in codes are derived from its secret like TOTP (RFC 6238),
+// so that a code shown on the screen is valid only for a short while.
+type Window struct {
+	ActivityID primitive.ObjectID `json:"activity_id" bson:"_id"`
+	Secret     []byte             `json:"-" bson:"secret"`
+	OpenedAt   int64              `json:"opened_at,string" bson:"opened_at"` // when opened - Unix timestamp
+	ClosesAt   int64              `json:"closes_at,string" bson:"closes_at"` // when closes - Unix timestamp
+}
+
+// Code represents a check-in code to display.
+type Code struct {
+	Code      string `json:"code"`
+	Payload   string `json:"payload"`           // content of the QR code for the members to scan
+	ExpiresAt int64  `json:"expires_at,string"` // when the next code is displayed - Unix timestamp
+}
+
+// Attendance represents a member who checked in to an activity.
+type Attendance struct {
+	ID         string             `json:"-" bson:"_id"` // activity ID and member ID
+	ActivityID primitive.ObjectID `json:"activity_id" bson:"activity_id"`
+	MemberID   string             `json:"member_id" bson:"member_id"`
+	CheckedAt  int64              `json:"checked_at,string" bson:"checked_at"` // when checked in - Unix timestamp
+}
+
+type Attendances []Attendance
+
+// open reports whether w accepts the check-ins at now.
+func (w Window) open(now int64) bool { return now < w.ClosesAt }
+
+// code returns the check-in code of w for the time step of step.
+func (w Window) code(step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, w.Secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%0*d", codeDigits, (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%codeModulo)
+}
+
+// verify reports whether code is the check-in code of w at now.
+// The code of the previous step is accepted too, for the members who scanned it just before it rotated.
+func (w Window) verify(code string, now int64) bool {
+	step := now / CodeStep
+	for _, s := range []int64{step, step - 1} {
+		if subtle.ConstantTimeCompare([]byte(w.code(s)), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenCheckIn opens the check-in window of the activity of id for duration.
+// A window already open is replaced, so that its codes are no longer valid.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func OpenCheckIn(ctx context.Context, id primitive.ObjectID, duration time.Duration) (*Window, error) {
+	if duration < time.Second {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDuration, duration)
+	}
+	if _, err := load(ctx, id); err != nil {
+		return nil, err
+	}
+
+	before, err := checkInStore.Window(ctx, id)
+	if err == ErrCheckInClosed {
+		before = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 20)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	window := Window{
+		ActivityID: id,
+		Secret:     secret,
+		OpenedAt:   now.Unix(),
+		ClosesAt:   now.Add(duration).Unix(),
+	}
+
+	if err = checkInStore.PutWindow(ctx, window); err != nil {
+		return nil, err
+	}
+	if err = audit.Record(ctx, audit.ActivityOpenCheckIn, target(id), before, window); err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+// CloseCheckIn closes the check-in window of the activity of id.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func CloseCheckIn(ctx context.Context, id primitive.ObjectID) error {
+	before, err := checkInStore.Window(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = checkInStore.DeleteWindow(ctx, id); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityCloseCheckIn, target(id), before, nil)
+}
+
+// CurrentCode returns the check-in code of the activity of id to display now.
+// It returns ErrCheckInClosed if the check-in window is not open.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func CurrentCode(ctx context.Context, id primitive.ObjectID) (*Code, error) {
+	window, err := checkInStore.Window(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if !window.open(now) {
+		return nil, ErrCheckInClosed
+	}
+
+	step := now / CodeStep
+	code := &Code{Code: window.code(step), ExpiresAt: (step + 1) * CodeStep}
+	if code.ExpiresAt > window.ClosesAt {
+		code.ExpiresAt = window.ClosesAt
+	}
+	code.Payload = fmt.Sprintf("buddy://activity/checkin?id=%s&code=%s", id.Hex(), code.Code)
+	return code, nil
+}
+
+// CheckIn records the attendance of v to the activity of id with code.
+// It returns ErrNotFound if v cannot read the activity.
+// A member may attempt up to MaxCheckInAttempts times while the window is open,
+// and the attempts beyond it fail with ErrInvalidCode like the wrong codes, whatever the code is.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can check in by themselves.
+func CheckIn(ctx context.Context, id primitive.ObjectID, code string, v Viewer) (*Attendance, error) {
+	a, err := load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !a.VisibleTo(v) {
+		return nil, ErrNotFound
+	}
+
+	window, err := checkInStore.Window(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if !window.open(now) {
+		return nil, ErrCheckInClosed
+	}
+	attempts, err := checkInStore.Attempt(ctx, id, v.MemberID)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > MaxCheckInAttempts || !window.verify(code, now) {
+		return nil, ErrInvalidCode
+	}
+
+	attendance := Attendance{
+		ID:         id.Hex() + "/" + v.MemberID,
+		ActivityID: id,
+		MemberID:   v.MemberID,
+		CheckedAt:  now,
+	}
+	if err = checkInStore.InsertAttendance(ctx, attendance); err != nil {
+		return nil, err
+	}
+	if err = audit.Record(ctx, audit.ActivityCheckIn, target(id), nil, attendance); err != nil {
+		return nil, err
+	}
+	return &attendance, nil
+}
+
+// AttendanceOf returns the attendances of the activity of id in check-in order.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func AttendanceOf(ctx context.Context, id primitive.ObjectID) (Attendances, error) {
+	if _, err := load(ctx, id); err != nil {
+		return nil, err
+	}
+	return checkInStore.FindAttendances(ctx, AttendanceFilter{ActivityID: id})
+}
+
+// MemberAttendance returns the attendances of the member of id in check-in order.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to their own attendances,
+//	and the club managers can access to any attendance.
+func MemberAttendance(ctx context.Context, id string) (Attendances, error) {
+	return checkInStore.FindAttendances(ctx, AttendanceFilter{MemberID: id})
+}
@@ -38,3 +38,31 @@ func NewFile(filename string) File { return File(strings.TrimSpace(filename)) }
 
 // Delete deletes f.
 func (f File) Delete() error { return os.Remove(f.Absolute()) }
+
+// stashed returns the path of f while it is being deleted.
+func (f File) stashed() string { return f.Absolute() + ".deleting" }
+
+// stash moves f aside to be deleted.
+// A missing file is not an error, as there is nothing to restore.
+func (f File) stash() error {
+	if err := os.Rename(f.Absolute(), f.stashed()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// restore moves the stashed f back.
+func (f File) restore() error {
+	if err := os.Rename(f.stashed(), f.Absolute()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// purge deletes the stashed f.
+func (f File) purge() error {
+	if err := os.Remove(f.stashed()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is an ActivityStore which keeps the activities in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	activities Activities
+}
+
+// NewMemoryStore returns a new empty ActivityStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// Get implements ActivityStore.
+func (s *MemoryStore) Get(ctx context.Context, id primitive.ObjectID) (*Activity, error) {
+	defer s.rlock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		activity := s.activities[idx].clone()
+		return &activity, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Find implements ActivityStore.
+func (s *MemoryStore) Find(ctx context.Context, filter Filter) (activities Activities, err error) {
+	defer s.rlock(ctx)()
+
+	for _, activity := range s.activities {
+		ok, err := filter.Match(activity)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			activities = append(activities, activity.clone())
+		}
+	}
+	return
+}
+
+// Insert implements ActivityStore.
+func (s *MemoryStore) Insert(ctx context.Context, a Activity) error {
+	defer s.lock(ctx)()
+
+	if s.index(a.ID) != -1 {
+		return errDuplicated
+	}
+	s.activities = append(s.activities, a.clone())
+	return nil
+}
+
+// Update implements ActivityStore.
+func (s *MemoryStore) Update(ctx context.Context, a Activity) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(a.ID); idx != -1 {
+		old := s.activities[idx]
+		s.activities[idx] = a.clone()
+		s.activities[idx].Participants, s.activities[idx].Waitlist, s.activities[idx].Files = old.Participants, old.Waitlist, old.Files
+	}
+	return nil
+}
+
+// Delete implements ActivityStore.
+func (s *MemoryStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		s.activities = append(s.activities[:idx], s.activities[idx+1:]...)
+	}
+	return nil
+}
+
+// PushFile implements ActivityStore.
+func (s *MemoryStore) PushFile(ctx context.Context, id primitive.ObjectID, file File) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		s.activities[idx].Files = append(s.activities[idx].Files, file)
+	}
+	return nil
+}
+
+// PullFile implements ActivityStore.
+func (s *MemoryStore) PullFile(ctx context.Context, id primitive.ObjectID, file File) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		files := Files{}
+		for _, f := range s.activities[idx].Files {
+			if f != file {
+				files = append(files, f)
+			}
+		}
+		s.activities[idx].Files = files
+	}
+	return nil
+}
+
+// SwapAttendees implements ActivityStore.
+func (s *MemoryStore) SwapAttendees(ctx context.Context, old, a Activity) error {
+	defer s.lock(ctx)()
+
+	idx := s.index(a.ID)
+	if idx == -1 {
+		return ErrNotFound
+	}
+	if !equal(s.activities[idx].Participants, old.Participants) || !equal(s.activities[idx].Waitlist, old.Waitlist) {
+		return errConflict
+	}
+	a = a.clone()
+	s.activities[idx].Participants, s.activities[idx].Waitlist = a.Participants, a.Waitlist
+	return nil
+}
+
+// equal reports whether x and y have the same strings in the same order.
+func equal(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for idx := range x {
+		if x[idx] != y[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.activities == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.activities == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// index returns the index of the activity of id, or -1 if not present.
+func (s *MemoryStore) index(id primitive.ObjectID) int {
+	for idx, activity := range s.activities {
+		if activity.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+// clone returns a deep copy of a.
+func (a Activity) clone() Activity {
+	if a.Participants != nil {
+		a.Participants = append(make([]string, 0, len(a.Participants)), a.Participants...)
+	}
+	if a.Waitlist != nil {
+		a.Waitlist = append(make([]string, 0, len(a.Waitlist)), a.Waitlist...)
+	}
+	if a.Files != nil {
+		a.Files = append(make(Files, 0, len(a.Files)), a.Files...)
+	}
+	if a.SeriesID != nil {
+		id := *a.SeriesID
+		a.SeriesID = &id
+	}
+	return a
+}
+
+// MemorySeriesStore is a SeriesStore which keeps the series in memory.
+// It is safe for concurrent use.
+type MemorySeriesStore struct {
+	mu     sync.RWMutex
+	series []Series
+}
+
+// NewMemorySeriesStore returns a new empty SeriesStore.
+func NewMemorySeriesStore() *MemorySeriesStore { return &MemorySeriesStore{} }
+
+// Get implements SeriesStore.
+func (s *MemorySeriesStore) Get(ctx context.Context, id primitive.ObjectID) (*Series, error) {
+	defer s.rlock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		series := s.series[idx].clone()
+		return &series, nil
+	}
+	return nil, ErrSeriesNotFound
+}
+
+// Find implements SeriesStore.
+func (s *MemorySeriesStore) Find(ctx context.Context, filter SeriesFilter) ([]Series, error) {
+	defer s.rlock(ctx)()
+
+	series := []Series{}
+	for _, elem := range s.series {
+		if filter.Match(elem) {
+			series = append(series, elem.clone())
+		}
+	}
+	return series, nil
+}
+
+// Insert implements SeriesStore.
+func (s *MemorySeriesStore) Insert(ctx context.Context, series Series) error {
+	defer s.lock(ctx)()
+
+	s.series = append(s.series, series.clone())
+	return nil
+}
+
+// Update implements SeriesStore.
+func (s *MemorySeriesStore) Update(ctx context.Context, series Series) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(series.ID); idx != -1 {
+		s.series[idx] = series.clone()
+	}
+	return nil
+}
+
+// Delete implements SeriesStore.
+func (s *MemorySeriesStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(id); idx != -1 {
+		s.series = append(s.series[:idx], s.series[idx+1:]...)
+	}
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemorySeriesStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.series == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemorySeriesStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.series == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// index returns the index of the series of id, or -1 if not present.
+func (s *MemorySeriesStore) index(id primitive.ObjectID) int {
+	for idx, series := range s.series {
+		if series.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+// clone returns a deep copy of s.
+func (s Series) clone() Series {
+	s.Template = s.Template.clone()
+	if s.ExDates != nil {
+		s.ExDates = append(make([]int64, 0, len(s.ExDates)), s.ExDates...)
+	}
+	return s
+}
+
+// txKey is the context key of the running MemoryTransactor.
+type txKey struct{}
+
+// MemoryTransactor is a Transactor over a MemoryStore and a MemorySeriesStore.
+// A transaction locks the stores for writing until it ends,
+// and restores their states if it fails.
+type MemoryTransactor struct {
+	activities *MemoryStore
+	series     *MemorySeriesStore
+}
+
+// NewMemoryTransactor returns a new Transactor over s and ss.
+func NewMemoryTransactor(s *MemoryStore, ss *MemorySeriesStore) *MemoryTransactor {
+	return &MemoryTransactor{activities: s, series: ss}
+}
+
+// Transaction implements Transactor.
+func (t *MemoryTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx == t {
+		return fn(ctx)
+	}
+
+	t.activities.mu.Lock()
+	defer t.activities.mu.Unlock()
+	t.series.mu.Lock()
+	defer t.series.mu.Unlock()
+
+	activities := make(Activities, len(t.activities.activities))
+	for idx, a := range t.activities.activities {
+		activities[idx] = a.clone()
+	}
+	series := make([]Series, len(t.series.series))
+	for idx, elem := range t.series.series {
+		series[idx] = elem.clone()
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		t.activities.activities, t.series.series = activities, series
+		return err
+	}
+	return nil
+}
+
+// MemoryCheckInStore is a CheckInStore which keeps the windows and the attendances in memory.
+// It is safe for concurrent use.
+type MemoryCheckInStore struct {
+	mu          sync.RWMutex
+	windows     map[primitive.ObjectID]Window
+	attempts    map[primitive.ObjectID]map[string]int
+	attendances Attendances
+}
+
+// NewMemoryCheckInStore returns a new empty CheckInStore.
+func NewMemoryCheckInStore() *MemoryCheckInStore {
+	return &MemoryCheckInStore{windows: make(map[primitive.ObjectID]Window), attempts: make(map[primitive.ObjectID]map[string]int)}
+}
+
+// Window implements CheckInStore.
+func (s *MemoryCheckInStore) Window(_ context.Context, id primitive.ObjectID) (*Window, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	window, ok := s.windows[id]
+	if !ok {
+		return nil, ErrCheckInClosed
+	}
+	window.Secret = append([]byte{}, window.Secret...)
+	return &window, nil
+}
+
+// PutWindow implements CheckInStore.
+func (s *MemoryCheckInStore) PutWindow(_ context.Context, w Window) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Secret = append([]byte{}, w.Secret...)
+	s.windows[w.ActivityID] = w
+	delete(s.attempts, w.ActivityID)
+	return nil
+}
+
+// DeleteWindow implements CheckInStore.
+func (s *MemoryCheckInStore) DeleteWindow(_ context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.windows, id)
+	delete(s.attempts, id)
+	return nil
+}
+
+// Attempt implements CheckInStore.
+func (s *MemoryCheckInStore) Attempt(_ context.Context, id primitive.ObjectID, memberID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attempts[id] == nil {
+		s.attempts[id] = make(map[string]int)
+	}
+	s.attempts[id][memberID]++
+	return s.attempts[id][memberID], nil
+}
+
+// FindAttendances implements CheckInStore.
+func (s *MemoryCheckInStore) FindAttendances(_ context.Context, filter AttendanceFilter) (Attendances, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attendances := Attendances{}
+	for _, attendance := range s.attendances {
+		if filter.Match(attendance) {
+			attendances = append(attendances, attendance)
+		}
+	}
+	return attendances, nil
+}
+
+// InsertAttendance implements CheckInStore.
+func (s *MemoryCheckInStore) InsertAttendance(_ context.Context, a Attendance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attendance := range s.attendances {
+		if attendance.ID == a.ID {
+			return ErrAlreadyCheckedIn
+		}
+	}
+	s.attendances = append(s.attendances, a)
+	return nil
+}
+
+// MemoryFeedStore is a FeedStore which keeps the feeds in memory.
+// It is safe for concurrent use.
+type MemoryFeedStore struct {
+	mu    sync.RWMutex
+	feeds map[string]Feed
+}
+
+// NewMemoryFeedStore returns a new empty FeedStore.
+func NewMemoryFeedStore() *MemoryFeedStore {
+	return &MemoryFeedStore{feeds: make(map[string]Feed)}
+}
+
+// Find implements FeedStore.
+func (s *MemoryFeedStore) Find(_ context.Context, hash string) (*Feed, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, feed := range s.feeds {
+		if feed.Hash == hash {
+			return &feed, nil
+		}
+	}
+	return nil, ErrFeedNotFound
+}
+
+// Upsert implements FeedStore.
+func (s *MemoryFeedStore) Upsert(_ context.Context, f Feed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds[f.MemberID] = f
+	return nil
+}
+
+// Delete implements FeedStore.
+func (s *MemoryFeedStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.feeds, id)
+	return nil
+}
@@ -0,0 +1,498 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is an ActivityStore backed by MongoDB.
+type MongoStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoStore returns a new ActivityStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoStore(db *mongo.Database, timeout time.Duration) *MongoStore {
+	return &MongoStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the activity collection within the operation timeout.
+func (s *MongoStore) do(ctx context.Context, fn func(ctx context.Context, collection *mongo.Collection) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db.Collection("activities"))
+}
+
+// Get implements ActivityStore.
+func (s *MongoStore) Get(ctx context.Context, id primitive.ObjectID) (activity *Activity, err error) {
+	err = s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		activity = new(Activity)
+		err := collection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}).Decode(activity)
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Find implements ActivityStore.
+func (s *MongoStore) Find(ctx context.Context, filter Filter) (activities Activities, err error) {
+	err = s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		cur, err := collection.Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		activity := new(Activity)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(activity); err != nil {
+				return err
+			}
+			activities = append(activities, *activity)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements ActivityStore.
+func (s *MongoStore) Insert(ctx context.Context, a Activity) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.InsertOne(ctx, a)
+		if mongo.IsDuplicateKeyError(err) {
+			return errDuplicated
+		}
+		return err
+	})
+}
+
+// Update implements ActivityStore.
+func (s *MongoStore) Update(ctx context.Context, a Activity) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		raw, err := bson.Marshal(a)
+		if err != nil {
+			return err
+		}
+		doc := bson.M{}
+		if err = bson.Unmarshal(raw, &doc); err != nil {
+			return err
+		}
+		for _, key := range []string{"_id", "participants", "waitlist", "files"} {
+			delete(doc, key)
+		}
+
+		_, err = collection.UpdateByID(ctx, a.ID, bson.M{"$set": doc})
+		return err
+	})
+}
+
+// Delete implements ActivityStore.
+func (s *MongoStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: id}})
+		return err
+	})
+}
+
+// PushFile implements ActivityStore.
+func (s *MongoStore) PushFile(ctx context.Context, id primitive.ObjectID, file File) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.UpdateByID(ctx, id, bson.D{bson.E{Key: "$push", Value: bson.D{bson.E{Key: "files", Value: file}}}})
+		return err
+	})
+}
+
+// PullFile implements ActivityStore.
+func (s *MongoStore) PullFile(ctx context.Context, id primitive.ObjectID, file File) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.UpdateByID(ctx, id, bson.D{bson.E{Key: "$pull", Value: bson.D{bson.E{Key: "files", Value: bson.D{bson.E{Key: "$in", Value: bson.A{file}}}}}}})
+		return err
+	})
+}
+
+// SwapAttendees implements ActivityStore.
+// The participants and the waitlist of old are matched as a whole, so that a missing list matches nil.
+func (s *MongoStore) SwapAttendees(ctx context.Context, old, a Activity) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		filter := bson.D{
+			bson.E{Key: "_id", Value: a.ID},
+			bson.E{Key: "participants", Value: old.Participants},
+			bson.E{Key: "waitlist", Value: old.Waitlist},
+		}
+		update := bson.D{bson.E{Key: "$set", Value: bson.D{
+			bson.E{Key: "participants", Value: a.Participants},
+			bson.E{Key: "waitlist", Value: a.Waitlist},
+		}}}
+
+		res, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errConflict
+		}
+		return nil
+	})
+}
+
+// MongoSeriesStore is a SeriesStore backed by MongoDB.
+type MongoSeriesStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoSeriesStore returns a new SeriesStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoSeriesStore(db *mongo.Database, timeout time.Duration) *MongoSeriesStore {
+	return &MongoSeriesStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the series collection within the operation timeout.
+func (s *MongoSeriesStore) do(ctx context.Context, fn func(ctx context.Context, collection *mongo.Collection) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db.Collection("series"))
+}
+
+// Get implements SeriesStore.
+func (s *MongoSeriesStore) Get(ctx context.Context, id primitive.ObjectID) (series *Series, err error) {
+	err = s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		series = new(Series)
+		err := collection.FindOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}).Decode(series)
+		if err == mongo.ErrNoDocuments {
+			return ErrSeriesNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Find implements SeriesStore.
+func (s *MongoSeriesStore) Find(ctx context.Context, filter SeriesFilter) (series []Series, err error) {
+	err = s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		query := bson.D{}
+		if filter.Key != "" {
+			query = append(query, bson.E{Key: "key", Value: filter.Key})
+		}
+
+		cur, err := collection.Find(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		series = []Series{}
+		elem := new(Series)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(elem); err != nil {
+				return err
+			}
+			series = append(series, *elem)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements SeriesStore.
+func (s *MongoSeriesStore) Insert(ctx context.Context, series Series) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.InsertOne(ctx, series)
+		return err
+	})
+}
+
+// Update implements SeriesStore.
+func (s *MongoSeriesStore) Update(ctx context.Context, series Series) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: series.ID}}, series)
+		return err
+	})
+}
+
+// Delete implements SeriesStore.
+func (s *MongoSeriesStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: id}})
+		return err
+	})
+}
+
+// MongoTransactor is a Transactor backed by the multi-document transactions of MongoDB,
+// which require a replica set or a sharded cluster.
+type MongoTransactor struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoTransactor returns a new Transactor on db.
+// Each transaction is bounded by timeout, unless it is zero.
+func NewMongoTransactor(db *mongo.Database, timeout time.Duration) *MongoTransactor {
+	return &MongoTransactor{db: db, timeout: timeout}
+}
+
+// Transaction implements Transactor.
+func (t *MongoTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	sess, err := t.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// MongoFeedStore is a FeedStore backed by MongoDB.
+type MongoFeedStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoFeedStore returns a new FeedStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoFeedStore(db *mongo.Database, timeout time.Duration) *MongoFeedStore {
+	return &MongoFeedStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the feed collection within the operation timeout.
+func (s *MongoFeedStore) do(ctx context.Context, fn func(ctx context.Context, collection *mongo.Collection) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db.Collection("feeds"))
+}
+
+// Find implements FeedStore.
+func (s *MongoFeedStore) Find(ctx context.Context, hash string) (feed *Feed, err error) {
+	err = s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		feed = new(Feed)
+		err := collection.FindOne(ctx, bson.D{bson.E{Key: "hash", Value: hash}}).Decode(feed)
+		if err == mongo.ErrNoDocuments {
+			return ErrFeedNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Upsert implements FeedStore.
+func (s *MongoFeedStore) Upsert(ctx context.Context, f Feed) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: f.MemberID}}, f, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+// Delete implements FeedStore.
+func (s *MongoFeedStore) Delete(ctx context.Context, id string) error {
+	return s.do(ctx, func(ctx context.Context, collection *mongo.Collection) error {
+		_, err := collection.DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: id}})
+		return err
+	})
+}
+
+// MongoCheckInStore is a CheckInStore backed by MongoDB.
+type MongoCheckInStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoCheckInStore returns a new CheckInStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoCheckInStore(db *mongo.Database, timeout time.Duration) *MongoCheckInStore {
+	return &MongoCheckInStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the club database within the operation timeout.
+func (s *MongoCheckInStore) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db)
+}
+
+// Window implements CheckInStore.
+func (s *MongoCheckInStore) Window(ctx context.Context, id primitive.ObjectID) (window *Window, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		window = new(Window)
+		err := db.Collection("checkin_windows").FindOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}).Decode(window)
+		if err == mongo.ErrNoDocuments {
+			return ErrCheckInClosed
+		}
+		return err
+	})
+	return
+}
+
+// PutWindow implements CheckInStore.
+func (s *MongoCheckInStore) PutWindow(ctx context.Context, w Window) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("checkin_windows").ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: w.ActivityID}}, w, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection("checkin_attempts").DeleteMany(ctx, bson.D{bson.E{Key: "activity_id", Value: w.ActivityID}})
+		return err
+	})
+}
+
+// DeleteWindow implements CheckInStore.
+func (s *MongoCheckInStore) DeleteWindow(ctx context.Context, id primitive.ObjectID) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("checkin_windows").DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: id}})
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection("checkin_attempts").DeleteMany(ctx, bson.D{bson.E{Key: "activity_id", Value: id}})
+		return err
+	})
+}
+
+// Attempt implements CheckInStore.
+// The attempts are counted atomically, so concurrent attempts of a member are all counted.
+func (s *MongoCheckInStore) Attempt(ctx context.Context, id primitive.ObjectID, memberID string) (attempts int, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		counter := new(struct {
+			Count int `bson:"count"`
+		})
+		err := db.Collection("checkin_attempts").FindOneAndUpdate(ctx,
+			bson.D{bson.E{Key: "_id", Value: id.Hex() + "/" + memberID}},
+			bson.D{
+				bson.E{Key: "$inc", Value: bson.D{bson.E{Key: "count", Value: 1}}},
+				bson.E{Key: "$setOnInsert", Value: bson.D{bson.E{Key: "activity_id", Value: id}, bson.E{Key: "member_id", Value: memberID}}},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(counter)
+		attempts = counter.Count
+		return err
+	})
+	return
+}
+
+// FindAttendances implements CheckInStore.
+func (s *MongoCheckInStore) FindAttendances(ctx context.Context, filter AttendanceFilter) (attendances Attendances, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("attendances").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		attendances = Attendances{}
+		attendance := new(Attendance)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(attendance); err != nil {
+				return err
+			}
+			attendances = append(attendances, *attendance)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// InsertAttendance implements CheckInStore.
+// The attendances are unique by their IDs, so concurrent check-ins of a member are detected.
+func (s *MongoCheckInStore) InsertAttendance(ctx context.Context, a Attendance) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("attendances").InsertOne(ctx, a)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyCheckedIn
+		}
+		return err
+	})
+}
+
+// document returns the MongoDB query document of f.
+func (f AttendanceFilter) document() bson.D {
+	filter := bson.D{}
+
+	if !f.ActivityID.IsZero() {
+		filter = append(filter, bson.E{Key: "activity_id", Value: f.ActivityID})
+	}
+	if f.MemberID != "" {
+		filter = append(filter, bson.E{Key: "member_id", Value: f.MemberID})
+	}
+	return filter
+}
+
+// document returns the MongoDB query document of f.
+func (f Filter) document() bson.D {
+	filter := bson.D{}
+
+	if f.Type != nil {
+		filter = append(filter, bson.E{Key: "type", Value: *f.Type})
+	}
+	if f.SeriesID != nil {
+		filter = append(filter, bson.E{Key: "series_id", Value: *f.SeriesID})
+	}
+	if f.Since != 0 || f.Until != 0 {
+		start := bson.D{}
+		if f.Since != 0 {
+			start = append(start, bson.E{Key: "$gte", Value: f.Since})
+		}
+		if f.Until != 0 {
+			start = append(start, bson.E{Key: "$lt", Value: f.Until})
+		}
+		filter = append(filter, bson.E{Key: "start", Value: start})
+	}
+	if f.File != "" {
+		filter = append(filter, bson.E{Key: "files", Value: f.File})
+	}
+	if f.Query != "" {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{bson.E{Key: "title", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+			bson.D{bson.E{Key: "place", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+			bson.D{bson.E{Key: "description", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+		}})
+	}
+	return filter
+}
@@ -0,0 +1,377 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The frequencies of the recurrence rules.
+const (
+	daily   = "DAILY"
+	weekly  = "WEEKLY"
+	monthly = "MONTHLY"
+	yearly  = "YEARLY"
+)
+
+// maxEmptyPeriods is the number of the consecutive periods without an occurrence,
+// after which a rule is regarded as having no more occurrences, like BYMONTH=2;BYMONTHDAY=30.
+const maxEmptyPeriods = 1000
+
+var ErrInvalidRRule = errors.New("invalid rrule")
+
+// kst is the time zone the occurrences of the recurrence rules are computed in.
+var kst = time.FixedZone("KST", 9*60*60)
+
+// weekdays are the RFC 5545 codes of the weekdays.
+var weekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// rrule represents a recurrence rule of RFC 5545.
+// The rules repeating more often than daily, and the BYSETPOS, BYWEEKNO, BYYEARDAY, BYHOUR,
+// BYMINUTE and BYSECOND parts are not supported, so that a rule has at most one occurrence a day.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int   // zero for unbounded
+	until      int64 // inclusive bound of the occurrences - Unix timestamp (zero for unbounded)
+	byMonth    []int
+	byMonthDay []int
+	byDay      []weekday
+	weekStart  time.Weekday
+}
+
+// weekday represents an element of BYDAY, like MO or -1FR.
+type weekday struct {
+	n   int // nth weekday of the month or the year, counted from the end if negative (zero for every)
+	day time.Weekday
+}
+
+// parseRRule parses str, with or without the "RRULE:" prefix.
+func parseRRule(str string) (*rrule, error) {
+	r := &rrule{interval: 1, weekStart: time.Monday}
+
+	str = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(str)), "RRULE:")
+	for _, part := range strings.Split(str, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRRule, part)
+		}
+
+		var err error
+		switch key, value := kv[0], kv[1]; key {
+		case "FREQ":
+			switch value {
+			case daily, weekly, monthly, yearly:
+				r.freq = value
+			default:
+				err = errors.New("unsupported frequency")
+			}
+		case "INTERVAL":
+			r.interval, err = number(value, 1, 1<<16)
+		case "COUNT":
+			r.count, err = number(value, 1, 1<<16)
+		case "UNTIL":
+			r.until, err = parseUntil(value)
+		case "BYMONTH":
+			r.byMonth, err = numbers(value, 1, 12)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = numbers(value, -31, 31)
+		case "BYDAY":
+			for _, elem := range strings.Split(value, ",") {
+				var wd weekday
+				if wd, err = parseWeekday(elem); err != nil {
+					break
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "WKST":
+			var wd weekday
+			if wd, err = parseWeekday(value); err == nil && wd.n != 0 {
+				err = errors.New("ordinal week start")
+			}
+			r.weekStart = wd.day
+		default:
+			err = errors.New("unsupported part")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidRRule, part, err)
+		}
+	}
+
+	switch {
+	case r.freq == "":
+		return nil, fmt.Errorf("%w: no FREQ", ErrInvalidRRule)
+	case r.count != 0 && r.until != 0:
+		return nil, fmt.Errorf("%w: both COUNT and UNTIL", ErrInvalidRRule)
+	case r.freq == weekly && len(r.byMonthDay) != 0:
+		return nil, fmt.Errorf("%w: BYMONTHDAY with WEEKLY", ErrInvalidRRule)
+	}
+	for _, wd := range r.byDay {
+		if wd.n != 0 && r.freq != monthly && r.freq != yearly {
+			return nil, fmt.Errorf("%w: ordinal BYDAY with %s", ErrInvalidRRule, r.freq)
+		}
+	}
+	return r, nil
+}
+
+// String returns r in the RFC 5545 format, without the "RRULE:" prefix.
+func (r rrule) String() string {
+	parts := []string{"FREQ=" + r.freq}
+
+	if r.until != 0 {
+		parts = append(parts, "UNTIL="+time.Unix(r.until, 0).UTC().Format("20060102T150405Z"))
+	}
+	if r.count != 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.count))
+	}
+	if r.interval != 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.interval))
+	}
+	if len(r.byMonth) != 0 {
+		parts = append(parts, "BYMONTH="+join(r.byMonth))
+	}
+	if len(r.byMonthDay) != 0 {
+		parts = append(parts, "BYMONTHDAY="+join(r.byMonthDay))
+	}
+	if len(r.byDay) != 0 {
+		days := make([]string, len(r.byDay))
+		for idx, wd := range r.byDay {
+			days[idx] = weekdays[wd.day]
+			if wd.n != 0 {
+				days[idx] = strconv.Itoa(wd.n) + days[idx]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.weekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdays[r.weekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// between calls fn with the starts of the occurrences of r from dtstart, which are in [from, to), in order.
+// The occurrences are at the time of day of dtstart in KST.
+func (r rrule) between(dtstart, from, to int64, fn func(start int64)) {
+	first := time.Unix(dtstart, 0).In(kst)
+	clock := first.Sub(midnight(first))
+
+	count, empty := 0, 0
+	for period := r.period(first); empty < maxEmptyPeriods; period = r.next(period) {
+		days := r.days(period, first)
+		if len(days) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		for _, d := range days {
+			start := d.Add(clock).Unix()
+			if start < dtstart {
+				continue
+			}
+			if start >= to || (r.until != 0 && start > r.until) {
+				return
+			}
+			if count++; r.count != 0 && count > r.count {
+				return
+			}
+			if start >= from {
+				fn(start)
+			}
+		}
+	}
+}
+
+// period returns the start of the period of r which t is in.
+func (r rrule) period(t time.Time) time.Time {
+	t = midnight(t)
+	switch r.freq {
+	case weekly:
+		return t.AddDate(0, 0, -((int(t.Weekday()) - int(r.weekStart) + 7) % 7))
+	case monthly:
+		return t.AddDate(0, 0, 1-t.Day())
+	case yearly:
+		return t.AddDate(0, 0, 1-t.YearDay())
+	default:
+		return t
+	}
+}
+
+// next returns the start of the period of r, interval periods after period.
+func (r rrule) next(period time.Time) time.Time {
+	switch r.freq {
+	case weekly:
+		return period.AddDate(0, 0, 7*r.interval)
+	case monthly:
+		return period.AddDate(0, r.interval, 0)
+	case yearly:
+		return period.AddDate(r.interval, 0, 0)
+	default:
+		return period.AddDate(0, 0, r.interval)
+	}
+}
+
+// days returns the dates of the period of r starting at period, which r occurs on in order.
+// first is the first occurrence, which decides the days of the rule without BYMONTHDAY nor BYDAY.
+func (r rrule) days(period, first time.Time) []time.Time {
+	end := rrule{freq: r.freq, interval: 1}.next(period)
+
+	days := []time.Time{}
+	for d := period; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if r.match(d, first) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// match reports whether r occurs on the date d.
+func (r rrule) match(d, first time.Time) bool {
+	if len(r.byMonth) != 0 && !containsInt(r.byMonth, int(d.Month())) {
+		return false
+	}
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		switch r.freq {
+		case weekly:
+			return d.Weekday() == first.Weekday()
+		case monthly:
+			return d.Day() == first.Day()
+		case yearly:
+			return d.Day() == first.Day() && (len(r.byMonth) != 0 || d.Month() == first.Month())
+		}
+		return true
+	}
+
+	if len(r.byMonthDay) != 0 {
+		last := daysIn(d.Year(), d.Month())
+		found := false
+		for _, md := range r.byMonthDay {
+			found = found || md == d.Day() || md == d.Day()-last-1
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.byDay) != 0 {
+		// the ordinals count in the year only for YEARLY without BYMONTH, and in the month otherwise.
+		nth, last := (d.Day()-1)/7+1, (daysIn(d.Year(), d.Month())-d.Day())/7+1
+		if r.freq == yearly && len(r.byMonth) == 0 {
+			nth, last = (d.YearDay()-1)/7+1, (time.Date(d.Year(), 12, 31, 0, 0, 0, 0, kst).YearDay()-d.YearDay())/7+1
+		}
+
+		found := false
+		for _, wd := range r.byDay {
+			found = found || (wd.day == d.Weekday() && (wd.n == 0 || wd.n == nth || wd.n == -last))
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUntil parses the UNTIL of a rule, which is a date or a date-time in UTC or in KST.
+// A date bounds the occurrences on its end.
+func parseUntil(value string) (int64, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, kst); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.ParseInLocation("20060102", value, kst)
+	if err != nil {
+		return 0, errors.New("malformed date")
+	}
+	return t.AddDate(0, 0, 1).Unix() - 1, nil
+}
+
+// parseWeekday parses an element of BYDAY, like MO or -1FR.
+func parseWeekday(value string) (wd weekday, err error) {
+	if len(value) < 2 {
+		return wd, errors.New("malformed weekday")
+	}
+
+	code := value[len(value)-2:]
+	for day, elem := range weekdays {
+		if elem == code {
+			wd.day = time.Weekday(day)
+			if value = value[:len(value)-2]; value != "" {
+				wd.n, err = number(value, -53, 53)
+			}
+			return
+		}
+	}
+	return wd, errors.New("malformed weekday")
+}
+
+// number parses value as a non-zero integer in [min, max].
+func number(value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n == 0 || n < min || n > max {
+		return 0, fmt.Errorf("%s out of range", value)
+	}
+	return n, nil
+}
+
+// numbers parses value as a comma-separated list of non-zero integers in [min, max].
+func numbers(value string, min, max int) ([]int, error) {
+	ns := []int{}
+	for _, elem := range strings.Split(value, ",") {
+		n, err := number(elem, min, max)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// join returns ns separated by commas.
+func join(ns []int) string {
+	strs := make([]string, len(ns))
+	for idx, n := range ns {
+		strs[idx] = strconv.Itoa(n)
+	}
+	return strings.Join(strs, ",")
+}
+
+func containsInt(ns []int, n int) bool {
+	for _, elem := range ns {
+		if elem == n {
+			return true
+		}
+	}
+	return false
+}
+
+// daysIn returns the number of the days of month of year.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, kst).Day()
+}
+
+// midnight returns the start of the date of t in KST.
+func midnight(t time.Time) time.Time {
+	year, month, day := t.In(kst).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, kst)
+}
+
+// date returns the date of the Unix timestamp t in KST, as the number of the days since the epoch.
+func date(t int64) int64 { return (t + 9*60*60) / (24 * 60 * 60) }
@@ -0,0 +1,236 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The RSVP statuses of the members.
+const (
+	Going      = "going"
+	Waitlisted = "waitlisted"
+)
+
+var (
+	ErrInvalidCapacity = errors.New("invalid capacity")
+	ErrRSVPClosed      = errors.New("rsvp closed")
+	ErrAlreadyRSVPed   = errors.New("already rsvped")
+	ErrNotRSVPed       = errors.New("not rsvped")
+)
+
+// Attendee represents a member who RSVPed to an activity.
+type Attendee struct {
+	MemberID   string `json:"member_id"`
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email"`
+	Status     string `json:"status"`
+}
+
+type Attendees []Attendee
+
+// deadline returns when the RSVP to a closes, or zero if it never closes.
+func (a Activity) deadline() int64 {
+	if a.RSVPDeadline != 0 {
+		return a.RSVPDeadline
+	}
+	return a.Start
+}
+
+// status returns the RSVP status of the member of id to a, or empty if the member did not RSVP.
+func (a Activity) status(id string) string {
+	for _, participant := range a.Participants {
+		if participant == id {
+			return Going
+		}
+	}
+	for _, waiting := range a.Waitlist {
+		if waiting == id {
+			return Waitlisted
+		}
+	}
+	return ""
+}
+
+// full reports whether a has no room for another participant.
+func (a Activity) full() bool { return a.Capacity != 0 && len(a.Participants) >= a.Capacity }
+
+// promote moves the members on the waitlist of a to its participants in order, while it has room for them.
+func (a *Activity) promote() {
+	for len(a.Waitlist) > 0 && !a.full() {
+		a.Participants = append(a.Participants, a.Waitlist[0])
+		a.Waitlist = a.Waitlist[1:]
+	}
+}
+
+// fit moves the participants of a over its capacity back to the front of its waitlist in order,
+// or promotes the members on the waitlist of a into the room it has.
+func (a *Activity) fit() {
+	if a.Capacity != 0 && len(a.Participants) > a.Capacity {
+		a.Waitlist = append(append([]string{}, a.Participants[a.Capacity:]...), a.Waitlist...)
+		a.Participants = append([]string{}, a.Participants[:a.Capacity]...)
+	}
+	a.promote()
+}
+
+// RSVP registers v to the activity of id.
+// v joins the waitlist if the activity is full, and it returns the status v has got.
+// It returns ErrNotFound if v cannot read the activity.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can RSVP to the activities by themselves.
+func RSVP(ctx context.Context, id primitive.ObjectID, v Viewer) (status string, err error) {
+	err = attend(ctx, id, audit.ActivityRSVP, func(a *Activity) error {
+		if !a.VisibleTo(v) {
+			return ErrNotFound
+		}
+		if deadline := a.deadline(); deadline != 0 && time.Now().Unix() >= deadline {
+			return ErrRSVPClosed
+		}
+		if a.status(v.MemberID) != "" {
+			return ErrAlreadyRSVPed
+		}
+
+		if a.full() {
+			a.Waitlist, status = append(a.Waitlist, v.MemberID), Waitlisted
+		} else {
+			a.Participants, status = append(a.Participants, v.MemberID), Going
+		}
+		return nil
+	})
+	return
+}
+
+// Cancel cancels the RSVP of the member of memberID to the activity of id.
+// The first member on the waitlist takes the place of a participant cancelling.
+// The RSVP can be cancelled until the activity starts, even after the deadline.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can cancel their own RSVPs.
+func Cancel(ctx context.Context, id primitive.ObjectID, memberID string) error {
+	return attend(ctx, id, audit.ActivityCancel, func(a *Activity) error {
+		if a.status(memberID) == "" {
+			return ErrNotRSVPed
+		}
+		if a.Start != 0 && time.Now().Unix() >= a.Start {
+			return ErrRSVPClosed
+		}
+
+		a.Participants, a.Waitlist = without(a.Participants, memberID), without(a.Waitlist, memberID)
+		a.promote()
+		return nil
+	})
+}
+
+// AttendeesOf returns the participants of the activity of id followed by its waitlist, in order.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func AttendeesOf(ctx context.Context, id primitive.ObjectID) (Attendees, error) {
+	a, err := load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := member.Find(ctx, member.Filter{IDs: append(append([]string{}, a.Participants...), a.Waitlist...)})
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]member.Member)
+	for _, memb := range members {
+		index[memb.ID] = memb
+	}
+
+	attendees := Attendees{}
+	for _, list := range []struct {
+		ids    []string
+		status string
+	}{{a.Participants, Going}, {a.Waitlist, Waitlisted}} {
+		for _, id := range list.ids {
+			memb := index[id]
+			attendees = append(attendees, Attendee{id, memb.Name, memb.Department, memb.Phone, memb.Email, list.status})
+		}
+	}
+	return attendees, nil
+}
+
+// WriteCSV writes as to w in CSV with a header line.
+func (as Attendees) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"member_id", "name", "department", "phone", "email", "status"}); err != nil {
+		return err
+	}
+	for _, a := range as {
+		if err := cw.Write([]string{a.MemberID, a.Name, a.Department, a.Phone, a.Email, a.Status}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// attend runs fn on the activity of id like swap, recording action.
+func attend(ctx context.Context, id primitive.ObjectID, action string, fn func(a *Activity) error) error {
+	return mutate(ctx, id, action, func() error { return swap(ctx, id, fn) })
+}
+
+// swap runs fn on the activity of id, and stores the participants and the waitlist fn leaves.
+// fn is run again on the activity read anew if they are changed concurrently.
+func swap(ctx context.Context, id primitive.ObjectID, fn func(a *Activity) error) error {
+	for {
+		a, err := store.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		old := a.clone()
+		if err = fn(a); err != nil {
+			return err
+		}
+		if err = store.SwapAttendees(ctx, old, *a); err != errConflict {
+			return err
+		}
+	}
+}
+
+// without returns ids without id.
+func without(ids []string, id string) []string {
+	rest := []string{}
+	for _, elem := range ids {
+		if elem != id {
+			rest = append(rest, elem)
+		}
+	}
+	return rest
+}
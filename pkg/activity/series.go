@@ -0,0 +1,456 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The scopes of the edits of the occurrences of a series.
+const (
+	ScopeThis      = "this"      // the occurrence only
+	ScopeFollowing = "following" // the occurrence and the following ones
+	ScopeAll       = "all"       // every occurrence of the series
+)
+
+// maxRange is the longest range of the occurrences to be expanded at once.
+const maxRange = 366 * 24 * 60 * 60
+
+var (
+	ErrInvalidSeries = errors.New("invalid series")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrInvalidRange  = errors.New("invalid range")
+	ErrNotOccurrence = errors.New("not an occurrence of a series")
+)
+
+// Series represents a recurring activity series.
+// Its occurrences are expanded from the template by the recurrence rule on query,
+// and are stored as activities only when they are RSVPed, checked in or edited.
+// A series has at most one occurrence a day, so the occurrences are told apart by their dates in KST.
+type Series struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	Key      string             `json:"-" bson:"key"`             // shared by the IDs of the occurrences (see occurrenceID)
+	Template Activity           `json:"template" bson:"template"` // the first occurrence, whose start is the DTSTART
+	RRule    string             `json:"rrule" bson:"rrule"`       // RFC 5545 recurrence rule, like "FREQ=WEEKLY;BYDAY=TU,TH"
+	ExDates  []int64            `json:"exdates" bson:"exdates"`   // starts of the cancelled occurrences - Unix timestamps
+}
+
+// NewSeries returns a new series of template, which recurs by rule.
+func NewSeries(template Activity, rule string) *Series {
+	id := primitive.NewObjectID()
+	template.ID, template.Files, template.Waitlist = primitive.NilObjectID, Files{}, nil
+	template.SeriesID, template.Occurrence, template.Overridden = nil, 0, false
+	return &Series{
+		ID:       id,
+		Key:      seriesKey(id),
+		Template: template,
+		RRule:    rule,
+		ExDates:  []int64{},
+	}
+}
+
+// Create creates a new series.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func (s Series) Create(ctx context.Context) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if err := seriesStore.Insert(ctx, s); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityCreateSeries, seriesTarget(s.ID), nil, s)
+}
+
+// GetSeries returns the series of id.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func GetSeries(ctx context.Context, id primitive.ObjectID) (*Series, error) {
+	return seriesStore.Get(ctx, id)
+}
+
+// Occurrences returns the activities which start in [from, to) and v can read, in order of the start.
+// The occurrences of the series are expanded, unless they are stored already.
+func Occurrences(ctx context.Context, from, to int64, v Viewer) (Activities, error) {
+	if to <= from || to-from > maxRange {
+		return nil, fmt.Errorf("%w: [%d, %d)", ErrInvalidRange, from, to)
+	}
+
+	activities, err := store.Find(ctx, Filter{Since: from, Until: to})
+	if err != nil {
+		return nil, err
+	}
+	if activities, err = expandAll(ctx, activities, from, to); err != nil {
+		return nil, err
+	}
+	return activities.visibleTo(v), nil
+}
+
+// UpdateSeries updates the occurrence of id to update, and the other occurrences of its series in scope.
+// The rule of the series is replaced with rule too unless it is empty, if scope is not ScopeThis.
+// For ScopeFollowing, the series is split into two at the occurrence, so that the former ones are kept.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func UpdateSeries(ctx context.Context, id primitive.ObjectID, scope string, update Activity, rule string) error {
+	a, err := load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if a.SeriesID == nil {
+		return ErrNotOccurrence
+	}
+
+	switch scope {
+	case ScopeThis:
+		update.ID = a.ID
+		return update.Update(ctx)
+	case ScopeFollowing, ScopeAll:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+	}
+
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		s, err := seriesStore.Get(ctx, *a.SeriesID)
+		if err != nil {
+			return err
+		}
+		if scope == ScopeFollowing && s.count(a.Occurrence) > 0 {
+			return s.split(ctx, a.Occurrence, update, rule)
+		}
+		return s.update(ctx, update, rule)
+	})
+}
+
+// DeleteSeries deletes the series of id with its stored occurrences.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func DeleteSeries(ctx context.Context, id primitive.ObjectID) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		s, err := seriesStore.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		occurrences, err := store.Find(ctx, Filter{SeriesID: &id})
+		if err != nil {
+			return err
+		}
+		for _, a := range occurrences {
+			if err = store.Delete(ctx, a.ID); err != nil {
+				return err
+			}
+		}
+
+		if err = seriesStore.Delete(ctx, id); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.ActivityDeleteSeries, seriesTarget(id), s, nil)
+	})
+}
+
+// update updates the template of s to update and its rule to rule, and the stored occurrences along.
+// The first occurrence is kept on its date, but moved to the time of day of update.
+func (s Series) update(ctx context.Context, update Activity, rule string) error {
+	next := NewSeries(update, rule)
+	next.ID, next.Key, next.ExDates = s.ID, s.Key, s.ExDates
+	if next.RRule == "" {
+		next.RRule = s.RRule
+	}
+
+	if update.Start == 0 {
+		next.Template.Start, next.Template.End, next.Template.RSVPDeadline = s.Template.Start, s.Template.End, s.Template.RSVPDeadline
+	} else {
+		first := midnight(time.Unix(s.Template.Start, 0))
+		clock := time.Unix(update.Start, 0).Sub(midnight(time.Unix(update.Start, 0)))
+		next.Template.shift(first.Add(clock).Unix())
+	}
+
+	if err := next.validate(); err != nil {
+		return err
+	}
+	if err := seriesStore.Update(ctx, *next); err != nil {
+		return err
+	}
+	if err := next.resync(ctx); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityUpdateSeries, seriesTarget(s.ID), s, next)
+}
+
+// split ends s before the occurrence of start, and creates a new series of update and rule from it.
+// The new series recurs by the rule of s for the rest of the occurrences if rule is empty,
+// and its first occurrence is at start if update has no start.
+func (s Series) split(ctx context.Context, start int64, update Activity, rule string) error {
+	r, err := parseRRule(s.RRule)
+	if err != nil {
+		return err
+	}
+
+	head, tail := s.clone(), NewSeries(update, rule)
+	if tail.RRule == "" {
+		rest := *r
+		if rest.count != 0 {
+			rest.count -= s.count(start)
+		}
+		tail.RRule = rest.String()
+	}
+	if update.Start == 0 {
+		tail.Template.Start, tail.Template.End, tail.Template.RSVPDeadline = s.Template.Start, s.Template.End, s.Template.RSVPDeadline
+		tail.Template.shift(start)
+	}
+
+	r.count, r.until = 0, start-1
+	head.RRule, head.ExDates = r.String(), []int64{}
+	for _, exdate := range s.ExDates {
+		if date(exdate) < date(start) {
+			head.ExDates = append(head.ExDates, exdate)
+		} else {
+			tail.ExDates = append(tail.ExDates, exdate)
+		}
+	}
+
+	if err = tail.validate(); err != nil {
+		return err
+	}
+	if err = seriesStore.Insert(ctx, *tail); err != nil {
+		return err
+	}
+	if err = seriesStore.Update(ctx, head); err != nil {
+		return err
+	}
+
+	occurrences, err := store.Find(ctx, Filter{SeriesID: &s.ID})
+	if err != nil {
+		return err
+	}
+	for _, a := range occurrences {
+		if date(a.Occurrence) < date(start) {
+			continue
+		}
+		a.SeriesID = &tail.ID
+		if err = store.Update(ctx, a); err != nil {
+			return err
+		}
+	}
+	if err = tail.resync(ctx); err != nil {
+		return err
+	}
+
+	if err = audit.Record(ctx, audit.ActivityUpdateSeries, seriesTarget(s.ID), s, head); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityCreateSeries, seriesTarget(tail.ID), nil, tail)
+}
+
+// resync moves the stored occurrences of s which are not overridden to the occurrences of s on their dates,
+// and deletes the ones which s no longer has. Their RSVPs and files are kept.
+func (s Series) resync(ctx context.Context) error {
+	occurrences, err := store.Find(ctx, Filter{SeriesID: &s.ID})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range occurrences {
+		if a.Overridden {
+			continue
+		}
+
+		slot := int64(0)
+		day := midnight(time.Unix(a.Occurrence, 0))
+		s.expand(day.Unix(), day.AddDate(0, 0, 1).Unix(), func(start int64) { slot = start })
+		if slot == 0 {
+			if err = store.Delete(ctx, a.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		next := s.occurrence(slot)
+		next.ID, next.Participants, next.Waitlist, next.Files = a.ID, a.Participants, a.Waitlist, a.Files
+		if err = next.normalize(); err != nil {
+			return err
+		}
+		if err = store.Update(ctx, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate validates s, and normalizes its template.
+func (s *Series) validate() error {
+	if _, err := parseRRule(s.RRule); err != nil {
+		return err
+	}
+	if s.Template.Start == 0 || s.Template.End < s.Template.Start {
+		return fmt.Errorf("%w: start %d, end %d", ErrInvalidSeries, s.Template.Start, s.Template.End)
+	}
+	return s.Template.normalize()
+}
+
+// expand calls fn with the starts of the occurrences of s in [from, to) in order, but the cancelled ones.
+func (s Series) expand(from, to int64, fn func(start int64)) {
+	r, err := parseRRule(s.RRule)
+	if err != nil {
+		return
+	}
+
+	cancelled := make(map[int64]bool)
+	for _, exdate := range s.ExDates {
+		cancelled[date(exdate)] = true
+	}
+	r.between(s.Template.Start, from, to, func(start int64) {
+		if !cancelled[date(start)] {
+			fn(start)
+		}
+	})
+}
+
+// count returns the number of the occurrences of s before start, including the cancelled ones.
+func (s Series) count(start int64) (n int) {
+	if r, err := parseRRule(s.RRule); err == nil {
+		r.between(s.Template.Start, s.Template.Start, start, func(int64) { n++ })
+	}
+	return
+}
+
+// stored returns the dates of the stored occurrences of s.
+func (s Series) stored(ctx context.Context) (map[int64]bool, error) {
+	occurrences, err := store.Find(ctx, Filter{SeriesID: &s.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[int64]bool)
+	for _, a := range occurrences {
+		dates[date(a.Occurrence)] = true
+	}
+	return dates, nil
+}
+
+// occurrence returns the occurrence of s at start.
+func (s Series) occurrence(start int64) Activity {
+	a := s.Template.clone()
+	a.ID = occurrenceID(s.ID, start)
+	a.shift(start)
+	a.SeriesID, a.Occurrence = &s.ID, start
+	if a.Participants == nil {
+		a.Participants = []string{}
+	}
+	a.Files = Files{}
+	return a
+}
+
+// shift moves a to start, keeping its duration and its RSVP deadline before the start.
+func (a *Activity) shift(start int64) {
+	if a.RSVPDeadline != 0 {
+		a.RSVPDeadline += start - a.Start
+	}
+	a.End += start - a.Start
+	a.Start = start
+}
+
+// load returns the activity of id.
+// An occurrence of a series which is not stored yet is stored on the first access,
+// so that it can be RSVPed, checked in and edited like the other activities.
+func load(ctx context.Context, id primitive.ObjectID) (*Activity, error) {
+	a, err := store.Get(ctx, id)
+	if err != ErrNotFound {
+		return a, err
+	}
+
+	series, err := seriesStore.Find(ctx, SeriesFilter{Key: seriesKey(id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, ErrNotFound
+	}
+	s := series[0]
+
+	start, found := int64(binary.BigEndian.Uint32(id[:4])), false
+	s.expand(start, start+1, func(int64) { found = true })
+	if !found {
+		return nil, ErrNotFound
+	}
+	// the occurrence on the date is stored with another ID, if it was moved by an edit of the series.
+	if stored, err := s.stored(ctx); err != nil {
+		return nil, err
+	} else if stored[date(start)] {
+		return nil, ErrNotFound
+	}
+
+	occurrence := s.occurrence(start)
+	if err = store.Insert(ctx, occurrence); err == errDuplicated {
+		return store.Get(ctx, id)
+	} else if err != nil {
+		return nil, err
+	}
+	return &occurrence, nil
+}
+
+// cancel cancels the occurrence of the series of id at start.
+func cancel(ctx context.Context, id primitive.ObjectID, start int64) error {
+	s, err := seriesStore.Get(ctx, id)
+	if err == ErrSeriesNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	before := s.clone()
+	s.ExDates = append(s.ExDates, start)
+	if err = seriesStore.Update(ctx, *s); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.ActivityUpdateSeries, seriesTarget(id), before, s)
+}
+
+// occurrenceID returns the ID of the occurrence of the series of id at start.
+// It consists of start and the key of the series, so that the occurrence can be found before it is stored.
+func occurrenceID(id primitive.ObjectID, start int64) primitive.ObjectID {
+	var oid primitive.ObjectID
+	binary.BigEndian.PutUint32(oid[:4], uint32(start))
+	copy(oid[4:], id[4:])
+	return oid
+}
+
+// seriesKey returns the key of the series of id, or of the series which the occurrence of id belongs to.
+// The IDs made in a process differ in their last 8 bytes, which are the random value and the counter.
+func seriesKey(id primitive.ObjectID) string { return hex.EncodeToString(id[4:]) }
+
+// seriesTarget returns the audit target of the series of id.
+func seriesTarget(id primitive.ObjectID) string { return audit.Target("series", id.Hex()) }
@@ -0,0 +1,187 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package activity provides access to the club activity of the Buddy System.
+package activity
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotFound       = errors.New("activity not found")
+	ErrSeriesNotFound = errors.New("series not found")
+	errConflict       = errors.New("attendees changed concurrently")
+	errDuplicated     = errors.New("duplicated activity")
+)
+
+// ActivityStore is the persistence layer of the club activities.
+type ActivityStore interface {
+	// Get returns the activity of id.
+	// It returns ErrNotFound if there is no such activity.
+	Get(ctx context.Context, id primitive.ObjectID) (*Activity, error)
+	// Find returns the activities matching filter in insertion order.
+	Find(ctx context.Context, filter Filter) (Activities, error)
+	// Insert inserts a.
+	// It returns errDuplicated if there is an activity of the same ID already.
+	Insert(ctx context.Context, a Activity) error
+	// Update overwrites the activity of a.ID with a, but its participants, waitlist and files.
+	Update(ctx context.Context, a Activity) error
+	// Delete deletes the activity of id.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// PushFile appends file to the activity of id.
+	PushFile(ctx context.Context, id primitive.ObjectID, file File) error
+	// PullFile removes file from the activity of id.
+	PullFile(ctx context.Context, id primitive.ObjectID, file File) error
+	// SwapAttendees sets the participants and the waitlist of the activity of a.ID to the ones of a,
+	// if they are still the ones of old. It returns errConflict otherwise.
+	SwapAttendees(ctx context.Context, old, a Activity) error
+}
+
+// Filter represents an activity search condition.
+// The zero value matches every activity.
+type Filter struct {
+	Type     *int                // activity type
+	Query    string              // regular expression to match with title, place or description
+	File     File                // file the activities have (empty for all)
+	SeriesID *primitive.ObjectID // series the activities are occurrences of (nil for all)
+	Since    int64               // inclusive lower bound of the start (zero for unbounded)
+	Until    int64               // exclusive upper bound of the start (zero for unbounded)
+}
+
+// Match reports whether a matches f.
+func (f Filter) Match(a Activity) (bool, error) {
+	if f.Type != nil && *f.Type != a.Type {
+		return false, nil
+	}
+	if f.SeriesID != nil && (a.SeriesID == nil || *f.SeriesID != *a.SeriesID) {
+		return false, nil
+	}
+	if (f.Since != 0 && a.Start < f.Since) || (f.Until != 0 && a.Start >= f.Until) {
+		return false, nil
+	}
+	if f.File != "" {
+		found := false
+		for _, file := range a.Files {
+			found = found || file == f.File
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if f.Query != "" {
+		re, err := regexp.Compile(f.Query)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(a.Title) || re.MatchString(a.Place) || re.MatchString(a.Description), nil
+	}
+	return true, nil
+}
+
+// SeriesStore is the persistence layer of the recurring activity series.
+type SeriesStore interface {
+	// Get returns the series of id.
+	// It returns ErrSeriesNotFound if there is no such series.
+	Get(ctx context.Context, id primitive.ObjectID) (*Series, error)
+	// Find returns the series matching filter in insertion order.
+	Find(ctx context.Context, filter SeriesFilter) ([]Series, error)
+	// Insert inserts s.
+	Insert(ctx context.Context, s Series) error
+	// Update overwrites the series of s.ID with s.
+	Update(ctx context.Context, s Series) error
+	// Delete deletes the series of id.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// SeriesFilter represents a series search condition.
+// The zero value matches every series.
+type SeriesFilter struct {
+	Key string // key of the series (empty for all)
+}
+
+// Match reports whether s matches f.
+func (f SeriesFilter) Match(s Series) bool { return f.Key == "" || f.Key == s.Key }
+
+// CheckInStore is the persistence layer of the check-in windows and the attendances of the club activities.
+type CheckInStore interface {
+	// Window returns the check-in window of the activity of id.
+	// It returns ErrCheckInClosed if there is no such window.
+	Window(ctx context.Context, id primitive.ObjectID) (*Window, error)
+	// PutWindow inserts w, or replaces the window of its activity.
+	// The check-in attempts to the activity are forgotten.
+	PutWindow(ctx context.Context, w Window) error
+	// DeleteWindow deletes the check-in window of the activity of id and the check-in attempts to it.
+	DeleteWindow(ctx context.Context, id primitive.ObjectID) error
+	// Attempt records a check-in attempt of the member of memberID to the activity of id,
+	// and returns the number of the attempts of the member since the window was opened.
+	Attempt(ctx context.Context, id primitive.ObjectID, memberID string) (int, error)
+	// FindAttendances returns the attendances matching filter in insertion order.
+	FindAttendances(ctx context.Context, filter AttendanceFilter) (Attendances, error)
+	// InsertAttendance inserts a.
+	// It returns ErrAlreadyCheckedIn if there is an attendance of the same ID already.
+	InsertAttendance(ctx context.Context, a Attendance) error
+}
+
+// AttendanceFilter represents an attendance search condition.
+// The zero value matches every attendance.
+type AttendanceFilter struct {
+	ActivityID primitive.ObjectID // activity ID (zero for all)
+	MemberID   string             // student ID of the member (empty for all)
+}
+
+// Match reports whether a matches f.
+func (f AttendanceFilter) Match(a Attendance) bool {
+	return (f.ActivityID.IsZero() || f.ActivityID == a.ActivityID) &&
+		(f.MemberID == "" || f.MemberID == a.MemberID)
+}
+
+// FeedStore is the persistence layer of the calendar feeds of the members.
+type FeedStore interface {
+	// Find returns the feed of the token hash.
+	// It returns ErrFeedNotFound if there is no such feed.
+	Find(ctx context.Context, hash string) (*Feed, error)
+	// Upsert inserts f, or replaces the feed of its member.
+	Upsert(ctx context.Context, f Feed) error
+	// Delete deletes the feed of the member of id.
+	Delete(ctx context.Context, id string) error
+}
+
+// Transactor runs the operations across the activity and series stores atomically.
+type Transactor interface {
+	// Transaction runs fn in a transaction.
+	// The store operations made with the context passed to fn are committed together if fn returns nil,
+	// and discarded otherwise. They are not visible to the other operations until committed.
+	// fn may be run more than once on the transient failures, so it must not have the other side effects.
+	// A transaction in another transaction joins the outer one.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+var (
+	store        ActivityStore
+	seriesStore  SeriesStore
+	checkInStore CheckInStore
+	feedStore    FeedStore
+	transactor   Transactor
+)
+
+// SetStore sets the persistence layers of the club activities to s, ss, cs and fs,
+// and the transactor across s and ss to tx.
+func SetStore(s ActivityStore, ss SeriesStore, cs CheckInStore, fs FeedStore, tx Transactor) {
+	store, seriesStore, checkInStore, feedStore, transactor = s, ss, cs, fs, tx
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides the audit log of the privileged operations of the Buddy System.
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions of the audit entries.
+const (
+	MemberSignUp         = "member.signup"
+	MemberChangePassword = "member.password"
+	MemberApprove        = "member.approve"
+	MemberDelete         = "member.delete"
+	MemberExit           = "member.exit"
+	MemberUpdate         = "member.update"
+	MemberActivate       = "member.activate"
+	ActivityCreate       = "activity.create"
+	ActivityUpdate       = "activity.update"
+	ActivityDelete       = "activity.delete"
+	ActivityUpload       = "activity.upload"
+	ActivityDeleteFile   = "activity.deletefile"
+	ActivityRSVP         = "activity.rsvp"
+	ActivityCancel       = "activity.cancel"
+	ActivityOpenCheckIn  = "activity.opencheckin"
+	ActivityCloseCheckIn = "activity.closecheckin"
+	ActivityCheckIn      = "activity.checkin"
+	ActivityCreateSeries = "activity.createseries"
+	ActivityUpdateSeries = "activity.updateseries"
+	ActivityDeleteSeries = "activity.deleteseries"
+	ActivityFeed         = "activity.feed"
+	FeeCreate            = "fee.create"
+	FeePolicy            = "fee.policy"
+	FeeItem              = "fee.item"
+	FeePay               = "fee.pay"
+	FeeDeposit           = "fee.deposit"
+	FeeExempt            = "fee.exempt"
+	FeeExpend            = "fee.expend"
+	FeeRepair            = "fee.repair"
+	FeeClose             = "fee.close"
+	FeeReopen            = "fee.reopen"
+	FeeCarryOver         = "fee.carryover"
+	FeeReverse           = "fee.reverse"
+	FeeImport            = "fee.import"
+	FeeResolve           = "fee.resolve"
+	FeeDismiss           = "fee.dismiss"
+	FeeAttach            = "fee.attach"
+	FeeReceipt           = "fee.receipt"
+	RoleCreate           = "role.create"
+	RoleUpdate           = "role.update"
+	RoleDelete           = "role.delete"
+	RoleAssign           = "role.assign"
+	RoleUnassign         = "role.unassign"
+)
+
+// Entry represents an audit log entry of a mutation.
+type Entry struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	ActorID   string             `json:"actor_id" bson:"actor_id"`            // student ID of the member who made the mutation
+	Action    string             `json:"action" bson:"action"`                // one of the actions above
+	Target    string             `json:"target" bson:"target"`                // mutated object (see Target)
+	Before    Snapshot           `json:"before" bson:"before"`                // state of the target before the mutation
+	After     Snapshot           `json:"after" bson:"after"`                  // state of the target after the mutation
+	IP        string             `json:"ip" bson:"ip"`                        // client IP address of the actor
+	CreatedAt int64              `json:"created_at,string" bson:"created_at"` // when mutated - Unix timestamp
+}
+
+type Entries []Entry
+
+// Snapshot is the JSON encoding of a state.
+// The empty snapshot stands for no state, like before a creation or after a deletion.
+type Snapshot string
+
+// NewSnapshot returns the snapshot of v.
+// It returns the empty snapshot if v is nil or a nil pointer.
+func NewSnapshot(v interface{}) (Snapshot, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return "", err
+	}
+	return Snapshot(b), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Snapshot) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*s = ""
+	} else {
+		*s = Snapshot(b)
+	}
+	return nil
+}
+
+// Target returns the audit target of the object of kind and id, like "member:20210001".
+func Target(kind, id string) string { return kind + ":" + id }
+
+type actorKey struct{}
+
+type ipKey struct{}
+
+// WithActor returns a copy of ctx which attributes the mutations to the member of id.
+func WithActor(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, actorKey{}, id)
+}
+
+// WithIP returns a copy of ctx which records ip as the client IP address of the mutations.
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipKey{}, ip)
+}
+
+// Actor returns the student ID of the actor of ctx, or the empty string for an anonymous actor.
+func Actor(ctx context.Context) string {
+	id, _ := ctx.Value(actorKey{}).(string)
+	return id
+}
+
+// Record appends an entry of action on target to the audit log.
+// before and after are the states of target around the mutation, and nil for no state.
+// The actor and the IP address are taken from ctx.
+func Record(ctx context.Context, action, target string, before, after interface{}) (err error) {
+	entry := Entry{
+		ID:        primitive.NewObjectID(),
+		ActorID:   Actor(ctx),
+		Action:    action,
+		Target:    target,
+		CreatedAt: time.Now().Unix(),
+	}
+	entry.IP, _ = ctx.Value(ipKey{}).(string)
+
+	if entry.Before, err = NewSnapshot(before); err != nil {
+		return
+	}
+	if entry.After, err = NewSnapshot(after); err != nil {
+		return
+	}
+	return store.Insert(ctx, entry)
+}
+
+// Search returns the audit entries matching filter in chronological order.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the club managers can access to this operation.
+func Search(ctx context.Context, filter Filter) (Entries, error) {
+	return store.Find(ctx, filter)
+}
+
+// WriteCSV writes es to w in CSV with a header line.
+func (es Entries) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"id", "created_at", "actor_id", "ip", "action", "target", "before", "after"}); err != nil {
+		return err
+	}
+	for _, e := range es {
+		if err := cw.Write([]string{
+			e.ID.Hex(),
+			strconv.FormatInt(e.CreatedAt, 10),
+			e.ActorID,
+			e.IP,
+			e.Action,
+			e.Target,
+			string(e.Before),
+			string(e.After),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
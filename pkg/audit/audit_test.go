@@ -0,0 +1,121 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	audit.SetStore(audit.NewMemoryStore())
+	os.Exit(m.Run())
+}
+
+func TestRecord(t *testing.T) {
+	actx := audit.WithIP(audit.WithActor(ctx, "20210001"), "127.0.0.1")
+
+	before := map[string]int{"grade": 1}
+	after := map[string]int{"grade": 2}
+
+	if err := audit.Record(actx, audit.MemberUpdate, audit.Target("member", "20210002"), before, after); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Record(ctx, audit.MemberSignUp, audit.Target("member", "20210003"), nil, after); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := audit.Search(ctx, audit.Filter{ActorID: "20210001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Action != audit.MemberUpdate || entry.Target != "member:20210002" || entry.IP != "127.0.0.1" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.Before != `{"grade":1}` || entry.After != `{"grade":2}` {
+		t.Errorf("unexpected snapshots: %s, %s", entry.Before, entry.After)
+	}
+
+	entries, err = audit.Search(ctx, audit.Filter{Target: "member:20210003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != "" || entries[0].Before != "" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   int
+	}{
+		{"all", audit.Filter{}, 2},
+		{"action", audit.Filter{Actions: []string{audit.MemberSignUp, audit.FeePay}}, 1},
+		{"no action", audit.Filter{Actions: []string{}}, 0},
+		{"since", audit.Filter{Since: now - 60}, 2},
+		{"until", audit.Filter{Until: now - 60}, 0},
+		{"range", audit.Filter{Since: now - 60, Until: now + 60, Target: "member:20210002"}, 1},
+	}
+
+	for _, test := range tests {
+		entries, err := audit.Search(ctx, test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != test.want {
+			t.Errorf("%s: expected %d entries, got %d", test.name, test.want, len(entries))
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	entries, err := audit.Search(ctx, audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = entries.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(entries)+1 {
+		t.Fatalf("expected %d records, got %d", len(entries)+1, len(records))
+	}
+	if records[1][2] != "20210001" || records[1][6] != `{"grade":1}` {
+		t.Errorf("unexpected record: %v", records[1])
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides the audit log of the privileged operations of the Buddy System.
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is an EntryStore which keeps the entries in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries Entries
+}
+
+// NewMemoryStore returns a new empty EntryStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// Find implements EntryStore.
+func (s *MemoryStore) Find(_ context.Context, filter Filter) (Entries, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := Entries{}
+	for _, entry := range s.entries {
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Insert implements EntryStore.
+func (s *MemoryStore) Insert(_ context.Context, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides the audit log of the privileged operations of the Buddy System.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore is an EntryStore backed by MongoDB.
+type MongoStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoStore returns a new EntryStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoStore(db *mongo.Database, timeout time.Duration) *MongoStore {
+	return &MongoStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the club database within the operation timeout.
+func (s *MongoStore) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db)
+}
+
+// Find implements EntryStore.
+func (s *MongoStore) Find(ctx context.Context, filter Filter) (entries Entries, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("audit").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		entries = Entries{}
+		entry := new(Entry)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(entry); err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements EntryStore.
+func (s *MongoStore) Insert(ctx context.Context, entry Entry) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("audit").InsertOne(ctx, entry)
+		return err
+	})
+}
+
+// document returns the MongoDB query document of f.
+func (f Filter) document() bson.D {
+	filter := bson.D{}
+
+	if f.ActorID != "" {
+		filter = append(filter, bson.E{Key: "actor_id", Value: f.ActorID})
+	}
+	if f.Actions != nil {
+		arr := make(bson.A, len(f.Actions))
+		for idx, action := range f.Actions {
+			arr[idx] = action
+		}
+		filter = append(filter, bson.E{Key: "action", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.Target != "" {
+		filter = append(filter, bson.E{Key: "target", Value: f.Target})
+	}
+	if f.Since != 0 || f.Until != 0 {
+		cond := bson.D{}
+		if f.Since != 0 {
+			cond = append(cond, bson.E{Key: "$gte", Value: f.Since})
+		}
+		if f.Until != 0 {
+			cond = append(cond, bson.E{Key: "$lt", Value: f.Until})
+		}
+		filter = append(filter, bson.E{Key: "created_at", Value: cond})
+	}
+	return filter
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides the audit log of the privileged operations of the Buddy System.
+package audit
+
+import (
+	"context"
+)
+
+// EntryStore is the persistence layer of the audit log.
+// It is append-only, so the entries are never updated nor deleted.
+type EntryStore interface {
+	// Find returns the entries matching filter in insertion order.
+	Find(ctx context.Context, filter Filter) (Entries, error)
+	// Insert inserts entry.
+	Insert(ctx context.Context, entry Entry) error
+}
+
+// Filter represents an audit entry search condition.
+// The zero value matches every entry.
+type Filter struct {
+	ActorID string   // student ID of the actor (empty for all)
+	Actions []string // actions to include (nil for all)
+	Target  string   // target (empty for all)
+	Since   int64    // inclusive lower bound of the creation time (zero for unbounded)
+	Until   int64    // exclusive upper bound of the creation time (zero for unbounded)
+}
+
+// Match reports whether e matches f.
+func (f Filter) Match(e Entry) bool {
+	return (f.ActorID == "" || f.ActorID == e.ActorID) &&
+		(f.Actions == nil || contains(f.Actions, e.Action)) &&
+		(f.Target == "" || f.Target == e.Target) &&
+		(f.Since == 0 || f.Since <= e.CreatedAt) &&
+		(f.Until == 0 || e.CreatedAt < f.Until)
+}
+
+var store EntryStore
+
+// SetStore sets the persistence layer of the audit log to s.
+func SetStore(s EntryStore) { store = s }
+
+func contains(strs []string, str string) bool {
+	for _, elem := range strs {
+		if elem == str {
+			return true
+		}
+	}
+	return false
+}
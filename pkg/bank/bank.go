@@ -0,0 +1,230 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bank provides the parsers of the bank statements exported from the Korean banks.
+package bank
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/korean"
+)
+
+// The formats of the bank statements.
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown statement format")
+	ErrUnknownBank   = errors.New("unknown bank")
+	ErrMissingColumn = errors.New("missing column")
+)
+
+// Mapping represents the headers of the columns of a bank statement.
+// The header row is the first row which contains every mapped header,
+// as the exports often begin with the account information.
+type Mapping struct {
+	Date    string `json:"date"`    // transaction time (optional)
+	Name    string `json:"name"`    // name of the depositor
+	Memo    string `json:"memo"`    // memo of the transaction (optional)
+	Deposit string `json:"deposit"` // amount deposited
+}
+
+// Mappings are the mappings of the exports of the common banks, keyed by their short names.
+// The column headers may change with the banks, so a mapping can be overridden field by field.
+var Mappings = map[string]Mapping{
+	"kb":      {Date: "거래일시", Name: "보낸분/받는분", Memo: "적요", Deposit: "입금액(원)"},
+	"shinhan": {Date: "거래일자", Name: "내용", Memo: "적요", Deposit: "입금(원)"},
+	"woori":   {Date: "거래일시", Name: "기재내용", Memo: "적요", Deposit: "맡기신금액"},
+	"hana":    {Date: "거래일시", Name: "의뢰인/수취인", Memo: "적요", Deposit: "입금액"},
+	"nh":      {Date: "거래일시", Name: "거래기록사항", Memo: "거래내용", Deposit: "입금금액"},
+	"ibk":     {Date: "거래일시", Name: "상대계좌예금주명", Memo: "적요", Deposit: "입금"},
+	"kakao":   {Date: "거래일시", Name: "내용", Memo: "메모", Deposit: "거래금액"},
+	"toss":    {Date: "거래 일시", Name: "적요", Memo: "메모", Deposit: "거래 금액"},
+}
+
+// Lookup returns the mapping of bank overridden by the non-empty fields of override.
+// bank may be empty to use override only.
+func Lookup(bank string, override Mapping) (Mapping, error) {
+	m := Mapping{}
+	if bank != "" {
+		var ok bool
+		if m, ok = Mappings[strings.ToLower(bank)]; !ok {
+			return m, fmt.Errorf("%w: %s", ErrUnknownBank, bank)
+		}
+	}
+
+	if override.Date != "" {
+		m.Date = override.Date
+	}
+	if override.Name != "" {
+		m.Name = override.Name
+	}
+	if override.Memo != "" {
+		m.Memo = override.Memo
+	}
+	if override.Deposit != "" {
+		m.Deposit = override.Deposit
+	}
+
+	if m.Name == "" || m.Deposit == "" {
+		return m, fmt.Errorf("%w: the name and the deposit columns are required", ErrMissingColumn)
+	}
+	return m, nil
+}
+
+// headers returns the non-empty headers of m.
+func (m Mapping) headers() []string {
+	headers := []string{}
+	for _, header := range []string{m.Date, m.Name, m.Memo, m.Deposit} {
+		if header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// Record represents a deposit in a bank statement.
+type Record struct {
+	Row    int    `json:"row"` // 1-based number of the row among the non-empty rows of the statement
+	Date   string `json:"date"`
+	Name   string `json:"name"`
+	Memo   string `json:"memo"`
+	Amount int    `json:"amount"`
+}
+
+type Records []Record
+
+// Parse parses the deposits of the bank statement of format from r with m.
+// The CSV statements may be encoded in UTF-8 or EUC-KR.
+// The withdrawals and the rows without amount are skipped.
+func Parse(r io.Reader, format string, m Mapping) (Records, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+
+	switch strings.ToLower(format) {
+	case CSV:
+		rows, err = readCSV(data)
+	case XLSX:
+		rows, err = readXLSX(data)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parse(rows, m)
+}
+
+// parse returns the deposits of rows with m.
+func parse(rows [][]string, m Mapping) (Records, error) {
+	start, columns := -1, map[string]int{}
+
+	for idx, row := range rows {
+		columns = make(map[string]int)
+		for col, cell := range row {
+			if _, ok := columns[strings.TrimSpace(cell)]; !ok {
+				columns[strings.TrimSpace(cell)] = col
+			}
+		}
+
+		found := true
+		for _, header := range m.headers() {
+			_, ok := columns[header]
+			found = found && ok
+		}
+		if found {
+			start = idx
+			break
+		}
+	}
+	if start == -1 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingColumn, strings.Join(m.headers(), ", "))
+	}
+
+	cell := func(row []string, header string) string {
+		col, ok := columns[header]
+		if header == "" || !ok || col >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[col])
+	}
+
+	records := Records{}
+	for idx, row := range rows[start+1:] {
+		amount, err := amount(cell(row, m.Deposit))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", start+idx+2, err)
+		}
+		if amount <= 0 {
+			continue
+		}
+		records = append(records, Record{
+			Row:    start + idx + 2,
+			Date:   cell(row, m.Date),
+			Name:   cell(row, m.Name),
+			Memo:   cell(row, m.Memo),
+			Amount: amount,
+		})
+	}
+	return records, nil
+}
+
+// amount parses the amount of str like "15,000", "15000원" or "1.5E4".
+// An empty str is zero.
+func amount(str string) (int, error) {
+	str = strings.NewReplacer(",", "", "원", "", " ", "", "+", "").Replace(str)
+	if str == "" || str == "-" {
+		return 0, nil
+	}
+	if i, err := strconv.Atoi(str); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount: %s", str)
+	}
+	return int(f), nil
+}
+
+// readCSV returns the rows of the CSV data.
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		decoded, err := korean.EUCKR.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bank_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/bank"
+	"golang.org/x/text/encoding/korean"
+)
+
+const statement = `계좌번호,123-456-789
+조회기간,2021.09.01 ~ 2021.09.30
+
+거래일시,적요,보낸분/받는분,출금액(원),입금액(원),잔액(원)
+2021.09.01 10:00:00,타행이체,홍길동,0,"15,000","15,000"
+2021.09.02 11:00:00,20210002,김철수,0,15000,30000
+2021.09.03 12:00:00,체크카드,OO마트,"3,000",0,27000
+`
+
+func TestLookup(t *testing.T) {
+	m, err := bank.Lookup("KB", bank.Mapping{Memo: "메모"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "보낸분/받는분" || m.Memo != "메모" {
+		t.Errorf("unexpected mapping: %+v", m)
+	}
+
+	if _, err = bank.Lookup("unknown", bank.Mapping{}); !errors.Is(err, bank.ErrUnknownBank) {
+		t.Errorf("expected %v, got %v", bank.ErrUnknownBank, err)
+	}
+	if _, err = bank.Lookup("", bank.Mapping{Name: "이름"}); !errors.Is(err, bank.ErrMissingColumn) {
+		t.Errorf("expected %v, got %v", bank.ErrMissingColumn, err)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	encoded, err := korean.EUCKR.NewEncoder().String(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{statement, "\xef\xbb\xbf" + statement, encoded} {
+		records, err := bank.Parse(strings.NewReader(data), bank.CSV, bank.Mappings["kb"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("expected 2 deposits, got %v", records)
+		}
+		if r := records[0]; r.Row != 4 || r.Name != "홍길동" || r.Memo != "타행이체" || r.Amount != 15000 || r.Date != "2021.09.01 10:00:00" {
+			t.Errorf("unexpected record: %+v", r)
+		}
+	}
+
+	if _, err = bank.Parse(strings.NewReader(statement), bank.CSV, bank.Mappings["nh"]); !errors.Is(err, bank.ErrMissingColumn) {
+		t.Errorf("expected %v, got %v", bank.ErrMissingColumn, err)
+	}
+	if _, err = bank.Parse(strings.NewReader(statement), "pdf", bank.Mappings["kb"]); !errors.Is(err, bank.ErrUnknownFormat) {
+		t.Errorf("expected %v, got %v", bank.ErrUnknownFormat, err)
+	}
+}
+
+func TestParseXLSX(t *testing.T) {
+	buf := archive(t, map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="거래내역" sheetId="1" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>거래일시</t></si><si><t>기재내용</t></si><si><t>맡기신금액</t></si><si><r><t>홍</t></r><r><t>길동</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>우리은행 거래내역</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="D2" t="s"><v>2</v></c></row>
+<row r="3"><c r="A3" t="str"><v>2021-09-01</v></c><c r="B3" t="s"><v>3</v></c><c r="D3"><v>15000</v></c></row>
+<row r="4"><c r="A4" t="str"><v>2021-09-02</v></c><c r="B4" t="inlineStr"><is><t>김철수</t></is></c></row>
+</sheetData></worksheet>`,
+	})
+
+	records, err := bank.Parse(buf, bank.XLSX, bank.Mapping{Date: "거래일시", Name: "기재내용", Deposit: "맡기신금액"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Name != "홍길동" || records[0].Amount != 15000 || records[0].Row != 3 {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestParseMalformedXLSX(t *testing.T) {
+	for _, ref := range []string{"1", "a1", "XFE1", "ZZZZZZ1"} {
+		buf := archive(t, map[string]string{
+			"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="` + ref + `" t="inlineStr"><is><t>거래일시</t></is></c></row>
+</sheetData></worksheet>`,
+		})
+		if _, err := bank.Parse(buf, bank.XLSX, bank.Mapping{Date: "거래일시"}); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+// archive returns an xlsx archive of files.
+func archive(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
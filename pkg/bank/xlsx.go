@@ -0,0 +1,180 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bank
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// readXLSX returns the rows of the first sheet of the XLSX data.
+// It reads the cell values only, without the styles and the formulas.
+func readXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+
+	strs := new(struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	})
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err = decode(file, strs); err != nil {
+			return nil, err
+		}
+	}
+	shared := make([]string, len(strs.Items))
+	for idx, item := range strs.Items {
+		shared[idx] = item.Text
+		for _, run := range item.Runs {
+			shared[idx] += run.Text
+		}
+	}
+
+	worksheet := new(struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	})
+	if err = decode(sheet, worksheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, len(worksheet.Rows))
+	for idx, row := range worksheet.Rows {
+		for col, cell := range row.Cells {
+			if cell.Ref != "" {
+				if col, err = column(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				i, err := strconv.Atoi(value)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("invalid xlsx: shared string %s", value)
+				}
+				value = shared[i]
+			case "inlineStr":
+				value = cell.Inline
+			}
+
+			for len(rows[idx]) <= col {
+				rows[idx] = append(rows[idx], "")
+			}
+			rows[idx][col] = value
+		}
+	}
+	return rows, nil
+}
+
+// firstSheet returns the file of the first sheet in the workbook of files.
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	workbook := new(struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	})
+	rels := new(struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	})
+
+	if file, ok := files["xl/workbook.xml"]; ok && decode(file, workbook) == nil && len(workbook.Sheets) != 0 {
+		if file, ok = files["xl/_rels/workbook.xml.rels"]; ok && decode(file, rels) == nil {
+			for _, rel := range rels.Relationships {
+				if rel.ID != workbook.Sheets[0].ID {
+					continue
+				}
+				name := path.Join("xl", rel.Target)
+				if strings.HasPrefix(rel.Target, "/") {
+					name = strings.TrimPrefix(rel.Target, "/")
+				}
+				if sheet, ok := files[name]; ok {
+					return sheet, nil
+				}
+			}
+		}
+	}
+
+	if sheet, ok := files["xl/worksheets/sheet1.xml"]; ok {
+		return sheet, nil
+	}
+	return nil, fmt.Errorf("invalid xlsx: no worksheet")
+}
+
+// decode decodes the XML file into v.
+func decode(file *zip.File, v interface{}) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid xlsx: %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// maxColumns is the number of the columns of a worksheet, from A to XFD.
+const maxColumns = 16384
+
+// column returns the 0-based column index of the cell reference ref like "AB12".
+// It returns an error if ref has no column, or a column beyond XFD.
+func column(ref string) (int, error) {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		if col = col*26 + int(r-'A'+1); col > maxColumns {
+			return 0, fmt.Errorf("invalid xlsx: cell reference %s", ref)
+		}
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("invalid xlsx: cell reference %s", ref)
+	}
+	return col - 1, nil
+}
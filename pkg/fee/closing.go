@@ -0,0 +1,283 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+)
+
+// Link represents a semester in the balance chain.
+type Link struct {
+	Year           int   `json:"year"`
+	Semester       int   `json:"semester"`
+	CarryOver      int   `json:"carry_over"`
+	Income         int   `json:"income"`  // cash in, except the carry-over
+	Outgo          int   `json:"outgo"`   // cash out
+	Balance        int   `json:"balance"` // current cash, including the carry-over
+	Closed         bool  `json:"closed"`
+	ClosingBalance int   `json:"closing_balance"`
+	ClosedAt       int64 `json:"closed_at,string"`
+	Stale          bool  `json:"stale"` // whether the carry-over differs from the balance of the previous semester
+}
+
+type Chain []Link
+
+// period identifies the fee of a year and a semester.
+type period struct{ year, semester int }
+
+// previous returns the year and the semester whose balance is carried over to the semester of year and semester.
+func previous(year, semester int) (int, int) {
+	if semester == 1 {
+		return year - 1, 2
+	}
+	return year, 1
+}
+
+// openingID returns the ID of the opening entry of the fee of year and semester.
+func openingID(year, semester int) string { return openingEntry(year, semester, 0).ID }
+
+// cash returns the current cash of the fee of year and semester.
+func cash(ctx context.Context, year, semester int) (int, error) {
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: year, Semester: semester})
+	if err != nil {
+		return 0, err
+	}
+	return entries.balance(Cash), nil
+}
+
+// Close closes the fee of year and semester with its closing balance.
+// No log can be added to a closed fee until it is reopened.
+// The closing balance is carried over to the later semesters again, in case the fee was reopened and amended.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Close(ctx context.Context, year, semester int) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if fee.Closed {
+			return ErrClosedFee
+		}
+
+		closing, err := cash(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+
+		update := map[string]interface{}{"closed": true, "closing_balance": closing, "closed_at": time.Now().Unix()}
+		if err = feeStore.Update(ctx, year, semester, update); err != nil {
+			return err
+		}
+		if err = audit.Record(ctx, audit.FeeClose, target(year, semester), map[string]interface{}{"closed": false}, update); err != nil {
+			return err
+		}
+		return recompute(ctx, year, semester)
+	})
+}
+
+// Reopen reopens the closed fee of year and semester to amend it.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Reopen(ctx context.Context, year, semester int) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if !fee.Closed {
+			return ErrOpenFee
+		}
+
+		before := map[string]interface{}{"closed": true, "closing_balance": fee.ClosingBalance, "closed_at": fee.ClosedAt}
+		update := map[string]interface{}{"closed": false, "closing_balance": 0, "closed_at": int64(0)}
+		if err = feeStore.Update(ctx, year, semester, update); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeReopen, target(year, semester), before, update)
+	})
+}
+
+// Recompute carries the balance of the fee of year and semester over to the later semesters again,
+// updating the carry-over of each semester in the chain.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Recompute(ctx context.Context, year, semester int) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := feeStore.Get(ctx, year, semester); err != nil {
+			return err
+		}
+		return recompute(ctx, year, semester)
+	})
+}
+
+// recompute updates the carry-over of the fees after year and semester in chronological order,
+// so that each semester carries over the balance of its previous semester.
+// The opening entries of the updated fees are updated as well.
+// The fees whose previous semester does not exist are left as they are.
+// It stops at the first closed fee, whose figures are never changed:
+// it returns ErrClosedFee if the carry-over of the closed fee would change, so that it is reopened first.
+func recompute(ctx context.Context, year, semester int) error {
+	fees, err := feeStore.Find(ctx)
+	if err != nil {
+		return err
+	}
+	sortFees(fees)
+
+	exists := make(map[period]bool)
+	for _, fee := range fees {
+		exists[period{fee.Year, fee.Semester}] = true
+	}
+
+	for _, fee := range fees {
+		if fee.Year < year || (fee.Year == year && fee.Semester <= semester) {
+			continue
+		}
+
+		prevYear, prevSemester := previous(fee.Year, fee.Semester)
+		if !exists[period{prevYear, prevSemester}] {
+			continue
+		}
+
+		carryOver, err := cash(ctx, prevYear, prevSemester)
+		if err != nil {
+			return err
+		}
+		if fee.Closed {
+			if carryOver != fee.CarryOver {
+				return fmt.Errorf("%w: reopen the fee of %d-%d first to carry over %d", ErrClosedFee, fee.Year, fee.Semester, carryOver)
+			}
+			break
+		}
+		if carryOver == fee.CarryOver {
+			continue
+		}
+
+		// the opening entry keeps its place in the statements
+		opening := openingEntry(fee.Year, fee.Semester, carryOver)
+		entries, err := journalStore.Find(ctx, EntryFilter{Year: fee.Year, Semester: fee.Semester})
+		if err != nil {
+			return err
+		}
+		for idx, entry := range entries {
+			if entry.ID == opening.ID || idx == 0 {
+				opening.CreatedAt = entry.CreatedAt
+			}
+		}
+
+		if err = journalStore.Delete(ctx, EntryFilter{IDs: []string{opening.ID}}); err != nil {
+			return err
+		}
+		if err = post(ctx, opening); err != nil {
+			return err
+		}
+
+		before := map[string]interface{}{"carry_over": fee.CarryOver}
+		update := map[string]interface{}{"carry_over": carryOver}
+		if err = feeStore.Update(ctx, fee.Year, fee.Semester, update); err != nil {
+			return err
+		}
+		if err = audit.Record(ctx, audit.FeeCarryOver, target(fee.Year, fee.Semester), before, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BalanceChain returns the balances of every semester in chronological order,
+// showing how each balance is carried over to the next semester.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func BalanceChain(ctx context.Context) (Chain, error) {
+	fees, err := feeStore.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortFees(fees)
+
+	entries, err := journalStore.Find(ctx, EntryFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make(Chain, len(fees))
+	index := make(map[period]int)
+
+	for idx, fee := range fees {
+		chain[idx] = Link{
+			Year:           fee.Year,
+			Semester:       fee.Semester,
+			CarryOver:      fee.CarryOver,
+			Closed:         fee.Closed,
+			ClosingBalance: fee.ClosingBalance,
+			ClosedAt:       fee.ClosedAt,
+		}
+		index[period{fee.Year, fee.Semester}] = idx
+	}
+
+	for _, entry := range entries {
+		idx, ok := index[period{entry.Year, entry.Semester}]
+		if !ok {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			if posting.Account != Cash {
+				continue
+			}
+			chain[idx].Balance += posting.Debit - posting.Credit
+			if entry.ID == openingID(entry.Year, entry.Semester) {
+				continue
+			}
+			chain[idx].Income += posting.Debit
+			chain[idx].Outgo += posting.Credit
+		}
+	}
+
+	for idx, link := range chain {
+		prevYear, prevSemester := previous(link.Year, link.Semester)
+		if prev, ok := index[period{prevYear, prevSemester}]; ok {
+			chain[idx].Stale = link.CarryOver != chain[prev].Balance
+		}
+	}
+	return chain, nil
+}
+
+// sortFees sorts fees in chronological order.
+func sortFees(fees []Fee) {
+	sort.Slice(fees, func(i, j int) bool {
+		if fees[i].Year != fees[j].Year {
+			return fees[i].Year < fees[j].Year
+		}
+		return fees[i].Semester < fees[j].Semester
+	})
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/pdf"
+)
+
+// Due represents the fee of a semester a member is liable for.
+type Due struct {
+	Year        int `json:"year"`
+	Semester    int `json:"semester"`
+	Amount      int `json:"amount"` // amount charged
+	Paid        int `json:"paid"`
+	Exempted    int `json:"exempted"`
+	Outstanding int `json:"outstanding"` // amount neither paid nor exempted
+	Balance     int `json:"balance"`     // running total of the outstanding amounts
+}
+
+type Dues []Due
+
+// Debt represents an amount a member owes for the semester dues or a fee item with a due date.
+type Debt struct {
+	Year     int    `json:"year"`
+	Semester int    `json:"semester"`
+	Item     string `json:"item"` // hexadecimal ID of the fee item (empty for the semester dues)
+	Name     string `json:"name"` // name of the fee item, or "회비" for the semester dues
+	DueDate  int64  `json:"due_date,string"`
+	MemberID string `json:"member_id"`
+	Amount   int    `json:"amount"`
+}
+
+type Debts []Debt
+
+// FindDebts returns the debts of the open fees and the fee items which have due dates.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func FindDebts(ctx context.Context) (Debts, error) {
+	fees, err := feeStore.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortFees(fees)
+
+	debts := Debts{}
+	for _, fee := range fees {
+		if fee.Closed {
+			continue
+		}
+
+		if fee.DueDate != 0 {
+			deptors, depts, err := fee.Deptors(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for idx, deptor := range deptors {
+				debts = append(debts, Debt{fee.Year, fee.Semester, "", "회비", fee.DueDate, deptor.ID, depts[idx]})
+			}
+		}
+
+		for _, item := range fee.Items {
+			if item.DueDate == 0 {
+				continue
+			}
+			deptors, depts, err := ItemDeptors(ctx, fee.Year, fee.Semester, item.ID)
+			if err != nil {
+				return nil, err
+			}
+			for idx, deptor := range deptors {
+				debts = append(debts, Debt{fee.Year, fee.Semester, item.ID.Hex(), item.Name, item.DueDate, deptor.ID, depts[idx]})
+			}
+		}
+	}
+	return debts, nil
+}
+
+// MemberStatement returns the fees the member of id is liable for in chronological order,
+// with the running total of the outstanding amounts.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to their own statements,
+//	and the club managers can access to any statement.
+func MemberStatement(ctx context.Context, id string) (Dues, error) {
+	account := Receivable(id)
+
+	entries, err := journalStore.Find(ctx, EntryFilter{Account: account})
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[period]int)
+	dues := Dues{}
+
+	for _, entry := range entries {
+		key := period{entry.Year, entry.Semester}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(dues)
+			index[key] = idx
+			dues = append(dues, Due{Year: entry.Year, Semester: entry.Semester})
+		}
+
+		cash := false
+		for _, posting := range entry.Postings {
+			cash = cash || posting.Account == Cash
+		}
+
+		for _, posting := range entry.Postings {
+			if posting.Account != account {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(entry.ID, "charge:"):
+				dues[idx].Amount += posting.Debit - posting.Credit
+			case cash:
+				dues[idx].Paid += posting.Credit - posting.Debit
+			default:
+				dues[idx].Exempted += posting.Credit - posting.Debit
+			}
+		}
+	}
+
+	sort.Slice(dues, func(i, j int) bool {
+		if dues[i].Year != dues[j].Year {
+			return dues[i].Year < dues[j].Year
+		}
+		return dues[i].Semester < dues[j].Semester
+	})
+
+	balance := 0
+	for idx := range dues {
+		dues[idx].Outstanding = dues[idx].Amount - dues[idx].Paid - dues[idx].Exempted
+		balance += dues[idx].Outstanding
+		dues[idx].Balance = balance
+	}
+	return dues, nil
+}
+
+// WriteCSV writes ds to w in CSV with a header line.
+func (ds Dues) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"year", "semester", "amount", "paid", "exempted", "outstanding", "balance"}); err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if err := cw.Write([]string{
+			strconv.Itoa(d.Year),
+			strconv.Itoa(d.Semester),
+			strconv.Itoa(d.Amount),
+			strconv.Itoa(d.Paid),
+			strconv.Itoa(d.Exempted),
+			strconv.Itoa(d.Outstanding),
+			strconv.Itoa(d.Balance),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePDF writes ds to w in PDF as the statement of the member of id and name.
+func (ds Dues) WritePDF(w io.Writer, id, name string) error {
+	doc := pdf.New()
+	columns := []float64{200, 280, 360, 450, 545}
+	y := 0.0
+
+	header := func() {
+		doc.AddPage()
+		doc.Text(50, 790, 18, "회비 납부 내역서")
+		doc.Text(50, 760, 11, fmt.Sprintf("%s (%s)", name, id))
+		doc.TextRight(545, 760, 11, "발급일: "+time.Now().Format("2006-01-02"))
+
+		doc.Line(50, 745, 545, 745)
+		doc.Text(50, 730, 10, "학기")
+		for idx, title := range []string{"부과액", "납부액", "면제액", "미납액", "누적 미납액"} {
+			doc.TextRight(columns[idx], 730, 10, title)
+		}
+		doc.Line(50, 722, 545, 722)
+		y = 705
+	}
+	row := func(title string, amounts ...int) {
+		if y < 60 {
+			header()
+		}
+		doc.Text(50, y, 10, title)
+		for idx, amount := range amounts {
+			doc.TextRight(columns[idx], y, 10, Comma(amount))
+		}
+		y -= 18
+	}
+
+	header()
+
+	total := Due{}
+	for _, d := range ds {
+		row(fmt.Sprintf("%d년 %d학기", d.Year, d.Semester), d.Amount, d.Paid, d.Exempted, d.Outstanding, d.Balance)
+		total.Amount += d.Amount
+		total.Paid += d.Paid
+		total.Exempted += d.Exempted
+		total.Outstanding += d.Outstanding
+	}
+
+	doc.Line(50, y+12, 545, y+12)
+	row("합계", total.Amount, total.Paid, total.Exempted, total.Outstanding)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// Comma returns n with the thousands separators, like "15,000".
+func Comma(n int) string {
+	str := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, str = "-", str[1:]
+	}
+	for idx := len(str) - 3; idx > 0; idx -= 3 {
+		str = str[:idx] + "," + str[idx:]
+	}
+	return sign + str
+}
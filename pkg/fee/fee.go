@@ -18,25 +18,32 @@ package fee
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sort"
+	"strings"
 
-	"github.com/kmu-kcc/buddy-backend/config"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
 	"github.com/kmu-kcc/buddy-backend/pkg/member"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
 	payment = iota
 	deposit
 	exemption
+	expense
 )
 
 var (
 	ErrDuplicatedFee   = errors.New("duplicated fee")
 	ErrAlreadyExempted = errors.New("already exempted")
+	ErrInvalidExpense  = errors.New("invalid expense")
+	ErrClosedFee       = errors.New("closed fee")
+	ErrOpenFee         = errors.New("open fee")
+	ErrLogNotFound     = errors.New("fee log not found")
+	ErrInvalidReversal = errors.New("invalid reversal")
+	ErrAlreadyReversed = errors.New("already reversed")
+	ErrNotExempted     = errors.New("not exempted")
 )
 
 // Fee represents a club fee state.
@@ -46,6 +53,14 @@ type Fee struct {
 	CarryOver int                  `json:"carry_over" bson:"carry_over"`
 	Amount    int                  `json:"amount" bson:"amount"`
 	Logs      []primitive.ObjectID `json:"logs" bson:"logs"`
+	Policy    *Policy              `json:"policy,omitempty" bson:"policy,omitempty"` // DefaultPolicy if nil
+	Items     Items                `json:"items" bson:"items"`                       // fee items other than the semester dues
+	DueDate   int64                `json:"due_date,string" bson:"due_date"`          // due date of the semester dues (zero for none)
+	Posted    bool                 `json:"-" bson:"posted"`                          // posted to the ledger or not (false for the fees made before it)
+
+	Closed         bool  `json:"closed" bson:"closed"`
+	ClosingBalance int   `json:"closing_balance" bson:"closing_balance"`
+	ClosedAt       int64 `json:"closed_at,string" bson:"closed_at"`
 }
 
 // New returns a new club fee.
@@ -56,254 +71,175 @@ func New(year, semester, carryOver, amount int) *Fee {
 		CarryOver: carryOver,
 		Amount:    amount,
 		Logs:      []primitive.ObjectID{},
+		Items:     Items{},
 	}
 }
 
 // Create creates a new fee history.
+// The balance of the previous semester is carried over,
+// and the fee is charged to the approved members with their dues by the policy of f.
+// It returns ErrInvalidPolicy if any rule of the policy is invalid.
 //
 // NOTE:
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (f Fee) Create() (err error) {
-	var year, semester int
+func (f Fee) Create(ctx context.Context) (err error) {
+	year, semester := previous(f.Year, f.Semester)
 
-	if f.Semester == 1 {
-		year, semester = f.Year-1, 2
-	} else {
-		year, semester = f.Year, 1
+	if f.Policy != nil {
+		if err = f.Policy.validate(); err != nil {
+			return
+		}
+		policy := f.Policy.clone()
+		f.Policy = &policy
 	}
 
-	_, _, f.CarryOver, err = New(year, semester, 0, 0).Search()
-	f.Logs = []primitive.ObjectID{}
+	ids, err := chargeable(ctx)
 	if err != nil {
 		return
 	}
 
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
+	return transactor.Transaction(ctx, func(ctx context.Context) (err error) {
+		_, _, f.CarryOver, err = New(year, semester, 0, 0).Search(ctx)
+		f.Logs, f.Items = []primitive.ObjectID{}, Items{}
+		f.Closed, f.ClosingBalance, f.ClosedAt = false, 0, 0
+		f.Posted = true
+		if err != nil {
+			return
+		}
 
-	collection := client.Database("club").Collection("fees")
-	fee := new(Fee)
+		if _, err = feeStore.Get(ctx, f.Year, f.Semester); err == nil {
+			return ErrDuplicatedFee
+		} else if err != ErrNotFound {
+			return
+		}
 
-	if err = collection.FindOne(ctx, bson.D{bson.E{Key: "year", Value: f.Year}, bson.E{Key: "semester", Value: f.Semester}}).Decode(fee); err == mongo.ErrNoDocuments {
-		_, err = collection.InsertOne(ctx, f)
-		return
-	} else if err == nil {
-		return ErrDuplicatedFee
-	}
-	return
+		if err = feeStore.Insert(ctx, f); err != nil {
+			return
+		}
+		dues, err := f.dues(ctx, ids)
+		if err != nil {
+			return
+		}
+		entries, err := charges(ctx, f.Year, f.Semester, dues, ids)
+		if err != nil {
+			return
+		}
+		if err = post(ctx, append(Entries{openingEntry(f.Year, f.Semester, f.CarryOver)}, entries...)...); err != nil {
+			return
+		}
+		return audit.Record(ctx, audit.FeeCreate, target(f.Year, f.Semester), nil, f)
+	})
 }
 
-// Amount returns the amount of payments of member of id.
+// Amount returns the amount of payments of member of id for the semester dues.
 //
 // NOTE:
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func Amount(year, semester int, id string) (amount int, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
-
-	fee := new(Fee)
-	log := new(Log)
-
-	if err = client.Database("club").Collection("fees").FindOne(ctx, bson.M{"year": year, "semester": semester}).Decode(fee); err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
-	}
-
-	filter := bson.D{
-		bson.E{Key: "_id", Value: bson.D{
-			bson.E{Key: "$in", Value: fee.Logs},
-		}},
-		bson.E{Key: "member_id", Value: id},
-		bson.E{Key: "type", Value: payment},
-	}
-
-	cur, err := client.Database("club").Collection("logs").Find(ctx, filter)
+func Amount(ctx context.Context, year, semester int, id string) (amount int, err error) {
+	entries, err := duesEntries(ctx, year, semester)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
 		return
 	}
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(log); err != nil {
-			return
-		}
-		amount += log.Amount
-	}
-
-	return amount, cur.Close(ctx)
+	paid, _ := entries.settlements()
+	return paid[id], nil
 }
 
-// Payers returns the list of members who paid the fee of year and semester.
+// Payers returns the list of members who paid the fee of year and semester,
+// or were exempted from it, as much as they owe by the policy of the fee.
 //
 // NOTE:
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (f *Fee) Payers() (members member.Members, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func (f *Fee) Payers(ctx context.Context) (members member.Members, err error) {
+	fee, err := feeStore.Get(ctx, f.Year, f.Semester)
 	if err != nil {
 		return
 	}
-	defer client.Disconnect(ctx)
-
-	log := new(Log)
-	memb := new(member.Member)
+	*f = *fee
 
-	if err = client.Database("club").Collection("fees").FindOne(ctx, bson.M{"year": f.Year, "semester": f.Semester}).Decode(f); err != nil {
-		return
-	}
-
-	filter := func() bson.D {
-		arr := make(bson.A, len(f.Logs))
-		for idx, logID := range f.Logs {
-			arr[idx] = logID
-		}
-		return bson.D{
-			bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}},
-			bson.E{Key: "$or", Value: bson.A{
-				bson.D{bson.E{Key: "type", Value: payment}},
-				bson.D{bson.E{Key: "type", Value: exemption}}}}}
-	}()
-
-	cur, err := client.Database("club").Collection("logs").Find(ctx, filter)
+	entries, err := duesEntries(ctx, f.Year, f.Semester)
 	if err != nil {
 		return
 	}
 
-	amounts := make(map[string]int)
+	_, settled := entries.settlements()
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(log); err != nil {
-			return
+	ids := []string{}
+	for membID, amount := range settled {
+		if amount > 0 {
+			ids = append(ids, membID)
 		}
-		amounts[log.MemberID] += log.Amount
-	}
-
-	if err = cur.Close(ctx); err != nil {
-		return
 	}
-
-	filter = func() bson.D {
-		arr := bson.A{}
-		for membID, amount := range amounts {
-			if f.Amount <= amount {
-				arr = append(arr, membID)
-			}
-		}
-		return bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$in", Value: arr}}}}
-	}()
-
-	cur, err = client.Database("club").Collection("members").Find(ctx, filter)
+	owed, err := f.owed(ctx, entries, ids)
 	if err != nil {
 		return
 	}
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(memb); err != nil {
-			return
+	payers := []string{}
+	for _, id := range ids {
+		if owed[id] <= settled[id] {
+			payers = append(payers, id)
 		}
-		members = append(members, *memb)
 	}
 
-	return members, cur.Close(ctx)
+	return member.Find(ctx, member.Filter{IDs: payers})
 }
 
-// Deptors returns the list of members who did not pay the fee of year and semester.
+// Deptors returns the list of members who did not pay the fee of year and semester, with the amounts they owe yet.
+// The members who owe nothing by the policy of the fee are not deptors.
 //
 // NOTE:
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func (f *Fee) Deptors() (deptors member.Members, depts []int, err error) {
-	payers, err := f.Payers()
+func (f *Fee) Deptors(ctx context.Context) (deptors member.Members, depts []int, err error) {
+	payers, err := f.Payers(ctx)
 	if err != nil {
 		return
 	}
 
-	ids := make(bson.A, len(payers)+1)
+	ids := make([]string, len(payers), len(payers)+1)
 	for idx, payer := range payers {
 		ids[idx] = payer.ID
 	}
 	ids = append(ids, member.MASTER)
 
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+	members, err := member.Find(ctx, member.Filter{ExcludedIDs: ids})
 	if err != nil {
 		return
 	}
-	defer client.Disconnect(ctx)
 
-	memb := new(member.Member)
-	cur, err := client.Database("club").Collection("members").Find(ctx, bson.D{
-		bson.E{Key: "attendance", Value: bson.D{bson.E{Key: "$ne", Value: member.Graduate}}},
-		bson.E{Key: "id", Value: bson.D{bson.E{Key: "$nin", Value: ids}}},
-	})
+	entries, err := duesEntries(ctx, f.Year, f.Semester)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
-	}
-
-	for cur.Next(ctx) {
-		if err = cur.Decode(memb); err != nil {
-			return
-		}
-		deptors = append(deptors, *memb)
-	}
-	if err = cur.Close(ctx); err != nil {
 		return
 	}
 
-	ids = make(bson.A, len(deptors))
-	for idx, deptor := range deptors {
-		ids[idx] = deptor.ID
+	ids = make([]string, len(members))
+	for idx, member := range members {
+		ids[idx] = member.ID
 	}
-
-	log := new(Log)
-	amounts := make(map[string]int)
-	cur, err = client.Database("club").Collection("logs").Find(ctx, bson.D{
-		bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: f.Logs}}},
-		bson.E{Key: "type", Value: payment},
-		bson.E{Key: "member_id", Value: bson.D{bson.E{Key: "$in", Value: ids}}},
-	})
+	owed, err := f.owed(ctx, entries, ids)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
 		return
 	}
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(log); err != nil {
-			return
-		}
-		amounts[log.MemberID] += log.Amount
-	}
+	_, settled := entries.settlements()
 
-	depts = make([]int, len(deptors))
-	for idx, deptor := range deptors {
-		depts[idx] = f.Amount - amounts[deptor.ID]
+	deptors, depts = member.Members{}, []int{}
+	for _, member := range members {
+		if dept := owed[member.ID] - settled[member.ID]; dept > 0 {
+			deptors = append(deptors, member)
+			depts = append(depts, dept)
+		}
 	}
 
-	return deptors, depts, cur.Close(ctx)
+	return deptors, depts, nil
 }
 
 // Search returns the fee history of year and semester.
@@ -312,95 +248,77 @@ func (f *Fee) Deptors() (deptors member.Members, depts []int, err error) {
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func (f *Fee) Search() (carryOver int, _ []map[string]interface{}, total int, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
-
-	if err = client.Database("club").Collection("fees").FindOne(ctx, bson.D{
-		bson.E{Key: "year", Value: f.Year},
-		bson.E{Key: "semester", Value: f.Semester}}).Decode(f); err == mongo.ErrNoDocuments {
+func (f *Fee) Search(ctx context.Context) (carryOver int, _ []map[string]interface{}, total int, err error) {
+	fee, err := feeStore.Get(ctx, f.Year, f.Semester)
+	if err == ErrNotFound {
 		return 0, Logs{}.Public(), 0, nil
 	} else if err != nil {
 		return
 	}
+	*f = *fee
 
-	filter := func() bson.D {
-		arr := make(bson.A, len(f.Logs))
-		for idx, logID := range f.Logs {
-			arr[idx] = logID
-		}
-		return bson.D{
-			bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}},
-			bson.E{Key: "$or", Value: bson.A{
-				bson.D{bson.E{Key: "type", Value: payment}},
-				bson.D{bson.E{Key: "type", Value: deposit}}}}}
-	}()
-
-	cur, err := client.Database("club").Collection("logs").Find(ctx, filter)
+	logs, err := logStore.Find(ctx, LogFilter{IDs: f.logIDs(), Types: []int{payment, deposit, expense}})
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
 		return
 	}
 
-	total = f.CarryOver
-	log := new(Log)
-	var logs Logs
-
-	for cur.Next(ctx) {
-		if err = cur.Decode(log); err != nil {
-			return
-		}
-		logs = append(logs, *log)
-		total += log.Amount
+	// the total is the cash of the semester, including the carry-over
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: f.Year, Semester: f.Semester})
+	if err != nil {
+		return
 	}
+	total = entries.balance(Cash)
 
 	sort.Slice(logs, func(i, j int) bool { return logs[i].CreatedAt < logs[j].CreatedAt })
 
-	return f.CarryOver, logs.Public(), total, cur.Close(ctx)
+	return f.CarryOver, logs.Public(), total, nil
 }
 
-// Pay registers payments of members of ids for each amount of amounts.
+// Pay registers payments of members of ids for each amount of amounts,
+// to the fee item of item, or to the semester dues if item is nil.
+// The payments are registered all together, or not at all.
 //
 // Note:
 //
 // It is a privileged operation:
 // 	Only the club managers can access to this operation.
-func Pay(year, semester int, ids []string, amounts []int) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
+func Pay(ctx context.Context, year, semester int, item *primitive.ObjectID, ids []string, amounts []int) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
 
-	fee := new(Fee)
-	if err = client.Database("club").Collection("fees").FindOne(ctx, bson.M{"year": year, "semester": semester}).Decode(fee); err != nil {
-		return err
-	}
+		description := "회비 납부"
+		if item != nil {
+			it, err := fee.item(*item)
+			if err != nil {
+				return err
+			}
+			description = it.Name + " 납부"
+		}
 
-	logs := make(bson.A, len(ids))
-	logIDs := make([]primitive.ObjectID, len(ids))
-	for idx, id := range ids {
-		log := NewLog(id, "회비 납부", amounts[idx], payment)
-		logs[idx] = log
-		logIDs[idx] = log.ID
-	}
+		logs := make(Logs, len(ids))
+		for idx, id := range ids {
+			logs[idx] = *NewLog(id, description, amounts[idx], payment)
+			logs[idx].Item = item
+		}
+		return fee.pay(ctx, logs...)
+	})
+}
 
-	if _, err = client.Database("club").Collection("logs").InsertMany(ctx, logs); err != nil {
+// pay records the payment logs to f, with the audit entries of them.
+func (f Fee) pay(ctx context.Context, logs ...Log) error {
+	if err := f.record(ctx, logs...); err != nil {
 		return err
 	}
 
-	_, err = client.Database("club").Collection("fees").UpdateOne(ctx, bson.M{"year": year, "semester": semester}, bson.D{
-		bson.E{Key: "$push", Value: bson.D{
-			bson.E{Key: "logs", Value: bson.D{
-				bson.E{Key: "$each", Value: logIDs}}}}}})
-	return err
+	for _, log := range logs {
+		if err := audit.Record(ctx, audit.FeePay, audit.Target("member", log.MemberID), nil, logState{f.Year, f.Semester, log}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Deposit makes a new log with amount and append it to fee with year of YEAR, semester of SEMESTER.
@@ -409,69 +327,339 @@ func Pay(year, semester int, ids []string, amounts []int) error {
 //
 // It is a privileged operation:
 // 	Only the club managers can access to this operation.
-func Deposit(year, semester, amount int, description string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
-
+func Deposit(ctx context.Context, year, semester, amount int, description string) error {
 	log := NewLog("", description, amount, deposit)
 
-	if _, err = client.Database("club").
-		Collection("logs").
-		InsertOne(ctx, log); err != nil {
-		return err
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if err = fee.record(ctx, *log); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeDeposit, target(year, semester), nil, logState{year, semester, *log})
+	})
+}
+
+// Expend records the expense log to the fee of year and semester.
+// The amount of log is positive, and subtracted from the total of the fee.
+// It returns ErrInvalidExpense if the amount is not positive,
+// or the category, the payee or the approver is missing.
+//
+// Note:
+//
+// It is a privileged operation:
+// 	Only the club managers can access to this operation.
+func Expend(ctx context.Context, year, semester int, log Log) error {
+	switch {
+	case log.Amount <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidExpense)
+	case log.Category == "":
+		return fmt.Errorf("%w: category is required", ErrInvalidExpense)
+	case log.Payee == "":
+		return fmt.Errorf("%w: payee is required", ErrInvalidExpense)
+	case log.ApprovedBy == "":
+		return fmt.Errorf("%w: approver is required", ErrInvalidExpense)
+	}
+	log = *NewExpense(log.Description, log.Category, log.Payee, log.Receipt, log.ApprovedBy, log.Amount)
+
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if err = fee.record(ctx, log); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeExpend, target(year, semester), nil, logState{year, semester, log})
+	})
+}
+
+// Expenses returns the expense logs of the fee of year and semester in chronological order.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Expenses(ctx context.Context, year, semester int) (Logs, error) {
+	fee, err := feeStore.Get(ctx, year, semester)
+	if err == ErrNotFound {
+		return Logs{}, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	_, err = client.Database("club").Collection("fees").UpdateOne(ctx,
-		bson.D{bson.E{Key: "year", Value: year}, bson.E{Key: "semester", Value: semester}},
-		bson.D{bson.E{Key: "$push", Value: bson.D{bson.E{Key: "logs", Value: log.ID}}}})
-	return err
+	logs, err := logStore.Find(ctx, LogFilter{IDs: fee.logIDs(), Types: []int{expense}})
+	if err != nil {
+		return nil, err
+	}
+	if logs == nil {
+		logs = Logs{}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].CreatedAt < logs[j].CreatedAt })
+	return logs, nil
 }
 
-// Exempt exempts the member of id from the fee of year and semester.
+// Exempt exempts the member of id from the fee of year and semester, as much as the member owes by the policy of the fee.
+// It returns ErrAlreadyExempted if the member is exempted already, or owes nothing by the policy.
 //
 // Note :
 //
 // It is a privileged operation:
 // 	Only the club managers can access to this operation.
-func (f *Fee) Exempt(id string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func (f *Fee) Exempt(ctx context.Context, id string) error {
+	// the exemption is checked in the transaction, so that a member is never exempted twice
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, f.Year, f.Semester)
+		if err != nil {
+			return err
+		}
+		*f = *fee
+
+		logs, err := logStore.Find(ctx, LogFilter{IDs: f.logIDs(), MemberIDs: []string{id}, Types: []int{exemption}})
+		if err != nil {
+			return err
+		}
+		if len(logs.effective()) != 0 {
+			return ErrAlreadyExempted
+		}
+
+		entries, err := duesEntries(ctx, f.Year, f.Semester)
+		if err != nil {
+			return err
+		}
+		owed, err := f.owed(ctx, entries, []string{id})
+		if err != nil {
+			return err
+		}
+		if owed[id] == 0 {
+			return ErrAlreadyExempted
+		}
+
+		log := NewLog(id, "회비 면제", owed[id], exemption)
+		if err = f.record(ctx, *log); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeExempt, audit.Target("member", id), nil, logState{f.Year, f.Semester, *log})
+	})
+}
+
+// Reverse cancels the log of id in the fee of year and semester for reason,
+// by recording a reversal which references the log and has the negated amount.
+// The log is kept in the history, but no longer counts in the amounts, the payers, the deptors and the total.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Reverse(ctx context.Context, year, semester int, id primitive.ObjectID, reason string) (reversal *Log, err error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrInvalidReversal)
+	}
+
+	err = transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if !containsID(fee.Logs, id) {
+			return ErrLogNotFound
+		}
+
+		logs, err := logStore.Find(ctx, LogFilter{IDs: fee.logIDs()})
+		if err != nil {
+			return err
+		}
+
+		var log *Log
+		for idx := range logs {
+			if logs[idx].Reverses != nil && *logs[idx].Reverses == id {
+				return ErrAlreadyReversed
+			}
+			if logs[idx].ID == id {
+				log = &logs[idx]
+			}
+		}
+		if log == nil {
+			return ErrLogNotFound
+		}
+		if log.Reverses != nil {
+			return fmt.Errorf("%w: a reversal cannot be reversed", ErrInvalidReversal)
+		}
+
+		reversal = log.reversal(reason)
+		if err = fee.record(ctx, *reversal); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeReverse, audit.Target("fee-log", id.Hex()), logState{year, semester, *log}, logState{year, semester, *reversal})
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer client.Disconnect(ctx)
+	return
+}
+
+// Revoke revokes the exemption of the member of id from f for reason,
+// by reversing the exemption log.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func (f *Fee) Revoke(ctx context.Context, id, reason string) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, f.Year, f.Semester)
+		if err != nil {
+			return err
+		}
+		*f = *fee
 
-	db := client.Database("club")
-	feeCollection := db.Collection("fees")
-	logCollection := db.Collection("logs")
+		logs, err := logStore.Find(ctx, LogFilter{IDs: f.logIDs(), MemberIDs: []string{id}, Types: []int{exemption}})
+		if err != nil {
+			return err
+		}
+		if logs = logs.effective(); len(logs) == 0 {
+			return ErrNotExempted
+		}
 
-	if err = feeCollection.FindOne(ctx, bson.D{bson.E{Key: "year", Value: f.Year}, bson.E{Key: "semester", Value: f.Semester}}).Decode(f); err != nil {
+		_, err = Reverse(ctx, f.Year, f.Semester, logs[0].ID, reason)
 		return err
-	}
+	})
+}
 
-	log := new(Log)
-	filter := bson.D{
-		bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: f.Logs}}},
-		bson.E{Key: "member_id", Value: id},
-		bson.E{Key: "type", Value: exemption},
+// record appends logs to f, and posts their journal entries.
+// The members who pay or are exempted for the first time are charged with f as well.
+// It returns ErrClosedFee if f is closed.
+func (f Fee) record(ctx context.Context, logs ...Log) error {
+	if f.Closed {
+		return ErrClosedFee
+	}
+
+	ids := make([]primitive.ObjectID, len(logs))
+	members := []string{}
+	items := make(map[primitive.ObjectID][]string)
+	for idx, log := range logs {
+		ids[idx] = log.ID
+		if log.Type != payment && log.Type != exemption {
+			continue
+		}
+		if log.Item == nil {
+			members = append(members, log.MemberID)
+		} else {
+			items[*log.Item] = append(items[*log.Item], log.MemberID)
+		}
 	}
 
-	if err = logCollection.FindOne(ctx, filter).Decode(log); err == nil {
-		return ErrAlreadyExempted
+	dues, err := f.dues(ctx, members)
+	if err != nil {
+		return err
+	}
+	entries, err := charges(ctx, f.Year, f.Semester, dues, members)
+	if err != nil {
+		return err
 	}
-	if err == mongo.ErrNoDocuments {
-		log = NewLog(id, "회비 면제", f.Amount, exemption)
-		if _, err = logCollection.InsertOne(ctx, log); err != nil {
+	for _, item := range f.Items {
+		if _, ok := items[item.ID]; !ok {
+			continue
+		}
+		charged, err := item.charges(ctx, f.Year, f.Semester, items[item.ID])
+		if err != nil {
 			return err
 		}
-		_, err = feeCollection.UpdateOne(ctx,
-			bson.D{bson.E{Key: "year", Value: f.Year}, bson.E{Key: "semester", Value: f.Semester}},
-			bson.D{bson.E{Key: "$push", Value: bson.D{bson.E{Key: "logs", Value: log.ID}}}})
+		entries = append(entries, charged...)
+		delete(items, item.ID)
+	}
+	if len(items) != 0 {
+		return ErrItemNotFound
+	}
+
+	for _, log := range logs {
+		entries = append(entries, logEntry(f.Year, f.Semester, log))
+	}
+
+	if err = logStore.Insert(ctx, logs...); err != nil {
 		return err
 	}
-	return err
+	if err = feeStore.PushLogs(ctx, f.Year, f.Semester, ids); err != nil {
+		return err
+	}
+	return post(ctx, entries...)
 }
+
+// Check returns the orphaned logs, which belong to no fee.
+// They are left by the failures between inserting logs and appending them to a fee,
+// and never count toward any total. If repair, the orphaned logs are deleted.
+//
+// NOTE:
+//
+// It is a privileged operation:
+// 	Only the club managers can access to this operation.
+func Check(ctx context.Context, repair bool) (orphans Logs, err error) {
+	err = transactor.Transaction(ctx, func(ctx context.Context) error {
+		fees, err := feeStore.Find(ctx)
+		if err != nil {
+			return err
+		}
+
+		owned := make(map[primitive.ObjectID]bool)
+		for _, fee := range fees {
+			for _, id := range fee.Logs {
+				owned[id] = true
+			}
+		}
+
+		logs, err := logStore.Find(ctx, LogFilter{})
+		if err != nil {
+			return err
+		}
+
+		orphans = Logs{}
+		ids := []primitive.ObjectID{}
+		for _, log := range logs {
+			if !owned[log.ID] {
+				orphans = append(orphans, log)
+				ids = append(ids, log.ID)
+			}
+		}
+
+		if !repair || len(orphans) == 0 {
+			return nil
+		}
+		if err = logStore.Delete(ctx, LogFilter{IDs: ids}); err != nil {
+			return err
+		}
+
+		entryIDs := make([]string, len(ids))
+		for idx, id := range ids {
+			entryIDs[idx] = id.Hex()
+		}
+		if err = journalStore.Delete(ctx, EntryFilter{IDs: entryIDs}); err != nil {
+			return err
+		}
+		for _, orphan := range orphans {
+			if err = audit.Record(ctx, audit.FeeRepair, audit.Target("fee-log", orphan.ID.Hex()), orphan, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// logIDs returns the log IDs of f, which is never nil
+// so that it always restricts a LogFilter.
+func (f Fee) logIDs() []primitive.ObjectID {
+	return append([]primitive.ObjectID{}, f.Logs...)
+}
+
+// logState is the audit snapshot of a log of the fee of year and semester.
+type logState struct {
+	Year     int `json:"year"`
+	Semester int `json:"semester"`
+	Log
+}
+
+// target returns the audit target of the fee of year and semester.
+func target(year, semester int) string { return audit.Target("fee", fmt.Sprintf("%d-%d", year, semester)) }
@@ -15,17 +15,48 @@
 package fee_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/kmu-kcc/buddy-backend/config"
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/bank"
 	"github.com/kmu-kcc/buddy-backend/pkg/fee"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ctx             = context.Background()
+	memberStore     = member.NewMemoryStore()
+	feeStore        = fee.NewMemoryFeeStore()
+	logStore        = fee.NewMemoryLogStore()
+	journalStore    = fee.NewMemoryJournalStore()
+	remittanceStore = fee.NewMemoryRemittanceStore()
+	receiptStore    = fee.NewMemoryReceiptStore()
+	transactor      = fee.NewMemoryTransactor(feeStore, logStore, journalStore, remittanceStore, receiptStore)
+)
+
+func TestMain(m *testing.M) {
+	member.SetStore(memberStore)
+	fee.SetStore(feeStore, logStore, journalStore, remittanceStore, receiptStore, transactor)
+	audit.SetStore(audit.NewMemoryStore())
+	rbac.SetStore(rbac.NewMemoryRoleStore(), rbac.NewMemoryGrantStore())
+
+	for _, f := range []*fee.Fee{fee.New(2021, 1, 0, 15000), fee.New(2021, 4, 0, 15000)} {
+		if err := f.Create(ctx); err != nil {
+			panic(err)
+		}
+	}
+	os.Exit(m.Run())
+}
+
 func TestCreate(t *testing.T) {
 	fees := []*fee.Fee{
 		fee.New(2022, 1, 0, 30000),
@@ -33,48 +64,37 @@ func TestCreate(t *testing.T) {
 	}
 
 	for _, fee := range fees {
-		if err := fee.Create(); err != nil {
+		if err := fee.Create(ctx); err != nil {
 			t.Error(err)
 		}
 	}
-}
-
-func TestAmount(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
+	if err := fees[0].Create(ctx); err != fee.ErrDuplicatedFee {
+		t.Errorf("expected %v, got %v", fee.ErrDuplicatedFee, err)
 	}
+}
 
-	log1 := fee.NewLog("abc", "회비 납부", 20000, 0)
-	log2 := fee.NewLog("abc", "회비 납부", 30000, 0)
-
-	testFee := new(fee.Fee)
-	testFee.Year = 2022
-	testFee.Semester = 2
-	testFee.Amount = 30000
-	testFee.Logs = []primitive.ObjectID{log1.ID, log2.ID}
-
-	if _, err := client.Database("club").Collection("logs").InsertMany(ctx, []interface{}{log1, log2}); err != nil {
-		t.Error(err)
+func TestAmount(t *testing.T) {
+	if err := fee.New(2023, 2, 0, 30000).Create(ctx); err != nil {
+		t.Fatal(err)
 	}
-	if _, err := client.Database("club").Collection("fees").InsertOne(ctx, testFee); err != nil {
-		t.Error(err)
+	for _, amount := range []int{20000, 30000} {
+		if err := fee.Pay(ctx, 2023, 2, nil, []string{"abc"}, []int{amount}); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	sum, err := fee.Amount(2022, 2, "abc")
+	sum, err := fee.Amount(ctx, 2023, 2, "abc")
 	if err != nil {
 		t.Error(err)
-	} else {
-		t.Log(sum)
+	} else if sum != 50000 {
+		t.Errorf("expected 50000, got %d", sum)
 	}
 }
 
 func TestPayers(t *testing.T) {
 	f := fee.Fee{Year: 2021, Semester: 1}
-	if members, err := f.Payers(); err != nil {
+	if members, err := f.Payers(ctx); err != nil {
 		t.Error(err)
 	} else {
 		t.Log(members)
@@ -83,7 +103,7 @@ func TestPayers(t *testing.T) {
 
 func TestDeptors1(t *testing.T) {
 	f := fee.Fee{Year: 2021, Semester: 1}
-	if members, a, err := f.Deptors(); err != nil {
+	if members, a, err := f.Deptors(ctx); err != nil {
 		t.Error(err)
 	} else {
 		t.Log(members, a)
@@ -92,7 +112,7 @@ func TestDeptors1(t *testing.T) {
 
 func TestSearch(t *testing.T) {
 	f := fee.Fee{Year: 2021, Semester: 1}
-	if a, logs, b, err := f.Search(); err != nil {
+	if a, logs, b, err := f.Search(ctx); err != nil {
 		t.Error(err)
 	} else {
 		t.Log(a, logs, b)
@@ -100,47 +120,864 @@ func TestSearch(t *testing.T) {
 }
 
 func TestPay(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+	testLog := fee.NewLog("20181681", "회비 납부", 0, 0)
+	testLog2 := fee.NewLog("20181682", "회비 납부", 0, 0)
+
+	if err := fee.Pay(ctx, 2021, 4, nil, []string{testLog.MemberID, testLog2.MemberID}, []int{10000, 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sum, err := fee.Amount(ctx, 2021, 4, testLog.MemberID); err != nil {
+		t.Fatal(err)
+	} else if sum != 10000 {
+		t.Errorf("expected 10000, got %d", sum)
+	}
+}
+
+func TestDeposit(t *testing.T) {
+	if err := fee.Deposit(ctx, 2021, 4, 100, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, total, err := fee.New(2021, 4, 0, 0).Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if total != 11100 {
+		t.Errorf("expected 11100, got %d", total)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	if err := fee.New(2021, 1, 100000, 15000).Exempt(ctx, "20210001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.New(2021, 1, 100000, 15000).Exempt(ctx, "20210001"); err != fee.ErrAlreadyExempted {
+		t.Errorf("expected %v, got %v", fee.ErrAlreadyExempted, err)
+	}
+}
+
+func TestExpend(t *testing.T) {
+	if err := fee.New(2030, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Deposit(ctx, 2030, 1, 1000, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	invalids := []*fee.Log{
+		fee.NewExpense("snack", "food", "mart", "", "20210001", 0),
+		fee.NewExpense("snack", "", "mart", "", "20210001", 300),
+		fee.NewExpense("snack", "food", "", "", "20210001", 300),
+		fee.NewExpense("snack", "food", "mart", "", "", 300),
+	}
+	for _, invalid := range invalids {
+		if err := fee.Expend(ctx, 2030, 1, *invalid); !errors.Is(err, fee.ErrInvalidExpense) {
+			t.Errorf("%+v: expected %v, got %v", invalid, fee.ErrInvalidExpense, err)
+		}
+	}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+	if err := fee.Expend(ctx, 2030, 1, *fee.NewExpense("snack", "food", "mart", "R-001", "20210001", 300)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, total, err := fee.New(2030, 1, 0, 0).Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if total != 700 {
+		t.Errorf("expected 700, got %d", total)
+	}
+
+	if expenses, err := fee.Expenses(ctx, 2030, 1); err != nil {
+		t.Fatal(err)
+	} else if len(expenses) != 1 || expenses[0].Payee != "mart" || expenses[0].Balance() != -300 {
+		t.Errorf("unexpected expenses: %v", expenses)
+	}
+
+	next := fee.New(2030, 2, 0, 15000)
+	if err := next.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if carryOver, _, _, err := next.Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if carryOver != 700 {
+		t.Errorf("expected the carry-over 700, got %d", carryOver)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	if err := fee.Deposit(ctx, 1999, 1, 100, "test"); err != fee.ErrNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrNotFound, err)
+	}
+
+	errAbort := errors.New("abort")
+	log := fee.NewLog("", "test", 100, 1)
+
+	if err := transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := logStore.Insert(ctx, *log); err != nil {
+			return err
+		}
+		return errAbort
+	}); err != errAbort {
+		t.Fatalf("expected %v, got %v", errAbort, err)
+	}
+
+	if logs, err := logStore.Find(ctx, fee.LogFilter{IDs: []primitive.ObjectID{log.ID}}); err != nil {
+		t.Fatal(err)
+	} else if len(logs) != 0 {
+		t.Errorf("expected the log to be rolled back, got %v", logs)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	orphan := fee.NewLog("20210001", "회비 납부", 15000, 0)
+	if err := logStore.Insert(ctx, *orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := fee.Check(ctx, false)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(orphans) != 1 || orphans[0].ID != orphan.ID {
+		t.Fatalf("expected the orphan %v, got %v", orphan.ID, orphans)
+	}
 
-	testLog := fee.NewLog("20181681", "회비 납부", 0, 0)
-	testLog2 := fee.NewLog("20181682", "회비 납부", 0, 0)
+	if _, err = fee.Check(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if orphans, err = fee.Check(ctx, false); err != nil {
+		t.Fatal(err)
+	} else if len(orphans) != 0 {
+		t.Errorf("expected no orphan, got %v", orphans)
+	}
+}
 
-	if err := fee.Pay(2021, 4, []string{testLog.MemberID, testLog2.MemberID}, []int{10000, 1000}); err != nil {
+func TestLedger(t *testing.T) {
+	// a fee made before the ledger, without any journal entry
+	log1 := fee.NewLog("20210001", "회비 납부", 20000, 0)
+	log2 := fee.NewLog("", "후원", 5000, 1)
+	legacy := fee.New(2040, 1, 1000, 15000)
+	legacy.Logs = []primitive.ObjectID{log1.ID, log2.ID}
+
+	if err := logStore.Insert(ctx, *log1, *log2); err != nil {
+		t.Fatal(err)
+	}
+	if err := feeStore.Insert(ctx, *legacy); err != nil {
 		t.Fatal(err)
 	}
 
-	if err = client.Disconnect(ctx); err != nil {
+	// the members without any log, who owed the legacy fee or were exempted as a graduate
+	debtors := member.Members{
+		{ID: "20400001", Name: "Debtor", Attendance: member.Attending, Approved: true},
+		{ID: "20400002", Name: "Graduate", Attendance: member.Graduate, Approved: true},
+	}
+	for _, m := range debtors {
+		if err := memberStore.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer memberStore.Delete(ctx, []string{"20400001", "20400002"})
+
+	for i := 0; i < 2; i++ {
+		if err := fee.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fee.Expend(ctx, 2040, 1, *fee.NewExpense("snack", "food", "mart", "", "20210001", 3000)); err != nil {
+		t.Fatal(err)
+	}
+
+	balances, err := fee.TrialBalance(ctx, 2040, 1)
+	if err != nil {
 		t.Fatal(err)
 	}
+
+	debit, credit := 0, 0
+	for _, balance := range balances {
+		debit += balance.Debit
+		credit += balance.Credit
+	}
+	if debit != credit {
+		t.Errorf("expected the debits %d to equal the credits %d", debit, credit)
+	}
+
+	lines, err := fee.Statement(ctx, fee.Cash, 2040, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 || lines[len(lines)-1].Balance != 23000 {
+		t.Errorf("expected the cash balance 23000 after 4 lines, got %v", lines)
+	}
+
+	if _, _, total, err := fee.New(2040, 1, 0, 0).Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if total != 23000 {
+		t.Errorf("expected 23000, got %d", total)
+	}
+
+	if amount, err := fee.Amount(ctx, 2040, 1, "20210001"); err != nil {
+		t.Fatal(err)
+	} else if amount != 20000 {
+		t.Errorf("expected 20000, got %d", amount)
+	}
+
+	if lines, err := fee.Statement(ctx, fee.Receivable("20400001"), 2040, 1); err != nil {
+		t.Fatal(err)
+	} else if len(lines) != 1 || lines[0].Balance != 15000 {
+		t.Errorf("expected the charge 15000 of the member without any log, got %v", lines)
+	}
+	if lines, err := fee.Statement(ctx, fee.Receivable("20400002"), 2040, 1); err != nil {
+		t.Fatal(err)
+	} else if len(lines) != 0 {
+		t.Errorf("expected no charge of the graduate, got %v", lines)
+	}
 }
 
-func TestDeposit(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
+func TestMigrate(t *testing.T) {
+	// a fee made after the ledger without the carry-over, which has no opening entry
+	if err := fee.New(2045, 1, 0, 10000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a legacy fee closed already
+	closed := fee.New(2045, 2, 0, 10000)
+	closed.Closed = true
+	if err := feeStore.Insert(ctx, *closed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the member approved after the fee was made
+	if err := memberStore.Insert(ctx, member.Member{ID: "20459999", Name: "Newcomer", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer memberStore.Delete(ctx, []string{"20459999"})
+
+	journal := func() []string {
+		ids := []string{}
+		for _, semester := range []int{1, 2} {
+			entries, err := journalStore.Find(ctx, fee.EntryFilter{Year: 2045, Semester: semester})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				ids = append(ids, entry.ID)
+			}
+		}
+		return ids
+	}
+
+	before := journal()
+	for i := 0; i < 2; i++ {
+		if err := fee.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if after := journal(); strings.Join(after, ",") != strings.Join(before, ",") {
+			t.Errorf("expected the journal %v unchanged, got %v", before, after)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	for _, semester := range []int{1, 2} {
+		if err := fee.New(2050, semester, 0, 15000).Create(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if semester == 1 {
+			if err := fee.Deposit(ctx, 2050, 1, 1000, "test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := fee.New(2051, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, semester := range []int{1, 2} {
+		if err := fee.Close(ctx, 2050, semester); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fee.Close(ctx, 2050, 1); err != fee.ErrClosedFee {
+		t.Errorf("expected %v, got %v", fee.ErrClosedFee, err)
+	}
+	if err := fee.Deposit(ctx, 2050, 1, 500, "test"); err != fee.ErrClosedFee {
+		t.Errorf("expected %v, got %v", fee.ErrClosedFee, err)
+	}
+
+	if err := fee.Reopen(ctx, 2050, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Reopen(ctx, 2050, 1); err != fee.ErrOpenFee {
+		t.Errorf("expected %v, got %v", fee.ErrOpenFee, err)
+	}
+	if err := fee.Deposit(ctx, 2050, 1, 500, "test"); err != nil {
+		t.Fatal(err)
+	}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+	links := func() map[int]fee.Link {
+		chain, err := fee.BalanceChain(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		links := make(map[int]fee.Link)
+		for _, link := range chain {
+			if link.Year >= 2050 {
+				links[link.Year*10+link.Semester] = link
+			}
+		}
+		return links
+	}
+
+	if link := links()[20502]; !link.Stale || link.CarryOver != 1000 {
+		t.Errorf("expected the stale carry-over 1000, got %+v", link)
+	}
+
+	// the later semester closed keeps its figures until it is reopened
+	if err := fee.Close(ctx, 2050, 1); !errors.Is(err, fee.ErrClosedFee) {
+		t.Errorf("expected %v, got %v", fee.ErrClosedFee, err)
+	}
+	if err := fee.Recompute(ctx, 2050, 1); !errors.Is(err, fee.ErrClosedFee) {
+		t.Errorf("expected %v, got %v", fee.ErrClosedFee, err)
+	}
+	if link := links()[20502]; !link.Closed || link.CarryOver != 1000 || link.ClosingBalance != 1000 {
+		t.Errorf("expected the closed figures kept, got %+v", link)
+	}
+
+	if err := fee.Reopen(ctx, 2050, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, semester := range []int{1, 2} {
+		if err := fee.Close(ctx, 2050, semester); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chain := links()
+	if link := chain[20501]; !link.Closed || link.ClosingBalance != 1500 || link.Income != 1500 {
+		t.Errorf("expected the closing balance 1500, got %+v", link)
+	}
+	if link := chain[20502]; link.Stale || link.CarryOver != 1500 || link.ClosingBalance != 1500 {
+		t.Errorf("expected the carry-over 1500, got %+v", link)
+	}
+	if link := chain[20511]; link.Stale || link.CarryOver != 1500 || link.Closed {
+		t.Errorf("expected the carry-over 1500, got %+v", link)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	f := fee.New(2060, 1, 0, 15000)
+	if err := f.Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Pay(ctx, 2060, 1, nil, []string{"20600001"}, []int{15000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Deposit(ctx, 2060, 1, 500, "test"); err != nil {
+		t.Fatal(err)
+	}
 
+	stored, err := feeStore.Get(ctx, 2060, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
+	logs, err := logStore.Find(ctx, fee.LogFilter{IDs: stored.Logs, MemberIDs: []string{"20600001"}})
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("expected the payment, got %v, %v", logs, err)
+	}
+	payment := logs[0]
+
+	if _, err = fee.Reverse(ctx, 2060, 1, payment.ID, " "); !errors.Is(err, fee.ErrInvalidReversal) {
+		t.Errorf("expected %v, got %v", fee.ErrInvalidReversal, err)
+	}
+	if _, err = fee.Reverse(ctx, 2060, 1, primitive.NewObjectID(), "mistake"); err != fee.ErrLogNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrLogNotFound, err)
+	}
 
-	if err := fee.Deposit(2021, 4, 100, "test"); err != nil {
+	reversal, err := fee.Reverse(ctx, 2060, 1, payment.ID, "mistake")
+	if err != nil {
 		t.Fatal(err)
 	}
+	if _, err = fee.Reverse(ctx, 2060, 1, payment.ID, "mistake"); err != fee.ErrAlreadyReversed {
+		t.Errorf("expected %v, got %v", fee.ErrAlreadyReversed, err)
+	}
+	if _, err = fee.Reverse(ctx, 2060, 1, reversal.ID, "mistake"); !errors.Is(err, fee.ErrInvalidReversal) {
+		t.Errorf("expected %v, got %v", fee.ErrInvalidReversal, err)
+	}
 
-	if err = client.Disconnect(ctx); err != nil {
+	if amount, err := fee.Amount(ctx, 2060, 1, "20600001"); err != nil {
+		t.Fatal(err)
+	} else if amount != 0 {
+		t.Errorf("expected 0, got %d", amount)
+	}
+	if _, logs, total, err := fee.New(2060, 1, 0, 0).Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if total != 500 || len(logs) != 3 {
+		t.Errorf("expected the total 500 with 3 logs, got %d with %v", total, logs)
+	}
+
+	if err = f.Revoke(ctx, "20600002", "mistake"); err != fee.ErrNotExempted {
+		t.Errorf("expected %v, got %v", fee.ErrNotExempted, err)
+	}
+	if err = f.Exempt(ctx, "20600002"); err != nil {
 		t.Fatal(err)
 	}
+	if err = f.Revoke(ctx, "20600002", "mistake"); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Exempt(ctx, "20600002"); err != nil {
+		t.Errorf("expected to exempt again, got %v", err)
+	}
 }
 
-func TestExempt(t *testing.T) {
-	if err := fee.New(2021, 1, 100000, 15000).Exempt("20210001"); err != nil {
+func TestImport(t *testing.T) {
+	for _, m := range []member.Member{
+		{ID: "20700001", Name: "홍길동", Approved: true},
+		{ID: "20700002", Name: "김철수", Approved: true},
+		{ID: "20700003", Name: "김철수", Approved: true},
+		{ID: "20700004", Name: "이영희", Approved: true},
+		{ID: "20700005", Name: "이정", Approved: true},
+	} {
+		if err := memberStore.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fee.New(2070, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	records := bank.Records{
+		{Row: 1, Date: "2070.03.02", Name: "홍길동", Amount: 15000},                   // by name
+		{Row: 2, Date: "2070.03.02", Name: "김철수", Memo: "20700003", Amount: 15000}, // by student ID
+		{Row: 3, Date: "2070.03.03", Name: "김철수", Amount: 15000},                   // same name
+		{Row: 4, Date: "2070.03.03", Name: "이영희", Amount: 10000},                   // different amount
+		{Row: 5, Date: "2070.03.04", Name: "박민수", Amount: 15000},                   // unknown
+		{Row: 6, Date: "2070.03.04", Name: "이영희", Memo: "20700004", Amount: 1},     // by student ID, different amount
+		{Row: 7, Date: "2070.03.05", Name: "이정민", Amount: 15000},                   // part of the name
+	}
+
+	remittances, err := fee.Import(ctx, 2070, 1, records)
+	if err != nil {
 		t.Fatal(err)
 	}
+
+	statuses := make([]string, len(remittances))
+	for idx, remittance := range remittances {
+		statuses[idx] = remittance.Status + ":" + remittance.MemberID
+	}
+	if strings.Join(statuses, ",") != "matched:20700001,matched:20700003,pending:,pending:,pending:,pending:,pending:" {
+		t.Errorf("unexpected statuses: %v", statuses)
+	}
+	if candidates := remittances[2].Candidates; len(candidates) != 2 {
+		t.Errorf("expected 2 candidates, got %v", candidates)
+	}
+	if candidates := remittances[5].Candidates; len(candidates) != 1 || candidates[0] != "20700004" {
+		t.Errorf("expected the candidate 20700004, got %v", candidates)
+	}
+	if candidates := remittances[6].Candidates; len(candidates) != 1 || candidates[0] != "20700005" {
+		t.Errorf("expected the candidate 20700005, got %v", candidates)
+	}
+
+	if again, err := fee.Import(ctx, 2070, 1, records); err != nil {
+		t.Fatal(err)
+	} else if len(again) != 0 {
+		t.Errorf("expected the deposits to be skipped, got %v", again)
+	}
+
+	pending, err := fee.FindRemittances(ctx, 2070, 1, []string{fee.Pending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 5 {
+		t.Fatalf("expected 5 pending remittances, got %v", pending)
+	}
+
+	if err = fee.Resolve(ctx, pending[0].ID, "20700002"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fee.Resolve(ctx, pending[0].ID, "20700002"); err != fee.ErrReviewed {
+		t.Errorf("expected %v, got %v", fee.ErrReviewed, err)
+	}
+	if err = fee.Dismiss(ctx, pending[2].ID, "not a fee"); err != nil {
+		t.Fatal(err)
+	}
+	if err = fee.Dismiss(ctx, "unknown", "not a fee"); err != fee.ErrRemittanceNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrRemittanceNotFound, err)
+	}
+
+	for id, expected := range map[string]int{"20700001": 15000, "20700002": 15000, "20700003": 15000, "20700004": 0, "20700005": 0} {
+		if amount, err := fee.Amount(ctx, 2070, 1, id); err != nil {
+			t.Fatal(err)
+		} else if amount != expected {
+			t.Errorf("%s: expected %d, got %d", id, expected, amount)
+		}
+	}
+}
+
+func TestMemberStatement(t *testing.T) {
+	if err := memberStore.Insert(ctx, member.Member{ID: "20800001", Name: "홍길동", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	for semester, amount := range []int{15000, 20000} {
+		if err := fee.New(2080, semester+1, 0, amount).Create(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fee.Pay(ctx, 2080, 1, nil, []string{"20800001"}, []int{10000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.New(2080, 2, 0, 0).Exempt(ctx, "20800001"); err != nil {
+		t.Fatal(err)
+	}
+
+	dues, err := fee.MemberStatement(ctx, "20800001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fee.Dues{
+		{Year: 2080, Semester: 1, Amount: 15000, Paid: 10000, Outstanding: 5000, Balance: 5000},
+		{Year: 2080, Semester: 2, Amount: 20000, Exempted: 20000, Balance: 5000},
+	}
+	if len(dues) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, dues)
+	}
+	for idx := range dues {
+		if dues[idx] != expected[idx] {
+			t.Errorf("expected %+v, got %+v", expected[idx], dues[idx])
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err = dues.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || lines[1] != "2080,1,15000,10000,0,5000,5000" {
+		t.Errorf("unexpected CSV: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err = dues.WritePDF(buf, "20800001", "홍길동"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("expected a PDF document")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, m := range []member.Member{
+		{ID: "20900001", Name: "Attending", Grade: 2, Attendance: member.Attending, Approved: true},
+		{ID: "20900002", Name: "Absent", Grade: 3, Attendance: member.Absent, Approved: true},
+		{ID: "20900003", Name: "Graduate", Grade: 4, Attendance: member.Graduate, Approved: true},
+		{ID: "20900004", Name: "Freshman", Grade: 1, Attendance: member.Attending, Approved: true},
+		{ID: "20900005", Name: "Officer", Grade: 2, Attendance: member.Attending, Approved: true},
+		{ID: "20900006", Name: "Scholar", Grade: 3, Attendance: member.Attending, Approved: true},
+	} {
+		if err := memberStore.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rbac.Assign(ctx, "fee-manager", []string{"20900005"}, 0, member.MASTER); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fee.New(2090, 1, 0, 20000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, depts := deptors(t, 2090, 1); depts["20900002"] != 20000 || depts["20900003"] != 0 {
+		t.Errorf("expected the default policy to exempt the graduates only, got %v", depts)
+	}
+
+	freshman := 10000
+	policy := fee.Policy{
+		Rules: []fee.Rule{
+			{Description: "휴학생 면제", Attendances: []int{member.Absent, member.Graduate}, Exempt: true},
+			{Description: "임원 반액", Roles: []string{"fee-manager"}, Rate: 50},
+			{Description: "장학생 할인", Tags: []string{"scholarship"}, Discount: 5000},
+			{Description: "신입생", Grades: []int{1}, Amount: &freshman},
+		},
+		Tags: map[string][]string{"scholarship": {"20900006"}},
+	}
+	if err := fee.SetPolicy(ctx, 2090, 1, fee.Policy{Rules: []fee.Rule{{Tags: []string{"unknown"}}}}); !errors.Is(err, fee.ErrInvalidPolicy) {
+		t.Errorf("expected %v, got %v", fee.ErrInvalidPolicy, err)
+	}
+	if err := fee.SetPolicy(ctx, 2090, 1, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"20900001": 20000, "20900002": 0, "20900003": 0, "20900004": 10000, "20900005": 10000, "20900006": 15000}
+
+	_, liabilities, err := fee.Assess(ctx, 2090, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, liability := range liabilities {
+		if amount, ok := expected[liability.MemberID]; ok && liability.Amount != amount {
+			t.Errorf("%s: expected %d, got %d by %q", liability.MemberID, amount, liability.Amount, liability.Rule)
+		}
+	}
+
+	if _, depts := deptors(t, 2090, 1); len(depts) < 4 {
+		t.Errorf("expected 4 deptors at least, got %v", depts)
+	} else {
+		for id, amount := range expected {
+			if depts[id] != amount {
+				t.Errorf("%s: expected to owe %d, got %d", id, amount, depts[id])
+			}
+		}
+	}
+
+	if err = fee.Pay(ctx, 2090, 1, nil, []string{"20900005", "20900006"}, []int{10000, 10000}); err != nil {
+		t.Fatal(err)
+	}
+	if err = fee.New(2090, 1, 0, 0).Exempt(ctx, "20900002"); err != fee.ErrAlreadyExempted {
+		t.Errorf("expected %v, got %v", fee.ErrAlreadyExempted, err)
+	}
+
+	f := fee.Fee{Year: 2090, Semester: 1}
+	payers, err := f.Payers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payers) != 1 || payers[0].ID != "20900005" {
+		t.Errorf("expected the officer to be the only payer, got %v", payers)
+	}
+	if _, depts := deptors(t, 2090, 1); depts["20900006"] != 5000 {
+		t.Errorf("expected the scholar to owe 5000, got %d", depts["20900006"])
+	}
+
+	dues, err := fee.MemberStatement(ctx, "20900004")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dues) != 1 || dues[0].Amount != 10000 {
+		t.Errorf("expected the freshman to be charged 10000, got %v", dues)
+	}
+}
+
+// deptors returns the deptors of the fee of year and semester, with the amounts they owe.
+func deptors(t *testing.T, year, semester int) (member.Members, map[string]int) {
+	t.Helper()
+
+	f := fee.Fee{Year: year, Semester: semester}
+	members, amounts, err := f.Deptors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	depts := make(map[string]int)
+	for idx, member := range members {
+		depts[member.ID] = amounts[idx]
+	}
+	return members, depts
+}
+
+func TestItems(t *testing.T) {
+	for _, m := range []member.Member{
+		{ID: "21000001", Name: "Test1", Approved: true},
+		{ID: "21000002", Name: "Test2", Approved: true},
+		{ID: "21000003", Name: "Test3", Approved: true},
+	} {
+		if err := memberStore.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fee.New(2100, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fee.AddItem(ctx, 2100, 1, fee.Item{Name: "MT", Category: "mt"}); !errors.Is(err, fee.ErrInvalidItem) {
+		t.Errorf("expected %v, got %v", fee.ErrInvalidItem, err)
+	}
+	mt, err := fee.AddItem(ctx, 2100, 1, fee.Item{Name: "MT", Category: "mt", Amount: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shirt, err := fee.AddItem(ctx, 2100, 1, fee.Item{Name: "T-shirt", Category: "goods", Amount: 12000, Targets: []string{"21000001", "21000002"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if items, err := fee.FindItems(ctx, 2100, 1); err != nil {
+		t.Fatal(err)
+	} else if len(items) != 2 {
+		t.Errorf("expected 2 items, got %v", items)
+	}
+
+	unknown := primitive.NewObjectID()
+	if err = fee.Pay(ctx, 2100, 1, &unknown, []string{"21000001"}, []int{50000}); err != fee.ErrItemNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrItemNotFound, err)
+	}
+	if err = fee.Pay(ctx, 2100, 1, &mt.ID, []string{"21000001", "21000002"}, []int{50000, 20000}); err != nil {
+		t.Fatal(err)
+	}
+	if err = fee.Pay(ctx, 2100, 1, &shirt.ID, []string{"21000001"}, []int{12000}); err != nil {
+		t.Fatal(err)
+	}
+
+	payers, err := fee.ItemPayers(ctx, 2100, 1, mt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payers) != 1 || payers[0].ID != "21000001" {
+		t.Errorf("expected 21000001 to be the only payer of MT, got %v", payers)
+	}
+
+	shirtDeptors, depts, err := fee.ItemDeptors(ctx, 2100, 1, shirt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shirtDeptors) != 1 || shirtDeptors[0].ID != "21000002" || depts[0] != 12000 {
+		t.Errorf("expected 21000002 to owe 12000 for the T-shirt, got %v, %v", shirtDeptors, depts)
+	}
+
+	// the items count in the semester ledger, but not in the semester dues
+	if amount, err := fee.Amount(ctx, 2100, 1, "21000001"); err != nil {
+		t.Fatal(err)
+	} else if amount != 0 {
+		t.Errorf("expected no payment of the dues, got %d", amount)
+	}
+	if _, _, total, err := fee.New(2100, 1, 0, 0).Search(ctx); err != nil {
+		t.Fatal(err)
+	} else if total != 82000 {
+		t.Errorf("expected the total 82000, got %d", total)
+	}
+	if _, depts := deptors(t, 2100, 1); depts["21000001"] != 15000 {
+		t.Errorf("expected 21000001 to owe the dues 15000, got %d", depts["21000001"])
+	}
+}
+
+func TestAttach(t *testing.T) {
+	if err := fee.New(2110, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Pay(ctx, 2110, 1, nil, []string{"21100001"}, []int{15000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Deposit(ctx, 2110, 1, 500, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := feeStore.Get(ctx, 2110, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := logStore.Find(ctx, fee.LogFilter{IDs: stored.Logs})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("expected the payment and the deposit, got %v, %v", logs, err)
+	}
+	payment, deposit := logs[0], logs[1]
+
+	if file := fee.NewAttachment("dir/영수증.jpg"); !strings.HasSuffix(string(file), "-영수증.jpg") {
+		t.Errorf("expected the base name with a prefix, got %s", file)
+	}
+
+	defer func(prefix string) { activity.FilePathPrefix = prefix }(activity.FilePathPrefix)
+	activity.FilePathPrefix = t.TempDir()
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	// the rejected attachments are not saved
+	for _, tc := range []struct {
+		id       primitive.ObjectID
+		filename string
+		content  string
+		expected error
+	}{
+		{deposit.ID, "영수증.exe", png, fee.ErrInvalidAttachment},
+		{deposit.ID, "영수증.jpg", "<html><script></script></html>", fee.ErrInvalidAttachment},
+		{deposit.ID, "영수증.pdf", png, fee.ErrInvalidAttachment},
+		{deposit.ID, "영수증.png", png + strings.Repeat("\x00", fee.MaxAttachmentSize), fee.ErrInvalidAttachment},
+		{deposit.ID, "영수증.png", "", fee.ErrInvalidAttachment},
+		{payment.ID, "영수증.png", png, fee.ErrInvalidAttachment},
+		{primitive.NewObjectID(), "영수증.png", png, fee.ErrLogNotFound},
+	} {
+		if _, err = fee.Attach(ctx, 2110, 1, tc.id, tc.filename, strings.NewReader(tc.content)); !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.filename, tc.expected, err)
+		}
+	}
+	if files, err := ioutil.ReadDir(activity.FilePathPrefix); err != nil || len(files) != 0 {
+		t.Errorf("expected no files saved, got %v, %v", files, err)
+	}
+
+	receipt, err := fee.Attach(ctx, 2110, 1, deposit.ID, "dir/영수증.PNG", strings.NewReader(png))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := ioutil.ReadFile(receipt.Absolute()); err != nil || string(saved) != png {
+		t.Errorf("expected the attachment saved, got %q, %v", saved, err)
+	}
+	if _, err = fee.Attach(ctx, 2110, 1, deposit.ID, "명세서.pdf", strings.NewReader("%PDF-1.4\n")); err != nil {
+		t.Error(err)
+	}
+
+	if file, err := fee.Attachment(ctx, 2110, 1, deposit.ID, string(receipt)); err != nil || file != receipt {
+		t.Errorf("expected %s, got %s, %v", receipt, file, err)
+	}
+	if _, err = fee.Attachment(ctx, 2110, 1, deposit.ID, "other.jpg"); err != fee.ErrAttachmentNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrAttachmentNotFound, err)
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	for _, m := range []member.Member{
+		{ID: "21200001", Name: "홍길동", Approved: true},
+		{ID: "21200002", Name: "김철수", Approved: true},
+	} {
+		if err := memberStore.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fee.New(2120, 1, 0, 15000).Create(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := fee.Pay(ctx, 2120, 1, nil, []string{"21200001", "21200002"}, []int{15000, 15000}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := feeStore.Get(ctx, 2120, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := logStore.Find(ctx, fee.LogFilter{IDs: stored.Logs})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("expected the payments, got %v, %v", logs, err)
+	}
+
+	if _, err = fee.IssueReceipt(ctx, 2120, 1, logs[0].ID, "21200002"); err != fee.ErrLogNotFound {
+		t.Errorf("expected %v, got %v", fee.ErrLogNotFound, err)
+	}
+
+	first, err := fee.IssueReceipt(ctx, 2120, 1, logs[0].ID, "21200001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fee.IssueReceipt(ctx, 2120, 1, logs[1].ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Number != first.Number+1 || first.Name != "홍길동" || first.Amount != 15000 {
+		t.Errorf("expected the sequential receipts, got %+v and %+v", first, second)
+	}
+
+	// the receipt issued already is returned again
+	if again, err := fee.IssueReceipt(ctx, 2120, 1, logs[0].ID, ""); err != nil || again.Number != first.Number {
+		t.Errorf("expected the receipt %d, got %+v, %v", first.Number, again, err)
+	}
+
+	if receipts, err := fee.FindReceipts(ctx, fee.ReceiptFilter{MemberID: "21200002"}); err != nil || len(receipts) != 1 || receipts[0].Number != second.Number {
+		t.Errorf("expected the receipt %d, got %v, %v", second.Number, receipts, err)
+	}
+
+	reversal, err := fee.Reverse(ctx, 2120, 1, logs[1].ID, "mistake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fee.IssueReceipt(ctx, 2120, 1, reversal.ID, ""); !errors.Is(err, fee.ErrInvalidReceipt) {
+		t.Errorf("expected %v, got %v", fee.ErrInvalidReceipt, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = first.WritePDF(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("expected a PDF, got %q", buf.Bytes()[:8])
+	}
 }
@@ -0,0 +1,273 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidItem  = errors.New("invalid fee item")
+	ErrItemNotFound = errors.New("fee item not found")
+)
+
+// Item represents a fee item of a semester other than the semester dues, like an MT trip or a T-shirt order.
+// The payments of an item are recorded in the fee of its semester, so that the semester ledger aggregates them.
+type Item struct {
+	ID        primitive.ObjectID `json:"id" bson:"id"`
+	Name      string             `json:"name" bson:"name"`
+	Category  string             `json:"category" bson:"category"`
+	Amount    int                `json:"amount" bson:"amount"` // amount each target member owes
+	DueDate   int64              `json:"due_date,string" bson:"due_date"`
+	Targets   []string           `json:"targets" bson:"targets"` // student IDs of the target members (every approved member if empty)
+	CreatedAt int64              `json:"created_at,string" bson:"created_at"`
+}
+
+type Items []Item
+
+// NewItem returns a new fee item.
+func NewItem(name, category string, amount int, dueDate int64, targets []string) *Item {
+	if targets == nil {
+		targets = []string{}
+	}
+	return &Item{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Category:  category,
+		Amount:    amount,
+		DueDate:   dueDate,
+		Targets:   targets,
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// validate returns ErrInvalidItem if i lacks the name, the category or a positive amount.
+func (i Item) validate() error {
+	switch {
+	case strings.TrimSpace(i.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidItem)
+	case strings.TrimSpace(i.Category) == "":
+		return fmt.Errorf("%w: category is required", ErrInvalidItem)
+	case i.Amount <= 0:
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidItem)
+	}
+	return nil
+}
+
+// clone returns a deep copy of i.
+func (i Item) clone() Item {
+	i.Targets = append([]string{}, i.Targets...)
+	return i
+}
+
+// targeted reports whether the member of id is a target of i.
+func (i Item) targeted(id string) bool {
+	return len(i.Targets) == 0 || containsString(i.Targets, id)
+}
+
+// chargeID returns the ID of the charge entry of the member of id for i of the fee of year and semester.
+func (i Item) chargeID(year, semester int, id string) string {
+	return chargeID(year, semester, id) + ":" + i.ID.Hex()
+}
+
+// chargeEntry returns the entry charging the member of id with i of the fee of year and semester.
+func (i Item) chargeEntry(year, semester int, id string) Entry {
+	entry := transfer(i.chargeID(year, semester, id), year, semester, i.Name+" 부과", Receivable(id), ItemRevenue(i.Category), i.Amount, time.Now().Unix())
+	entry.Item = i.ID.Hex()
+	return entry
+}
+
+// charges returns the entries charging the members of ids with i of the fee of year and semester,
+// except the members already charged.
+func (i Item) charges(ctx context.Context, year, semester int, ids []string) (Entries, error) {
+	entries := make(Entries, len(ids))
+	for idx, id := range ids {
+		entries[idx] = i.chargeEntry(year, semester, id)
+	}
+	return unposted(ctx, entries)
+}
+
+// item returns the item of id of f, or ErrItemNotFound.
+func (f Fee) item(id primitive.ObjectID) (*Item, error) {
+	for idx := range f.Items {
+		if f.Items[idx].ID == id {
+			return &f.Items[idx], nil
+		}
+	}
+	return nil, ErrItemNotFound
+}
+
+// AddItem adds item to the fee of year and semester,
+// and charges the target members with it.
+// It returns ErrInvalidItem if the name, the category or a positive amount of item is missing.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func AddItem(ctx context.Context, year, semester int, item Item) (*Item, error) {
+	if err := item.validate(); err != nil {
+		return nil, err
+	}
+	item = *NewItem(item.Name, item.Category, item.Amount, item.DueDate, item.Targets)
+
+	ids := item.Targets
+	if len(ids) == 0 {
+		var err error
+		if ids, err = chargeable(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	err := transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if fee.Closed {
+			return ErrClosedFee
+		}
+
+		if err = feeStore.Update(ctx, year, semester, map[string]interface{}{"items": append(fee.Items, item)}); err != nil {
+			return err
+		}
+		entries, err := item.charges(ctx, year, semester, ids)
+		if err != nil {
+			return err
+		}
+		if err = post(ctx, entries...); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeItem, target(year, semester), nil, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FindItems returns the items of the fee of year and semester.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to this operation.
+func FindItems(ctx context.Context, year, semester int) (Items, error) {
+	fee, err := feeStore.Get(ctx, year, semester)
+	if err == ErrNotFound {
+		return Items{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if fee.Items == nil {
+		return Items{}, nil
+	}
+	return fee.Items, nil
+}
+
+// itemStatus returns the members who may owe the item of id of the fee of year and semester,
+// and the amounts each of them owes and paid.
+func itemStatus(ctx context.Context, year, semester int, id primitive.ObjectID) (members member.Members, owed, settled map[string]int, err error) {
+	fee, err := feeStore.Get(ctx, year, semester)
+	if err != nil {
+		return
+	}
+	item, err := fee.item(id)
+	if err != nil {
+		return
+	}
+
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: year, Semester: semester})
+	if err != nil {
+		return
+	}
+	entries = entries.item(id.Hex())
+	charged := entries.charged()
+	_, settled = entries.settlements()
+
+	filter := member.Filter{ExcludedIDs: []string{member.MASTER}}
+	if len(item.Targets) != 0 {
+		filter.IDs = item.Targets
+		for membID := range charged {
+			filter.IDs = append(filter.IDs, membID)
+		}
+	}
+	if members, err = member.Find(ctx, filter); err != nil {
+		return
+	}
+
+	owed = make(map[string]int, len(members))
+	for _, member := range members {
+		if amount, ok := charged[member.ID]; ok {
+			owed[member.ID] = amount
+		} else if item.targeted(member.ID) && member.Approved {
+			owed[member.ID] = item.Amount
+		}
+	}
+	return
+}
+
+// ItemPayers returns the members who paid the item of id of the fee of year and semester, as much as they owe.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func ItemPayers(ctx context.Context, year, semester int, id primitive.ObjectID) (member.Members, error) {
+	members, owed, settled, err := itemStatus(ctx, year, semester, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payers := member.Members{}
+	for _, member := range members {
+		if settled[member.ID] > 0 && owed[member.ID] <= settled[member.ID] {
+			payers = append(payers, member)
+		}
+	}
+	return payers, nil
+}
+
+// ItemDeptors returns the members who did not pay the item of id of the fee of year and semester,
+// with the amounts they owe yet.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func ItemDeptors(ctx context.Context, year, semester int, id primitive.ObjectID) (deptors member.Members, depts []int, err error) {
+	members, owed, settled, err := itemStatus(ctx, year, semester, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deptors, depts = member.Members{}, []int{}
+	for _, member := range members {
+		if dept := owed[member.ID] - settled[member.ID]; dept > 0 {
+			deptors = append(deptors, member)
+			depts = append(depts, dept)
+		}
+	}
+	return deptors, depts, nil
+}
@@ -0,0 +1,489 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+)
+
+// Account represents an account of the club ledger.
+// A sub-account is named after its parent and a colon, like "receivables:20210001".
+type Account string
+
+// The accounts of the club ledger.
+const (
+	Cash         Account = "cash"              // club cash (asset)
+	Receivables  Account = "receivables"       // fees the members owe (asset), one sub-account per member
+	Revenue      Account = "revenue"           // income of the club (revenue)
+	FeeRevenue   Account = "revenue:fee"       // fees charged to the members
+	ItemRevenues Account = "revenue:items"     // fee items charged to the members, one sub-account per category
+	OtherRevenue Account = "revenue:other"     // deposits other than the fees
+	Expenditures Account = "expenditures"      // money going out (expense), one sub-account per category
+	Exemptions   Account = "exemptions"        // fees the members are exempted from (contra-revenue)
+	Equity       Account = "equity"            // net assets of the club (equity)
+	CarryOver    Account = "equity:carry-over" // balance carried over from the previous semester
+)
+
+// ErrUnbalancedEntry is returned when the debits and the credits of a journal entry differ.
+var ErrUnbalancedEntry = errors.New("unbalanced journal entry")
+
+// Receivable returns the receivable account of the member of id.
+func Receivable(id string) Account { return Receivables + ":" + Account(id) }
+
+// ItemRevenue returns the revenue account of the fee items of category.
+func ItemRevenue(category string) Account { return ItemRevenues + ":" + Account(category) }
+
+// Expenditure returns the expenditure account of category.
+func Expenditure(category string) Account { return Expenditures + ":" + Account(category) }
+
+// Root returns the top-level account of a.
+func (a Account) Root() Account {
+	if idx := strings.Index(string(a), ":"); idx != -1 {
+		return a[:idx]
+	}
+	return a
+}
+
+// Of reports whether a is parent or a sub-account of parent.
+func (a Account) Of(parent Account) bool {
+	return a == parent || strings.HasPrefix(string(a), string(parent)+":")
+}
+
+// Balance returns the balance of a with debit and credit, on the normal side of a.
+// Assets, expenditures and exemptions are debit-normal, and revenues and equity are credit-normal.
+func (a Account) Balance(debit, credit int) int {
+	switch a.Root() {
+	case Revenue, Equity:
+		return credit - debit
+	default:
+		return debit - credit
+	}
+}
+
+// Posting represents a debit or a credit to an account.
+type Posting struct {
+	Account Account `json:"account" bson:"account"`
+	Debit   int     `json:"debit" bson:"debit"`
+	Credit  int     `json:"credit" bson:"credit"`
+}
+
+// Entry represents a journal entry of the club ledger.
+// The entry of a fee log has the hexadecimal ID of the log.
+type Entry struct {
+	ID          string    `json:"id" bson:"_id"`
+	Year        int       `json:"year" bson:"year"`
+	Semester    int       `json:"semester" bson:"semester"`
+	Item        string    `json:"item,omitempty" bson:"item,omitempty"` // hexadecimal ID of the fee item (empty for the semester dues)
+	Description string    `json:"description" bson:"description"`
+	Postings    []Posting `json:"postings" bson:"postings"`
+	CreatedAt   int64     `json:"created_at,string" bson:"created_at"`
+}
+
+type Entries []Entry
+
+// transfer returns a new entry of amount from credit to debit.
+// A negative amount is transferred the other way.
+func transfer(id string, year, semester int, description string, debit, credit Account, amount int, createdAt int64) Entry {
+	if amount < 0 {
+		debit, credit, amount = credit, debit, -amount
+	}
+	return Entry{
+		ID:          id,
+		Year:        year,
+		Semester:    semester,
+		Description: description,
+		Postings:    []Posting{{Account: debit, Debit: amount}, {Account: credit, Credit: amount}},
+		CreatedAt:   createdAt,
+	}
+}
+
+// openingEntry returns the entry of the carry-over of the fee of year and semester.
+func openingEntry(year, semester, carryOver int) Entry {
+	return transfer(fmt.Sprintf("opening:%d-%d", year, semester), year, semester, "이월", Cash, CarryOver, carryOver, time.Now().Unix())
+}
+
+// chargeID returns the ID of the charge entry of the member of id for the fee of year and semester.
+func chargeID(year, semester int, id string) string {
+	return fmt.Sprintf("charge:%d-%d:%s", year, semester, id)
+}
+
+// chargeEntry returns the entry charging the member of id with the fee of year and semester.
+func chargeEntry(year, semester, amount int, id string) Entry {
+	return transfer(chargeID(year, semester, id), year, semester, "회비 부과", Receivable(id), FeeRevenue, amount, time.Now().Unix())
+}
+
+// logEntry returns the entry of log of the fee of year and semester.
+func logEntry(year, semester int, log Log) Entry {
+	debit, credit := Cash, OtherRevenue
+
+	switch log.Type {
+	case payment:
+		debit, credit = Cash, Receivable(log.MemberID)
+	case exemption:
+		debit, credit = Exemptions, Receivable(log.MemberID)
+	case expense:
+		debit, credit = Expenditure(log.Category), Cash
+	}
+	entry := transfer(log.ID.Hex(), year, semester, log.Description, debit, credit, log.Amount, log.CreatedAt)
+	if log.Item != nil {
+		entry.Item = log.Item.Hex()
+	}
+	return entry
+}
+
+// validate returns ErrUnbalancedEntry if the debits and the credits of e differ or are empty.
+func (e Entry) validate() error {
+	var debit, credit int
+	for _, posting := range e.Postings {
+		if posting.Debit < 0 || posting.Credit < 0 || (posting.Debit != 0 && posting.Credit != 0) {
+			return fmt.Errorf("%w: %s: invalid posting to %s", ErrUnbalancedEntry, e.ID, posting.Account)
+		}
+		debit += posting.Debit
+		credit += posting.Credit
+	}
+	if debit != credit || debit == 0 {
+		return fmt.Errorf("%w: %s: debit %d, credit %d", ErrUnbalancedEntry, e.ID, debit, credit)
+	}
+	return nil
+}
+
+// post validates and inserts entries, skipping the empty ones.
+func post(ctx context.Context, entries ...Entry) error {
+	valid := make(Entries, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Postings[0].Debit == 0 {
+			continue
+		}
+		if err := entry.validate(); err != nil {
+			return err
+		}
+		valid = append(valid, entry)
+	}
+	return journalStore.Insert(ctx, valid...)
+}
+
+// charges returns the entries charging the members of ids with their dues of the fee of year and semester,
+// except the members already charged.
+func charges(ctx context.Context, year, semester int, dues map[string]int, ids []string) (Entries, error) {
+	entries := make(Entries, len(ids))
+	for idx, id := range ids {
+		entries[idx] = chargeEntry(year, semester, dues[id], id)
+	}
+	return unposted(ctx, entries)
+}
+
+// unposted returns the entries of es which are not posted yet, without the duplicates.
+func unposted(ctx context.Context, es Entries) (Entries, error) {
+	ids := make([]string, len(es))
+	for idx, entry := range es {
+		ids[idx] = entry.ID
+	}
+
+	posted, err := journalStore.Find(ctx, EntryFilter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range posted {
+		seen[entry.ID] = true
+	}
+
+	entries := Entries{}
+	for _, entry := range es {
+		if !seen[entry.ID] {
+			seen[entry.ID] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// duesEntries returns the entries of the semester dues of the fee of year and semester.
+func duesEntries(ctx context.Context, year, semester int) (Entries, error) {
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: year, Semester: semester})
+	if err != nil {
+		return nil, err
+	}
+	return entries.item(""), nil
+}
+
+// item returns the entries of es for the fee item of the hexadecimal id,
+// or for the semester dues if id is empty.
+func (es Entries) item(id string) Entries {
+	entries := Entries{}
+	for _, entry := range es {
+		if entry.Item == id {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// charged returns the amounts each member is charged with in es.
+func (es Entries) charged() map[string]int {
+	charged := make(map[string]int)
+	for _, entry := range es {
+		if !strings.HasPrefix(entry.ID, "charge:") {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			if posting.Account.Of(Receivables) && posting.Account != Receivables {
+				charged[strings.TrimPrefix(string(posting.Account), string(Receivables)+":")] += posting.Debit - posting.Credit
+			}
+		}
+	}
+	return charged
+}
+
+// settlements returns the amounts each member paid, and paid or was exempted from, in es.
+func (es Entries) settlements() (paid, settled map[string]int) {
+	paid, settled = make(map[string]int), make(map[string]int)
+
+	for _, entry := range es {
+		if strings.HasPrefix(entry.ID, "charge:") {
+			continue
+		}
+
+		cash := false
+		for _, posting := range entry.Postings {
+			cash = cash || posting.Account == Cash
+		}
+		for _, posting := range entry.Postings {
+			if !posting.Account.Of(Receivables) || posting.Account == Receivables {
+				continue
+			}
+			// a reversal debits the receivable back
+			id := strings.TrimPrefix(string(posting.Account), string(Receivables)+":")
+			settled[id] += posting.Credit - posting.Debit
+			if cash {
+				paid[id] += posting.Credit - posting.Debit
+			}
+		}
+	}
+	return
+}
+
+// balance returns the balance of account and its sub-accounts in es.
+func (es Entries) balance(account Account) (balance int) {
+	for _, entry := range es {
+		for _, posting := range entry.Postings {
+			if posting.Account.Of(account) {
+				balance += account.Balance(posting.Debit, posting.Credit)
+			}
+		}
+	}
+	return
+}
+
+// Balance represents the balance of an account.
+type Balance struct {
+	Account Account `json:"account"`
+	Debit   int     `json:"debit"`
+	Credit  int     `json:"credit"`
+	Balance int     `json:"balance"`
+}
+
+type Balances []Balance
+
+// TrialBalance returns the balances of every account in the order of the account names,
+// over the semester of year and semester, or every semester if year is zero.
+// The debits and the credits of the balances sum to the same amount.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func TrialBalance(ctx context.Context, year, semester int) (Balances, error) {
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: year, Semester: semester})
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[Account]int)
+	balances := Balances{}
+
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			idx, ok := index[posting.Account]
+			if !ok {
+				idx = len(balances)
+				index[posting.Account] = idx
+				balances = append(balances, Balance{Account: posting.Account})
+			}
+			balances[idx].Debit += posting.Debit
+			balances[idx].Credit += posting.Credit
+		}
+	}
+
+	for idx := range balances {
+		balances[idx].Balance = balances[idx].Account.Balance(balances[idx].Debit, balances[idx].Credit)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Account < balances[j].Account })
+
+	return balances, nil
+}
+
+// Line represents a line of an account statement.
+type Line struct {
+	EntryID     string  `json:"entry_id"`
+	Year        int     `json:"year"`
+	Semester    int     `json:"semester"`
+	Account     Account `json:"account"`
+	Description string  `json:"description"`
+	Debit       int     `json:"debit"`
+	Credit      int     `json:"credit"`
+	Balance     int     `json:"balance"` // running balance
+	CreatedAt   int64   `json:"created_at,string"`
+}
+
+type Lines []Line
+
+// Statement returns the postings to account and its sub-accounts in chronological order with the running balance,
+// over the semester of year and semester, or every semester if year is zero.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Statement(ctx context.Context, account Account, year, semester int) (Lines, error) {
+	entries, err := journalStore.Find(ctx, EntryFilter{Year: year, Semester: semester})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt < entries[j].CreatedAt })
+
+	lines := Lines{}
+	balance := 0
+
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if !posting.Account.Of(account) {
+				continue
+			}
+			balance += account.Balance(posting.Debit, posting.Credit)
+			lines = append(lines, Line{
+				EntryID:     entry.ID,
+				Year:        entry.Year,
+				Semester:    entry.Semester,
+				Account:     posting.Account,
+				Description: entry.Description,
+				Debit:       posting.Debit,
+				Credit:      posting.Credit,
+				Balance:     balance,
+				CreatedAt:   entry.CreatedAt,
+			})
+		}
+	}
+	return lines, nil
+}
+
+// Migrate posts the journal entries of the fees and their logs made before the ledger,
+// and marks the fees as posted.
+// The chargeable members are charged with their dues as well as the members with the payment or exemption logs,
+// so that their debts are kept.
+// It is idempotent, as the fees posted already and the closed fees are skipped.
+func Migrate(ctx context.Context) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fees, err := feeStore.Find(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, fee := range fees {
+			if fee.Posted || fee.Closed {
+				continue
+			}
+
+			posted, err := journalStore.Find(ctx, EntryFilter{Year: fee.Year, Semester: fee.Semester})
+			if err != nil {
+				return err
+			}
+			seen := make(map[string]bool)
+			for _, entry := range posted {
+				seen[entry.ID] = true
+			}
+
+			entries := Entries{}
+			add := func(entry Entry) {
+				if !seen[entry.ID] {
+					seen[entry.ID] = true
+					entries = append(entries, entry)
+				}
+			}
+
+			add(openingEntry(fee.Year, fee.Semester, fee.CarryOver))
+
+			ids, err := chargeable(ctx)
+			if err != nil {
+				return err
+			}
+			dues, err := fee.dues(ctx, ids)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if dues[id] > 0 {
+					add(chargeEntry(fee.Year, fee.Semester, dues[id], id))
+				}
+			}
+
+			logs, err := logStore.Find(ctx, LogFilter{IDs: fee.logIDs()})
+			if err != nil {
+				return err
+			}
+			for _, log := range logs {
+				if log.Type == payment || log.Type == exemption {
+					add(chargeEntry(fee.Year, fee.Semester, fee.Amount, log.MemberID))
+				}
+				add(logEntry(fee.Year, fee.Semester, log))
+			}
+
+			if err = post(ctx, entries...); err != nil {
+				return err
+			}
+			if err = feeStore.Update(ctx, fee.Year, fee.Semester, map[string]interface{}{"posted": true}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// chargeable returns the IDs of the members to be charged with a new fee, who are the approved members.
+// The policy of the fee decides the dues of each member, which may be none.
+func chargeable(ctx context.Context) ([]string, error) {
+	approved := true
+
+	members, err := member.Find(ctx, member.Filter{ExcludedIDs: []string{member.MASTER}, Approved: &approved})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(members))
+	for idx, member := range members {
+		ids[idx] = member.ID
+	}
+	return ids, nil
+}
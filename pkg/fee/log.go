@@ -18,17 +18,26 @@ package fee
 import (
 	"time"
 
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Log represents a fees history.
 type Log struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id"`
-	MemberID    string             `json:"member_id" bson:"member_id"`
-	Description string             `json:"description" bson:"description"`
-	Amount      int                `json:"amount" bson:"amount"`
-	Type        int                `json:"type" bson:"type"`
-	CreatedAt   int64              `json:"created_at,string" bson:"created_at"`
+	ID          primitive.ObjectID  `json:"id" bson:"_id"`
+	MemberID    string              `json:"member_id" bson:"member_id"`
+	Description string              `json:"description" bson:"description"`
+	Amount      int                 `json:"amount" bson:"amount"`
+	Type        int                 `json:"type" bson:"type"`
+	CreatedAt   int64               `json:"created_at,string" bson:"created_at"`
+	Category    string              `json:"category,omitempty" bson:"category,omitempty"`       // expense category
+	Payee       string              `json:"payee,omitempty" bson:"payee,omitempty"`             // whom an expense is paid to
+	Receipt     string              `json:"receipt,omitempty" bson:"receipt,omitempty"`         // receipt reference of an expense
+	ApprovedBy  string              `json:"approved_by,omitempty" bson:"approved_by,omitempty"` // student ID of the approver of an expense
+	Reverses    *primitive.ObjectID `json:"reverses,omitempty" bson:"reverses,omitempty"`       // ID of the log a reversal cancels
+	Reason      string              `json:"reason,omitempty" bson:"reason,omitempty"`           // reason of a reversal
+	Item        *primitive.ObjectID `json:"item,omitempty" bson:"item,omitempty"`               // ID of the fee item a payment applies to (nil for the semester dues)
+	Attachments activity.Files      `json:"attachments,omitempty" bson:"attachments,omitempty"` // receipt files of a deposit or an expense in the file registry
 }
 
 type Logs []Log
@@ -45,18 +54,80 @@ func NewLog(memberID, description string, amount, typ int) *Log {
 	}
 }
 
+// NewExpense returns a new expense log of amount paid to payee for category,
+// approved by the member of approver.
+func NewExpense(description, category, payee, receipt, approver string, amount int) *Log {
+	log := NewLog("", description, amount, expense)
+	log.Category = category
+	log.Payee = payee
+	log.Receipt = receipt
+	log.ApprovedBy = approver
+	return log
+}
+
+// reversal returns a new log cancelling l for reason.
+// The reversal has the type of l and the negated amount, so that the sum of both is zero.
+func (l Log) reversal(reason string) *Log {
+	log := NewLog(l.MemberID, "취소: "+l.Description, -l.Amount, l.Type)
+	log.Category = l.Category
+	log.Payee = l.Payee
+	log.Item = l.Item
+	log.Reverses = &l.ID
+	log.Reason = reason
+	return log
+}
+
+// Balance returns the amount l adds to the balance of a fee,
+// which is negative for an expense.
+func (l Log) Balance() int {
+	if l.Type == expense {
+		return -l.Amount
+	}
+	return l.Amount
+}
+
 // Public returns the limited information of l.
+// The amount of an expense is negative.
 func (l Log) Public() map[string]interface{} {
 	pub := make(map[string]interface{})
 
 	pub["description"] = l.Description
-	pub["amount"] = l.Amount
+	pub["amount"] = l.Balance()
 	pub["type"] = l.Type
 	pub["created_at"] = l.CreatedAt
 
+	if l.Type == expense {
+		pub["category"] = l.Category
+		pub["payee"] = l.Payee
+	}
+	if l.Reverses != nil {
+		pub["reason"] = l.Reason
+	}
+	if l.Item != nil {
+		pub["item"] = l.Item.Hex()
+	}
+
 	return pub
 }
 
+// effective returns the logs of ls which are neither reversals nor reversed.
+func (ls Logs) effective() Logs {
+	reversed := make(map[primitive.ObjectID]bool)
+	for _, log := range ls {
+		if log.Reverses != nil {
+			reversed[*log.Reverses] = true
+		}
+	}
+
+	logs := Logs{}
+	for _, log := range ls {
+		if log.Reverses == nil && !reversed[log.ID] {
+			logs = append(logs, log)
+		}
+	}
+	return logs
+}
+
 // Public returns the limited information of ls.
 func (ls Logs) Public() []map[string]interface{} {
 	pubs := make([]map[string]interface{}, len(ls))
@@ -0,0 +1,517 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryFeeStore is a FeeStore which keeps the fees in memory.
+// It is safe for concurrent use.
+type MemoryFeeStore struct {
+	mu   sync.RWMutex
+	fees []Fee
+}
+
+// NewMemoryFeeStore returns a new empty FeeStore.
+func NewMemoryFeeStore() *MemoryFeeStore { return &MemoryFeeStore{} }
+
+// Get implements FeeStore.
+func (s *MemoryFeeStore) Get(ctx context.Context, year, semester int) (*Fee, error) {
+	defer s.rlock(ctx)()
+
+	if idx := s.index(year, semester); idx != -1 {
+		fee := s.fees[idx].clone()
+		return &fee, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Find implements FeeStore.
+func (s *MemoryFeeStore) Find(ctx context.Context) ([]Fee, error) {
+	defer s.rlock(ctx)()
+
+	fees := make([]Fee, len(s.fees))
+	for idx, fee := range s.fees {
+		fees[idx] = fee.clone()
+	}
+	return fees, nil
+}
+
+// Insert implements FeeStore.
+func (s *MemoryFeeStore) Insert(ctx context.Context, f Fee) error {
+	defer s.lock(ctx)()
+
+	s.fees = append(s.fees, f.clone())
+	return nil
+}
+
+// PushLogs implements FeeStore.
+func (s *MemoryFeeStore) PushLogs(ctx context.Context, year, semester int, ids []primitive.ObjectID) error {
+	defer s.lock(ctx)()
+
+	if idx := s.index(year, semester); idx != -1 {
+		s.fees[idx].Logs = append(s.fees[idx].Logs, ids...)
+	}
+	return nil
+}
+
+// Update implements FeeStore.
+func (s *MemoryFeeStore) Update(ctx context.Context, year, semester int, update map[string]interface{}) error {
+	defer s.lock(ctx)()
+
+	idx := s.index(year, semester)
+	if idx == -1 {
+		return nil
+	}
+
+	fee := s.fees[idx].clone()
+	if err := set(&fee, update); err != nil {
+		return err
+	}
+	s.fees[idx] = fee
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryFeeStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.fees == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryFeeStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.fees == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// index returns the index of the fee of year and semester, or -1 if not present.
+func (s *MemoryFeeStore) index(year, semester int) int {
+	for idx, fee := range s.fees {
+		if fee.Year == year && fee.Semester == semester {
+			return idx
+		}
+	}
+	return -1
+}
+
+// clone returns a deep copy of f.
+func (f Fee) clone() Fee {
+	f.Logs = append(make([]primitive.ObjectID, 0, len(f.Logs)), f.Logs...)
+	if f.Policy != nil {
+		policy := f.Policy.clone()
+		f.Policy = &policy
+	}
+	if f.Items != nil {
+		items := make(Items, len(f.Items))
+		for idx, item := range f.Items {
+			items[idx] = item.clone()
+		}
+		f.Items = items
+	}
+	return f
+}
+
+// set applies update to v in the same way as the MongoDB $set operator does,
+// by round-tripping v through its bson representation.
+func set(v interface{}, update map[string]interface{}) error {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	doc := make(bson.M)
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for key, value := range update {
+		doc[key] = value
+	}
+
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, v)
+}
+
+// MemoryLogStore is a LogStore which keeps the fee logs in memory.
+// It is safe for concurrent use.
+type MemoryLogStore struct {
+	mu   sync.RWMutex
+	logs Logs
+}
+
+// NewMemoryLogStore returns a new empty LogStore.
+func NewMemoryLogStore() *MemoryLogStore { return &MemoryLogStore{} }
+
+// Find implements LogStore.
+func (s *MemoryLogStore) Find(ctx context.Context, filter LogFilter) (logs Logs, _ error) {
+	defer s.rlock(ctx)()
+
+	for _, log := range s.logs {
+		if filter.Match(log) {
+			logs = append(logs, log.clone())
+		}
+	}
+	return
+}
+
+// Insert implements LogStore.
+func (s *MemoryLogStore) Insert(ctx context.Context, logs ...Log) error {
+	defer s.lock(ctx)()
+
+	for _, log := range logs {
+		s.logs = append(s.logs, log.clone())
+	}
+	return nil
+}
+
+// Update implements LogStore.
+func (s *MemoryLogStore) Update(ctx context.Context, id primitive.ObjectID, update map[string]interface{}) error {
+	defer s.lock(ctx)()
+
+	for idx := range s.logs {
+		if s.logs[idx].ID != id {
+			continue
+		}
+		log := s.logs[idx].clone()
+		if err := set(&log, update); err != nil {
+			return err
+		}
+		s.logs[idx] = log
+		break
+	}
+	return nil
+}
+
+// Delete implements LogStore.
+func (s *MemoryLogStore) Delete(ctx context.Context, filter LogFilter) error {
+	defer s.lock(ctx)()
+
+	logs := Logs{}
+	for _, log := range s.logs {
+		if !filter.Match(log) {
+			logs = append(logs, log)
+		}
+	}
+	s.logs = logs
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryLogStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.logs == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryLogStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.logs == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// clone returns a deep copy of l.
+func (l Log) clone() Log {
+	if l.Attachments != nil {
+		l.Attachments = append(make(activity.Files, 0, len(l.Attachments)), l.Attachments...)
+	}
+	return l
+}
+
+// MemoryJournalStore is a JournalStore which keeps the journal entries in memory.
+// It is safe for concurrent use.
+type MemoryJournalStore struct {
+	mu      sync.RWMutex
+	entries Entries
+}
+
+// NewMemoryJournalStore returns a new empty JournalStore.
+func NewMemoryJournalStore() *MemoryJournalStore { return &MemoryJournalStore{} }
+
+// Find implements JournalStore.
+func (s *MemoryJournalStore) Find(ctx context.Context, filter EntryFilter) (Entries, error) {
+	defer s.rlock(ctx)()
+
+	entries := Entries{}
+	for _, entry := range s.entries {
+		if filter.Match(entry) {
+			entries = append(entries, entry.clone())
+		}
+	}
+	return entries, nil
+}
+
+// Insert implements JournalStore.
+func (s *MemoryJournalStore) Insert(ctx context.Context, entries ...Entry) error {
+	defer s.lock(ctx)()
+
+	for _, entry := range entries {
+		s.entries = append(s.entries, entry.clone())
+	}
+	return nil
+}
+
+// Delete implements JournalStore.
+func (s *MemoryJournalStore) Delete(ctx context.Context, filter EntryFilter) error {
+	defer s.lock(ctx)()
+
+	entries := Entries{}
+	for _, entry := range s.entries {
+		if !filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryJournalStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.journal == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryJournalStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.journal == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// clone returns a deep copy of e.
+func (e Entry) clone() Entry {
+	e.Postings = append(make([]Posting, 0, len(e.Postings)), e.Postings...)
+	return e
+}
+
+// MemoryRemittanceStore is a RemittanceStore which keeps the remittances in memory.
+// It is safe for concurrent use.
+type MemoryRemittanceStore struct {
+	mu          sync.RWMutex
+	remittances Remittances
+}
+
+// NewMemoryRemittanceStore returns a new empty RemittanceStore.
+func NewMemoryRemittanceStore() *MemoryRemittanceStore { return &MemoryRemittanceStore{} }
+
+// Find implements RemittanceStore.
+func (s *MemoryRemittanceStore) Find(ctx context.Context, filter RemittanceFilter) (Remittances, error) {
+	defer s.rlock(ctx)()
+
+	remittances := Remittances{}
+	for _, remittance := range s.remittances {
+		if filter.Match(remittance) {
+			remittances = append(remittances, remittance.clone())
+		}
+	}
+	return remittances, nil
+}
+
+// Insert implements RemittanceStore.
+func (s *MemoryRemittanceStore) Insert(ctx context.Context, remittances ...Remittance) error {
+	defer s.lock(ctx)()
+
+	for _, remittance := range remittances {
+		s.remittances = append(s.remittances, remittance.clone())
+	}
+	return nil
+}
+
+// Update implements RemittanceStore.
+func (s *MemoryRemittanceStore) Update(ctx context.Context, id string, update map[string]interface{}) error {
+	defer s.lock(ctx)()
+
+	for idx := range s.remittances {
+		if s.remittances[idx].ID != id {
+			continue
+		}
+		remittance := s.remittances[idx].clone()
+		if err := set(&remittance, update); err != nil {
+			return err
+		}
+		s.remittances[idx] = remittance
+		break
+	}
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryRemittanceStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.remittances == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryRemittanceStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.remittances == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// clone returns a deep copy of r.
+func (r Remittance) clone() Remittance {
+	if r.Candidates != nil {
+		r.Candidates = append(make([]string, 0, len(r.Candidates)), r.Candidates...)
+	}
+	return r
+}
+
+// MemoryReceiptStore is a ReceiptStore which keeps the receipts in memory.
+// It is safe for concurrent use.
+type MemoryReceiptStore struct {
+	mu       sync.RWMutex
+	receipts Receipts
+}
+
+// NewMemoryReceiptStore returns a new empty ReceiptStore.
+func NewMemoryReceiptStore() *MemoryReceiptStore { return &MemoryReceiptStore{} }
+
+// Find implements ReceiptStore.
+func (s *MemoryReceiptStore) Find(ctx context.Context, filter ReceiptFilter) (Receipts, error) {
+	defer s.rlock(ctx)()
+
+	receipts := Receipts{}
+	for _, receipt := range s.receipts {
+		if filter.Match(receipt) {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+// Insert implements ReceiptStore.
+func (s *MemoryReceiptStore) Insert(ctx context.Context, r Receipt) error {
+	defer s.lock(ctx)()
+
+	idx := sort.Search(len(s.receipts), func(i int) bool { return s.receipts[i].Number >= r.Number })
+	if idx < len(s.receipts) && s.receipts[idx].Number == r.Number {
+		return ErrDuplicatedReceipt
+	}
+	s.receipts = append(s.receipts[:idx], append(Receipts{r}, s.receipts[idx:]...)...)
+	return nil
+}
+
+// lock locks s for writing, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryReceiptStore) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.receipts == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlock locks s for reading, unless ctx is in a transaction over s which holds the lock already.
+// It returns the function to unlock s.
+func (s *MemoryReceiptStore) rlock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx.receipts == s {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// txKey is the context key of the running MemoryTransactor.
+type txKey struct{}
+
+// MemoryTransactor is a Transactor over a MemoryFeeStore, a MemoryLogStore, a MemoryJournalStore,
+// a MemoryRemittanceStore and a MemoryReceiptStore.
+// A transaction locks the stores for writing until it ends,
+// and restores their states if it fails.
+type MemoryTransactor struct {
+	fees        *MemoryFeeStore
+	logs        *MemoryLogStore
+	journal     *MemoryJournalStore
+	remittances *MemoryRemittanceStore
+	receipts    *MemoryReceiptStore
+}
+
+// NewMemoryTransactor returns a new Transactor over fs, ls, js, rs and cs.
+func NewMemoryTransactor(fs *MemoryFeeStore, ls *MemoryLogStore, js *MemoryJournalStore, rs *MemoryRemittanceStore, cs *MemoryReceiptStore) *MemoryTransactor {
+	return &MemoryTransactor{fees: fs, logs: ls, journal: js, remittances: rs, receipts: cs}
+}
+
+// Transaction implements Transactor.
+func (t *MemoryTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*MemoryTransactor); ok && tx == t {
+		return fn(ctx)
+	}
+
+	t.fees.mu.Lock()
+	defer t.fees.mu.Unlock()
+	t.logs.mu.Lock()
+	defer t.logs.mu.Unlock()
+	t.journal.mu.Lock()
+	defer t.journal.mu.Unlock()
+	t.remittances.mu.Lock()
+	defer t.remittances.mu.Unlock()
+	t.receipts.mu.Lock()
+	defer t.receipts.mu.Unlock()
+
+	fees := make([]Fee, len(t.fees.fees))
+	for idx, fee := range t.fees.fees {
+		fees[idx] = fee.clone()
+	}
+	logs := append(Logs{}, t.logs.logs...)
+	entries := append(Entries{}, t.journal.entries...)
+	remittances := make(Remittances, len(t.remittances.remittances))
+	for idx, remittance := range t.remittances.remittances {
+		remittances[idx] = remittance.clone()
+	}
+	receipts := append(Receipts{}, t.receipts.receipts...)
+
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		t.fees.fees, t.logs.logs, t.journal.entries, t.remittances.remittances, t.receipts.receipts = fees, logs, entries, remittances, receipts
+		return err
+	}
+	return nil
+}
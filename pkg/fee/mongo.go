@@ -0,0 +1,468 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDB is the club database of a MongoDB with an operation timeout.
+type mongoDB struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// do runs fn against the club database within the operation timeout.
+func (m mongoDB) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	return fn(ctx, m.db)
+}
+
+// MongoFeeStore is a FeeStore backed by MongoDB.
+type MongoFeeStore struct {
+	mongoDB
+}
+
+// NewMongoFeeStore returns a new FeeStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoFeeStore(db *mongo.Database, timeout time.Duration) *MongoFeeStore {
+	return &MongoFeeStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Get implements FeeStore.
+func (s *MongoFeeStore) Get(ctx context.Context, year, semester int) (fee *Fee, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		fee = new(Fee)
+		err := db.Collection("fees").FindOne(ctx, bson.D{bson.E{Key: "year", Value: year}, bson.E{Key: "semester", Value: semester}}).Decode(fee)
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Find implements FeeStore.
+func (s *MongoFeeStore) Find(ctx context.Context) (fees []Fee, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("fees").Find(ctx, bson.D{})
+		if err != nil {
+			return err
+		}
+
+		fees = []Fee{}
+		fee := new(Fee)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(fee); err != nil {
+				return err
+			}
+			fees = append(fees, *fee)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements FeeStore.
+func (s *MongoFeeStore) Insert(ctx context.Context, f Fee) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("fees").InsertOne(ctx, f)
+		return err
+	})
+}
+
+// PushLogs implements FeeStore.
+func (s *MongoFeeStore) PushLogs(ctx context.Context, year, semester int, ids []primitive.ObjectID) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("fees").UpdateOne(ctx,
+			bson.D{bson.E{Key: "year", Value: year}, bson.E{Key: "semester", Value: semester}},
+			bson.D{bson.E{Key: "$push", Value: bson.D{bson.E{Key: "logs", Value: bson.D{bson.E{Key: "$each", Value: ids}}}}}})
+		return err
+	})
+}
+
+// Update implements FeeStore.
+func (s *MongoFeeStore) Update(ctx context.Context, year, semester int, update map[string]interface{}) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("fees").UpdateOne(ctx,
+			bson.D{bson.E{Key: "year", Value: year}, bson.E{Key: "semester", Value: semester}},
+			bson.D{bson.E{Key: "$set", Value: update}})
+		return err
+	})
+}
+
+// MongoLogStore is a LogStore backed by MongoDB.
+type MongoLogStore struct {
+	mongoDB
+}
+
+// NewMongoLogStore returns a new LogStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoLogStore(db *mongo.Database, timeout time.Duration) *MongoLogStore {
+	return &MongoLogStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements LogStore.
+func (s *MongoLogStore) Find(ctx context.Context, filter LogFilter) (logs Logs, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("logs").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		log := new(Log)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(log); err != nil {
+				return err
+			}
+			logs = append(logs, *log)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements LogStore.
+func (s *MongoLogStore) Insert(ctx context.Context, logs ...Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	docs := make(bson.A, len(logs))
+	for idx, log := range logs {
+		docs[idx] = log
+	}
+
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("logs").InsertMany(ctx, docs)
+		return err
+	})
+}
+
+// Update implements LogStore.
+func (s *MongoLogStore) Update(ctx context.Context, id primitive.ObjectID, update map[string]interface{}) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("logs").UpdateOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}, bson.D{bson.E{Key: "$set", Value: update}})
+		return err
+	})
+}
+
+// Delete implements LogStore.
+func (s *MongoLogStore) Delete(ctx context.Context, filter LogFilter) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("logs").DeleteMany(ctx, filter.document())
+		return err
+	})
+}
+
+// MongoJournalStore is a JournalStore backed by MongoDB.
+type MongoJournalStore struct {
+	mongoDB
+}
+
+// NewMongoJournalStore returns a new JournalStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoJournalStore(db *mongo.Database, timeout time.Duration) *MongoJournalStore {
+	return &MongoJournalStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements JournalStore.
+func (s *MongoJournalStore) Find(ctx context.Context, filter EntryFilter) (entries Entries, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("journal").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		entries = Entries{}
+		entry := new(Entry)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(entry); err != nil {
+				return err
+			}
+			entries = append(entries, *entry)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements JournalStore.
+func (s *MongoJournalStore) Insert(ctx context.Context, entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	docs := make(bson.A, len(entries))
+	for idx, entry := range entries {
+		docs[idx] = entry
+	}
+
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("journal").InsertMany(ctx, docs)
+		return err
+	})
+}
+
+// Delete implements JournalStore.
+func (s *MongoJournalStore) Delete(ctx context.Context, filter EntryFilter) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("journal").DeleteMany(ctx, filter.document())
+		return err
+	})
+}
+
+// MongoRemittanceStore is a RemittanceStore backed by MongoDB.
+type MongoRemittanceStore struct {
+	mongoDB
+}
+
+// NewMongoRemittanceStore returns a new RemittanceStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoRemittanceStore(db *mongo.Database, timeout time.Duration) *MongoRemittanceStore {
+	return &MongoRemittanceStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements RemittanceStore.
+func (s *MongoRemittanceStore) Find(ctx context.Context, filter RemittanceFilter) (remittances Remittances, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("remittances").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		remittances = Remittances{}
+		remittance := new(Remittance)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(remittance); err != nil {
+				return err
+			}
+			remittances = append(remittances, *remittance)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements RemittanceStore.
+func (s *MongoRemittanceStore) Insert(ctx context.Context, remittances ...Remittance) error {
+	if len(remittances) == 0 {
+		return nil
+	}
+
+	docs := make(bson.A, len(remittances))
+	for idx, remittance := range remittances {
+		docs[idx] = remittance
+	}
+
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("remittances").InsertMany(ctx, docs)
+		return err
+	})
+}
+
+// Update implements RemittanceStore.
+func (s *MongoRemittanceStore) Update(ctx context.Context, id string, update map[string]interface{}) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("remittances").UpdateOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}, bson.D{bson.E{Key: "$set", Value: update}})
+		return err
+	})
+}
+
+// MongoReceiptStore is a ReceiptStore backed by MongoDB.
+type MongoReceiptStore struct {
+	mongoDB
+}
+
+// NewMongoReceiptStore returns a new ReceiptStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoReceiptStore(db *mongo.Database, timeout time.Duration) *MongoReceiptStore {
+	return &MongoReceiptStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements ReceiptStore.
+func (s *MongoReceiptStore) Find(ctx context.Context, filter ReceiptFilter) (receipts Receipts, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("receipts").Find(ctx, filter.document(), options.Find().SetSort(bson.D{bson.E{Key: "_id", Value: 1}}))
+		if err != nil {
+			return err
+		}
+
+		receipts = Receipts{}
+		receipt := new(Receipt)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(receipt); err != nil {
+				return err
+			}
+			receipts = append(receipts, *receipt)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements ReceiptStore.
+// The receipt number is the document ID, so that the numbers are unique.
+func (s *MongoReceiptStore) Insert(ctx context.Context, r Receipt) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("receipts").InsertOne(ctx, r)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicatedReceipt
+		}
+		return err
+	})
+}
+
+// MongoTransactor is a Transactor backed by the multi-document transactions of MongoDB,
+// which require a replica set or a sharded cluster.
+type MongoTransactor struct {
+	mongoDB
+}
+
+// NewMongoTransactor returns a new Transactor on db.
+// Each transaction is bounded by timeout, unless it is zero.
+func NewMongoTransactor(db *mongo.Database, timeout time.Duration) *MongoTransactor {
+	return &MongoTransactor{mongoDB{db: db, timeout: timeout}}
+}
+
+// Transaction implements Transactor.
+func (t *MongoTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	return t.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		sess, err := db.Client().StartSession()
+		if err != nil {
+			return err
+		}
+		defer sess.EndSession(ctx)
+
+		_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+// document returns the MongoDB query document of f.
+func (f LogFilter) document() bson.D {
+	filter := bson.D{}
+
+	if f.IDs != nil {
+		arr := make(bson.A, len(f.IDs))
+		for idx, id := range f.IDs {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.MemberIDs != nil {
+		arr := make(bson.A, len(f.MemberIDs))
+		for idx, id := range f.MemberIDs {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "member_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.Types != nil {
+		arr := make(bson.A, len(f.Types))
+		for idx, typ := range f.Types {
+			arr[idx] = typ
+		}
+		filter = append(filter, bson.E{Key: "type", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	return filter
+}
+
+// document returns the MongoDB query document of f.
+func (f EntryFilter) document() bson.D {
+	filter := bson.D{}
+
+	if f.IDs != nil {
+		arr := make(bson.A, len(f.IDs))
+		for idx, id := range f.IDs {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.Year != 0 {
+		filter = append(filter, bson.E{Key: "year", Value: f.Year}, bson.E{Key: "semester", Value: f.Semester})
+	}
+	if f.Account != "" {
+		filter = append(filter, bson.E{Key: "postings.account", Value: f.Account})
+	}
+	return filter
+}
+
+// document returns the MongoDB query document of f.
+func (f RemittanceFilter) document() bson.D {
+	filter := bson.D{}
+
+	if f.IDs != nil {
+		arr := make(bson.A, len(f.IDs))
+		for idx, id := range f.IDs {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.Year != 0 {
+		filter = append(filter, bson.E{Key: "year", Value: f.Year}, bson.E{Key: "semester", Value: f.Semester})
+	}
+	if f.Statuses != nil {
+		arr := make(bson.A, len(f.Statuses))
+		for idx, status := range f.Statuses {
+			arr[idx] = status
+		}
+		filter = append(filter, bson.E{Key: "status", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	return filter
+}
+
+// document returns the MongoDB query document of f.
+func (f ReceiptFilter) document() bson.D {
+	filter := bson.D{}
+
+	if f.LogIDs != nil {
+		arr := make(bson.A, len(f.LogIDs))
+		for idx, id := range f.LogIDs {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "log_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.MemberID != "" {
+		filter = append(filter, bson.E{Key: "member_id", Value: f.MemberID})
+	}
+	return filter
+}
@@ -0,0 +1,362 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+)
+
+var ErrInvalidPolicy = errors.New("invalid fee policy")
+
+// Rule represents a rule of a fee policy.
+// A member matches the rule if the member matches any value of every non-empty condition.
+type Rule struct {
+	Description string   `json:"description" bson:"description"`
+	Attendances []int    `json:"attendances" bson:"attendances"` // attendance statuses (optional)
+	Grades      []int    `json:"grades" bson:"grades"`           // grades (optional)
+	Roles       []string `json:"roles" bson:"roles"`             // names of the roles (optional)
+	Tags        []string `json:"tags" bson:"tags"`               // tags of the policy (optional)
+
+	Amount   *int `json:"amount" bson:"amount"`     // dues instead of the amount of the fee (optional)
+	Rate     int  `json:"rate" bson:"rate"`         // percentage off the dues
+	Discount int  `json:"discount" bson:"discount"` // amount off the dues, after the rate
+	Exempt   bool `json:"exempt" bson:"exempt"`     // whether the matching members are exempted automatically
+}
+
+// Policy represents the fee policy of a semester.
+// The first rule a member matches decides the dues of the member,
+// and the members matching no rule owe the amount of the fee.
+type Policy struct {
+	Rules []Rule              `json:"rules" bson:"rules"`
+	Tags  map[string][]string `json:"tags" bson:"tags"` // student IDs of the members of each tag
+}
+
+// DefaultPolicy returns the policy of the fees without one, which exempts the graduates.
+func DefaultPolicy() Policy {
+	return Policy{
+		Rules: []Rule{{Description: "졸업생 면제", Attendances: []int{member.Graduate}, Exempt: true}},
+		Tags:  map[string][]string{},
+	}
+}
+
+// validate returns ErrInvalidPolicy if any rule of p is invalid.
+func (p Policy) validate() error {
+	for idx, rule := range p.Rules {
+		switch {
+		case rule.Amount != nil && *rule.Amount < 0:
+			return fmt.Errorf("%w: rule %d: negative amount", ErrInvalidPolicy, idx+1)
+		case rule.Rate < 0 || 100 < rule.Rate:
+			return fmt.Errorf("%w: rule %d: rate must be between 0 and 100", ErrInvalidPolicy, idx+1)
+		case rule.Discount < 0:
+			return fmt.Errorf("%w: rule %d: negative discount", ErrInvalidPolicy, idx+1)
+		}
+		for _, attendance := range rule.Attendances {
+			if attendance < member.Attending || member.Graduate < attendance {
+				return fmt.Errorf("%w: rule %d: unknown attendance %d", ErrInvalidPolicy, idx+1, attendance)
+			}
+		}
+		for _, tag := range rule.Tags {
+			if _, ok := p.Tags[tag]; !ok {
+				return fmt.Errorf("%w: rule %d: unknown tag %s", ErrInvalidPolicy, idx+1, tag)
+			}
+		}
+	}
+	return nil
+}
+
+// clone returns a deep copy of p.
+func (p Policy) clone() Policy {
+	rules := make([]Rule, len(p.Rules))
+	for idx, rule := range p.Rules {
+		if rule.Amount != nil {
+			amount := *rule.Amount
+			rule.Amount = &amount
+		}
+		rule.Attendances = append([]int(nil), rule.Attendances...)
+		rule.Grades = append([]int(nil), rule.Grades...)
+		rule.Roles = append([]string(nil), rule.Roles...)
+		rule.Tags = append([]string(nil), rule.Tags...)
+		rules[idx] = rule
+	}
+
+	tags := make(map[string][]string, len(p.Tags))
+	for tag, ids := range p.Tags {
+		tags[tag] = append([]string{}, ids...)
+	}
+	return Policy{Rules: rules, Tags: tags}
+}
+
+// match reports whether m, with roles and tags, matches r.
+func (r Rule) match(m member.Member, roles, tags []string) bool {
+	return (len(r.Attendances) == 0 || containsInt(r.Attendances, m.Attendance)) &&
+		(len(r.Grades) == 0 || containsInt(r.Grades, m.Grade)) &&
+		(len(r.Roles) == 0 || intersects(r.Roles, roles)) &&
+		(len(r.Tags) == 0 || intersects(r.Tags, tags))
+}
+
+// dues returns the dues of the members matching r, given the amount of the fee.
+func (r Rule) dues(amount int) int {
+	if r.Exempt {
+		return 0
+	}
+	if r.Amount != nil {
+		amount = *r.Amount
+	}
+	if amount = amount*(100-r.Rate)/100 - r.Discount; amount < 0 {
+		return 0
+	}
+	return amount
+}
+
+// policy returns the policy of f, or the default policy if f has none.
+func (f Fee) policy() Policy {
+	if f.Policy == nil {
+		return DefaultPolicy()
+	}
+	return *f.Policy
+}
+
+// Liability represents the dues of a member by the policy of a fee.
+type Liability struct {
+	MemberID string `json:"member_id"`
+	Name     string `json:"name"`
+	Amount   int    `json:"amount"`
+	Rule     string `json:"rule"`     // description of the rule applied (empty if no rule applied)
+	Exempted bool   `json:"exempted"` // whether exempted by the rule automatically
+}
+
+type Liabilities []Liability
+
+// liabilities returns the liabilities of members by the policy of f.
+func (f Fee) liabilities(ctx context.Context, members member.Members) (Liabilities, error) {
+	policy := f.policy()
+
+	tags := make(map[string][]string)
+	for tag, ids := range policy.Tags {
+		for _, id := range ids {
+			tags[id] = append(tags[id], tag)
+		}
+	}
+
+	// the roles are looked up only if any rule needs them
+	roles := make(map[string][]string)
+	for _, rule := range policy.Rules {
+		if len(rule.Roles) == 0 {
+			continue
+		}
+		ids := make([]string, len(members))
+		for idx, member := range members {
+			ids[idx] = member.ID
+		}
+		var err error
+		if roles, err = rbac.RolesOf(ctx, ids); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	liabilities := make(Liabilities, len(members))
+	for idx, member := range members {
+		liability := Liability{MemberID: member.ID, Name: member.Name, Amount: f.Amount}
+		for _, rule := range policy.Rules {
+			if rule.match(member, roles[member.ID], tags[member.ID]) {
+				liability.Amount, liability.Rule, liability.Exempted = rule.dues(f.Amount), rule.Description, rule.Exempt
+				break
+			}
+		}
+		liabilities[idx] = liability
+	}
+	return liabilities, nil
+}
+
+// dues returns the amounts the members of ids owe by the policy of f.
+// The members not found owe the amount of f.
+func (f Fee) dues(ctx context.Context, ids []string) (map[string]int, error) {
+	dues := make(map[string]int, len(ids))
+	if len(ids) == 0 {
+		return dues, nil
+	}
+
+	members, err := member.Find(ctx, member.Filter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	liabilities, err := f.liabilities(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		dues[id] = f.Amount
+	}
+	for _, liability := range liabilities {
+		dues[liability.MemberID] = liability.Amount
+	}
+	return dues, nil
+}
+
+// owed returns the amounts the members of ids owe for f,
+// which are the charges posted in entries, or the dues by the policy of f if not charged yet.
+func (f Fee) owed(ctx context.Context, entries Entries, ids []string) (map[string]int, error) {
+	owed, err := f.dues(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	charged := entries.charged()
+	for _, id := range ids {
+		if amount, ok := charged[id]; ok {
+			owed[id] = amount
+		}
+	}
+	return owed, nil
+}
+
+// recharge charges the members of ids and the members charged already with their dues by the policy of f,
+// replacing the charges of different amounts.
+func (f Fee) recharge(ctx context.Context, ids []string) error {
+	entries, err := duesEntries(ctx, f.Year, f.Semester)
+	if err != nil {
+		return err
+	}
+	charged := entries.charged()
+
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+	extra := []string{}
+	for id := range charged {
+		if !seen[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Strings(extra)
+	ids = append(append([]string{}, ids...), extra...)
+
+	dues, err := f.dues(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	stale, fresh := []string{}, Entries{}
+	for _, id := range ids {
+		amount, ok := charged[id]
+		if ok && amount == dues[id] {
+			continue
+		}
+		if ok {
+			stale = append(stale, chargeID(f.Year, f.Semester, id))
+		}
+		fresh = append(fresh, chargeEntry(f.Year, f.Semester, dues[id], id))
+	}
+
+	if len(stale) != 0 {
+		if err = journalStore.Delete(ctx, EntryFilter{IDs: stale}); err != nil {
+			return err
+		}
+	}
+	return post(ctx, fresh...)
+}
+
+// SetPolicy sets the policy of the fee of year and semester,
+// and charges the members with their dues by the policy again.
+// It returns ErrInvalidPolicy if any rule of policy is invalid.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func SetPolicy(ctx context.Context, year, semester int, policy Policy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	policy = policy.clone()
+
+	ids, err := chargeable(ctx)
+	if err != nil {
+		return err
+	}
+
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if fee.Closed {
+			return ErrClosedFee
+		}
+		before := fee.policy()
+
+		if err = feeStore.Update(ctx, year, semester, map[string]interface{}{"policy": policy}); err != nil {
+			return err
+		}
+		fee.Policy = &policy
+
+		if err = fee.recharge(ctx, ids); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeePolicy, target(year, semester), before, policy)
+	})
+}
+
+// Assess returns the policy of the fee of year and semester,
+// and the liabilities of the approved members by the policy.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Assess(ctx context.Context, year, semester int) (*Policy, Liabilities, error) {
+	fee, err := feeStore.Get(ctx, year, semester)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	approved := true
+	members, err := member.Find(ctx, member.Filter{ExcludedIDs: []string{member.MASTER}, Approved: &approved})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	liabilities, err := fee.liabilities(ctx, members)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(liabilities, func(i, j int) bool { return liabilities[i].MemberID < liabilities[j].MemberID })
+
+	policy := fee.policy()
+	return &policy, liabilities, nil
+}
+
+// intersects reports whether strs and others have any string in common.
+func intersects(strs, others []string) bool {
+	for _, str := range strs {
+		for _, other := range others {
+			if str == other {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/pdf"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrInvalidReceipt     = errors.New("invalid receipt")
+	ErrDuplicatedReceipt  = errors.New("duplicated receipt")
+)
+
+// Receipt represents a numbered receipt of a payment issued to a member.
+// The numbers are sequential from 1, and a payment has one receipt at most.
+type Receipt struct {
+	Number      int                `json:"number" bson:"_id"`
+	LogID       primitive.ObjectID `json:"log_id" bson:"log_id"`
+	Year        int                `json:"year" bson:"year"`
+	Semester    int                `json:"semester" bson:"semester"`
+	MemberID    string             `json:"member_id" bson:"member_id"`
+	Name        string             `json:"name" bson:"name"` // name of the member on issue
+	Description string             `json:"description" bson:"description"`
+	Amount      int                `json:"amount" bson:"amount"`
+	PaidAt      int64              `json:"paid_at,string" bson:"paid_at"`
+	IssuedAt    int64              `json:"issued_at,string" bson:"issued_at"`
+}
+
+type Receipts []Receipt
+
+// MaxAttachmentSize is the maximum size of an attachment in bytes.
+const MaxAttachmentSize = 10 << 20
+
+// attachmentTypes maps the extensions of the attachments to the content type they must be sniffed as.
+// An image extension accepts any image type, since the extensions of the photos are often wrong.
+var attachmentTypes = map[string]string{
+	".jpg":  "image/",
+	".jpeg": "image/",
+	".png":  "image/",
+	".gif":  "image/",
+	".webp": "image/",
+	".pdf":  "application/pdf",
+}
+
+// NewAttachment returns a new file in the file registry to save an attachment of filename into.
+// The file is prefixed with a new ID, so that an attachment never overwrites another.
+func NewAttachment(filename string) activity.File {
+	return activity.NewFile(primitive.NewObjectID().Hex() + "-" + filepath.Base(filename))
+}
+
+// Attach saves the attachment of filename read from r into the file registry,
+// and attaches it to the deposit or expense log of id in the fee of year and semester, as the evidence of it.
+// The attachment must be an image or a PDF of MaxAttachmentSize at most, and it is validated before saved.
+// The attachments cannot be removed, so that the evidence trail is kept.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Attach(ctx context.Context, year, semester int, id primitive.ObjectID, filename string, r io.Reader) (activity.File, error) {
+	base := filepath.Base(strings.TrimSpace(filename))
+	kind, ok := attachmentTypes[strings.ToLower(filepath.Ext(base))]
+	if !ok {
+		return "", fmt.Errorf("%w: only the images and the PDFs are allowed, got %q", ErrInvalidAttachment, filename)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxAttachmentSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(data) > MaxAttachmentSize {
+		return "", fmt.Errorf("%w: the size must be 1 to %d bytes", ErrInvalidAttachment, MaxAttachmentSize)
+	}
+	if typ := http.DetectContentType(data); !strings.HasPrefix(typ, kind) {
+		return "", fmt.Errorf("%w: %q has the content of %s", ErrInvalidAttachment, filename, typ)
+	}
+
+	if _, log, err := findLog(ctx, year, semester, id); err != nil {
+		return "", err
+	} else if log.Type != deposit && log.Type != expense {
+		return "", fmt.Errorf("%w: only the deposits and the expenses have attachments", ErrInvalidAttachment)
+	}
+
+	file := NewAttachment(base)
+	if err = ioutil.WriteFile(file.Absolute(), data, 0644); err != nil {
+		file.Delete()
+		return "", err
+	}
+
+	err = transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, log, err := findLog(ctx, year, semester, id)
+		if err != nil {
+			return err
+		}
+		if log.Type != deposit && log.Type != expense {
+			return fmt.Errorf("%w: only the deposits and the expenses have attachments", ErrInvalidAttachment)
+		}
+
+		before := log.clone()
+		log.Attachments = append(log.Attachments, file)
+		if err = logStore.Update(ctx, id, map[string]interface{}{"attachments": log.Attachments}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeAttach, audit.Target("fee-log", id.Hex()), logState{fee.Year, fee.Semester, before}, logState{fee.Year, fee.Semester, *log})
+	})
+	if err != nil {
+		// the file is not referred to by any log.
+		file.Delete()
+		return "", err
+	}
+	return file, nil
+}
+
+// Attachment returns the attachment of filename of the log of id in the fee of year and semester.
+// It returns ErrAttachmentNotFound if the log has no such attachment.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Attachment(ctx context.Context, year, semester int, id primitive.ObjectID, filename string) (activity.File, error) {
+	_, log, err := findLog(ctx, year, semester, id)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range log.Attachments {
+		if file == activity.NewFile(filename) {
+			return file, nil
+		}
+	}
+	return "", ErrAttachmentNotFound
+}
+
+// IssueReceipt issues the receipt of the payment log of id in the fee of year and semester,
+// numbered next to the last receipt. The receipt issued already is returned again, if any.
+// If memberID is not empty, it returns ErrLogNotFound for the payments of the other members.
+// The reversals and the payments reversed have no receipts.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to the receipts of their own payments,
+//	and the club managers can access to any receipt.
+func IssueReceipt(ctx context.Context, year, semester int, id primitive.ObjectID, memberID string) (receipt *Receipt, err error) {
+	// a receipt numbered concurrently by another issue is retried with the next number.
+	for retry := 0; retry < 3; retry++ {
+		if receipt, err = issueReceipt(ctx, year, semester, id, memberID); err != ErrDuplicatedReceipt {
+			break
+		}
+	}
+	return
+}
+
+// issueReceipt issues the receipt of the payment log of id, once.
+func issueReceipt(ctx context.Context, year, semester int, id primitive.ObjectID, memberID string) (receipt *Receipt, err error) {
+	err = transactor.Transaction(ctx, func(ctx context.Context) error {
+		fee, log, err := findLog(ctx, year, semester, id)
+		if err != nil {
+			return err
+		}
+		if memberID != "" && log.MemberID != memberID {
+			return ErrLogNotFound
+		}
+		if log.Type != payment || log.Reverses != nil || log.Amount <= 0 {
+			return fmt.Errorf("%w: only the payments have receipts", ErrInvalidReceipt)
+		}
+
+		reversals, err := logStore.Find(ctx, LogFilter{IDs: fee.logIDs(), Types: []int{payment}})
+		if err != nil {
+			return err
+		}
+		for _, reversal := range reversals {
+			if reversal.Reverses != nil && *reversal.Reverses == id {
+				return fmt.Errorf("%w: the payment is reversed", ErrInvalidReceipt)
+			}
+		}
+
+		receipts, err := receiptStore.Find(ctx, ReceiptFilter{LogIDs: []primitive.ObjectID{id}})
+		if err != nil {
+			return err
+		}
+		if len(receipts) > 0 {
+			receipt = &receipts[0]
+			return nil
+		}
+
+		if receipts, err = receiptStore.Find(ctx, ReceiptFilter{}); err != nil {
+			return err
+		}
+		number := 1
+		if len(receipts) > 0 {
+			number = receipts[len(receipts)-1].Number + 1
+		}
+
+		memb, err := member.Get(ctx, log.MemberID)
+		if err != nil {
+			return err
+		}
+
+		description := log.Description
+		if log.Item != nil {
+			if item, err := fee.item(*log.Item); err == nil {
+				description = item.Name
+			}
+		}
+
+		receipt = &Receipt{
+			Number:      number,
+			LogID:       id,
+			Year:        fee.Year,
+			Semester:    fee.Semester,
+			MemberID:    memb.ID,
+			Name:        memb.Name,
+			Description: description,
+			Amount:      log.Amount,
+			PaidAt:      log.CreatedAt,
+			IssuedAt:    time.Now().Unix(),
+		}
+		if err = receiptStore.Insert(ctx, *receipt); err != nil {
+			return err
+		}
+		return audit.Record(ctx, audit.FeeReceipt, audit.Target("fee-log", id.Hex()), nil, receipt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// FindReceipts returns the receipts matching filter in the order of their numbers.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func FindReceipts(ctx context.Context, filter ReceiptFilter) (Receipts, error) {
+	return receiptStore.Find(ctx, filter)
+}
+
+// findLog returns the fee of year and semester, and the log of id in it.
+func findLog(ctx context.Context, year, semester int, id primitive.ObjectID) (*Fee, *Log, error) {
+	fee, err := feeStore.Get(ctx, year, semester)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !containsID(fee.Logs, id) {
+		return nil, nil, ErrLogNotFound
+	}
+
+	logs, err := logStore.Find(ctx, LogFilter{IDs: []primitive.ObjectID{id}})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(logs) == 0 {
+		return nil, nil, ErrLogNotFound
+	}
+	return fee, &logs[0], nil
+}
+
+// WritePDF writes r to w in PDF.
+func (r Receipt) WritePDF(w io.Writer) error {
+	doc := pdf.New()
+	doc.AddPage()
+
+	doc.Text(50, 790, 18, "영수증")
+	doc.TextRight(545, 790, 11, fmt.Sprintf("No. %06d", r.Number))
+	doc.Line(50, 775, 545, 775)
+
+	rows := [][2]string{
+		{"성명", fmt.Sprintf("%s (%s)", r.Name, r.MemberID)},
+		{"학기", fmt.Sprintf("%d년 %d학기", r.Year, r.Semester)},
+		{"내역", r.Description},
+		{"금액", Comma(r.Amount) + "원"},
+		{"납부일", time.Unix(r.PaidAt, 0).Format("2006-01-02")},
+	}
+	y := 750.0
+	for _, row := range rows {
+		doc.Text(50, y, 11, row[0])
+		doc.Text(150, y, 11, row[1])
+		y -= 22
+	}
+
+	doc.Line(50, y+8, 545, y+8)
+	doc.Text(50, y-16, 11, "위 금액을 정히 영수합니다.")
+	doc.TextRight(545, y-46, 11, "발급일: "+time.Unix(r.IssuedAt, 0).Format("2006-01-02"))
+	doc.TextRight(545, y-68, 11, "국민대학교 KCC")
+
+	_, err := doc.WriteTo(w)
+	return err
+}
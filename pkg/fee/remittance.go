@@ -0,0 +1,299 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/bank"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The statuses of the remittances.
+const (
+	Matched   = "matched"   // paid automatically
+	Pending   = "pending"   // waiting for the manual review
+	Resolved  = "resolved"  // paid on the manual review
+	Dismissed = "dismissed" // not a fee payment
+)
+
+var (
+	ErrRemittanceNotFound = errors.New("remittance not found")
+	ErrReviewed           = errors.New("remittance already reviewed")
+)
+
+// Remittance represents a deposit of a bank statement imported for a fee.
+type Remittance struct {
+	ID         string              `json:"id" bson:"_id"` // fingerprint of the deposit
+	Year       int                 `json:"year" bson:"year"`
+	Semester   int                 `json:"semester" bson:"semester"`
+	Date       string              `json:"date" bson:"date"`
+	Name       string              `json:"name" bson:"name"`
+	Memo       string              `json:"memo" bson:"memo"`
+	Amount     int                 `json:"amount" bson:"amount"`
+	Status     string              `json:"status" bson:"status"`
+	MemberID   string              `json:"member_id" bson:"member_id"`                         // member who paid, if matched or resolved
+	Candidates []string            `json:"candidates" bson:"candidates"`                       // members possibly matched, for the review
+	Note       string              `json:"note" bson:"note"`                                   // why it is pending or dismissed
+	LogID      *primitive.ObjectID `json:"log_id,omitempty" bson:"log_id,omitempty"`           // payment log, if matched or resolved
+	ReviewedBy string              `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"` // member who resolved or dismissed
+	CreatedAt  int64               `json:"created_at,string" bson:"created_at"`
+}
+
+type Remittances []Remittance
+
+// fingerprint returns the ID of the nth same deposit as r in a statement,
+// so that a deposit is never imported twice from the overlapping statements.
+func fingerprint(r bank.Record, nth int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%d", r.Date, r.Name, r.Memo, r.Amount, nth)))
+	return hex.EncodeToString(sum[:12])
+}
+
+// match matches r with members, given the amounts each member owes.
+// A deposit matches the member whose student ID is in its name or memo,
+// or else the only member whose name equals its depositor name, if the member owes the amount of it either way.
+// The other deposits are pending with the possible members and the reason,
+// including the members whose names are only a part of the depositor name.
+func match(r bank.Record, members member.Members, owes map[string]int) (id string, candidates []string, note string) {
+	text := r.Name + " " + r.Memo
+	for _, member := range members {
+		if strings.Contains(text, member.ID) {
+			candidates = append(candidates, member.ID)
+		}
+	}
+	switch {
+	case len(candidates) > 1:
+		return "", candidates, "여러 학번이 포함됨"
+	case len(candidates) == 1 && owes[candidates[0]] != r.Amount:
+		return "", candidates, "납부할 금액과 다름"
+	case len(candidates) == 1:
+		return candidates[0], candidates, ""
+	}
+
+	name := strings.TrimSpace(r.Name)
+	for _, member := range members {
+		if member.Name == name {
+			candidates = append(candidates, member.ID)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, member := range members {
+			if utf8.RuneCountInString(member.Name) >= 2 && strings.Contains(name, member.Name) {
+				candidates = append(candidates, member.ID)
+			}
+		}
+		if len(candidates) != 0 {
+			return "", candidates, "이름의 일부만 일치함"
+		}
+	}
+	switch {
+	case len(candidates) == 0:
+		return "", []string{}, "일치하는 회원 없음"
+	case len(candidates) > 1:
+		return "", candidates, "동명이인"
+	case owes[candidates[0]] != r.Amount:
+		return "", candidates, "납부할 금액과 다름"
+	}
+	return candidates[0], candidates, ""
+}
+
+// Import imports the deposits of records as the payments of the fee of year and semester.
+// The deposits matched with the members are paid, and the others are pending for the manual review.
+// The deposits imported already are skipped.
+// It returns the remittances of the deposits imported newly.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Import(ctx context.Context, year, semester int, records bank.Records) (remittances Remittances, err error) {
+	approved := true
+	members, err := member.Find(ctx, member.Filter{ExcludedIDs: []string{member.MASTER}, Approved: &approved})
+	if err != nil {
+		return nil, err
+	}
+
+	err = transactor.Transaction(ctx, func(ctx context.Context) error {
+		remittances = Remittances{}
+
+		fee, err := feeStore.Get(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		if fee.Closed {
+			return ErrClosedFee
+		}
+
+		entries, err := duesEntries(ctx, year, semester)
+		if err != nil {
+			return err
+		}
+		membIDs := make([]string, len(members))
+		for idx, member := range members {
+			membIDs[idx] = member.ID
+		}
+		owes, err := fee.owed(ctx, entries, membIDs)
+		if err != nil {
+			return err
+		}
+		_, settled := entries.settlements()
+		for _, id := range membIDs {
+			owes[id] -= settled[id]
+		}
+
+		seen := make(map[string]int)
+		ids := make([]string, len(records))
+		for idx, record := range records {
+			key := fingerprint(record, 0)
+			ids[idx] = fingerprint(record, seen[key])
+			seen[key]++
+		}
+
+		imported, err := remittanceStore.Find(ctx, RemittanceFilter{IDs: ids})
+		if err != nil {
+			return err
+		}
+		skip := make(map[string]bool)
+		for _, remittance := range imported {
+			skip[remittance.ID] = true
+		}
+
+		logs := Logs{}
+		for idx, record := range records {
+			if skip[ids[idx]] {
+				continue
+			}
+
+			remittance := Remittance{
+				ID:        ids[idx],
+				Year:      year,
+				Semester:  semester,
+				Date:      record.Date,
+				Name:      record.Name,
+				Memo:      record.Memo,
+				Amount:    record.Amount,
+				Status:    Pending,
+				CreatedAt: time.Now().Unix(),
+			}
+			remittance.MemberID, remittance.Candidates, remittance.Note = match(record, members, owes)
+
+			if remittance.MemberID != "" {
+				log := NewLog(remittance.MemberID, "회비 납부", record.Amount, payment)
+				remittance.Status, remittance.LogID = Matched, &log.ID
+				owes[remittance.MemberID] -= record.Amount
+				logs = append(logs, *log)
+			}
+			remittances = append(remittances, remittance)
+		}
+
+		if err = fee.pay(ctx, logs...); err != nil {
+			return err
+		}
+		if err = remittanceStore.Insert(ctx, remittances...); err != nil {
+			return err
+		}
+
+		counts := map[string]interface{}{"imported": len(remittances), "matched": len(logs), "pending": len(remittances) - len(logs)}
+		return audit.Record(ctx, audit.FeeImport, target(year, semester), nil, counts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// FindRemittances returns the remittances of the fee of year and semester in the statuses,
+// or in every status if statuses is nil.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func FindRemittances(ctx context.Context, year, semester int, statuses []string) (Remittances, error) {
+	return remittanceStore.Find(ctx, RemittanceFilter{Year: year, Semester: semester, Statuses: statuses})
+}
+
+// Resolve resolves the pending remittance of id as the payment of the member of memberID.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Resolve(ctx context.Context, id, memberID string) error {
+	return review(ctx, id, func(ctx context.Context, remittance Remittance, update map[string]interface{}) error {
+		if _, err := member.Get(ctx, memberID); err != nil {
+			return err
+		}
+
+		fee, err := feeStore.Get(ctx, remittance.Year, remittance.Semester)
+		if err != nil {
+			return err
+		}
+
+		log := NewLog(memberID, "회비 납부", remittance.Amount, payment)
+		if err = fee.pay(ctx, *log); err != nil {
+			return err
+		}
+
+		update["status"], update["member_id"], update["log_id"] = Resolved, memberID, log.ID
+		return audit.Record(ctx, audit.FeeResolve, audit.Target("remittance", id), remittance, update)
+	})
+}
+
+// Dismiss dismisses the pending remittance of id as not a fee payment, with note.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Dismiss(ctx context.Context, id, note string) error {
+	return review(ctx, id, func(ctx context.Context, remittance Remittance, update map[string]interface{}) error {
+		update["status"], update["note"] = Dismissed, note
+		return audit.Record(ctx, audit.FeeDismiss, audit.Target("remittance", id), remittance, update)
+	})
+}
+
+// review runs fn to review the pending remittance of id in a transaction,
+// and applies update filled by fn to the remittance.
+func review(ctx context.Context, id string, fn func(ctx context.Context, remittance Remittance, update map[string]interface{}) error) error {
+	return transactor.Transaction(ctx, func(ctx context.Context) error {
+		remittances, err := remittanceStore.Find(ctx, RemittanceFilter{IDs: []string{id}})
+		if err != nil {
+			return err
+		}
+		if len(remittances) == 0 {
+			return ErrRemittanceNotFound
+		}
+		if remittances[0].Status != Pending {
+			return ErrReviewed
+		}
+
+		update := map[string]interface{}{"reviewed_by": audit.Actor(ctx)}
+		if err = fn(ctx, remittances[0], update); err != nil {
+			return err
+		}
+		return remittanceStore.Update(ctx, id, update)
+	})
+}
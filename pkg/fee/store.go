@@ -0,0 +1,201 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fee provides access to the club fee of the Buddy System.
+package fee
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("fee not found")
+
+// FeeStore is the persistence layer of the club fees.
+type FeeStore interface {
+	// Get returns the fee of year and semester.
+	// It returns ErrNotFound if there is no such fee.
+	Get(ctx context.Context, year, semester int) (*Fee, error)
+	// Find returns every fee in insertion order.
+	Find(ctx context.Context) ([]Fee, error)
+	// Insert inserts f.
+	Insert(ctx context.Context, f Fee) error
+	// PushLogs appends the log IDs of ids to the fee of year and semester.
+	PushLogs(ctx context.Context, year, semester int, ids []primitive.ObjectID) error
+	// Update sets the fields of update, keyed by their bson names, to the fee of year and semester.
+	Update(ctx context.Context, year, semester int, update map[string]interface{}) error
+}
+
+// LogStore is the persistence layer of the club fee logs.
+type LogStore interface {
+	// Find returns the logs matching filter in insertion order.
+	Find(ctx context.Context, filter LogFilter) (Logs, error)
+	// Insert inserts logs.
+	Insert(ctx context.Context, logs ...Log) error
+	// Update sets the fields of update, keyed by their bson names, to the log of id.
+	Update(ctx context.Context, id primitive.ObjectID, update map[string]interface{}) error
+	// Delete deletes the logs matching filter.
+	Delete(ctx context.Context, filter LogFilter) error
+}
+
+// JournalStore is the persistence layer of the club ledger.
+type JournalStore interface {
+	// Find returns the entries matching filter in insertion order.
+	Find(ctx context.Context, filter EntryFilter) (Entries, error)
+	// Insert inserts entries.
+	Insert(ctx context.Context, entries ...Entry) error
+	// Delete deletes the entries matching filter.
+	Delete(ctx context.Context, filter EntryFilter) error
+}
+
+// RemittanceStore is the persistence layer of the remittances imported from the bank statements.
+type RemittanceStore interface {
+	// Find returns the remittances matching filter in insertion order.
+	Find(ctx context.Context, filter RemittanceFilter) (Remittances, error)
+	// Insert inserts remittances.
+	Insert(ctx context.Context, remittances ...Remittance) error
+	// Update sets the fields of update, keyed by their bson names, to the remittance of id.
+	Update(ctx context.Context, id string, update map[string]interface{}) error
+}
+
+// ReceiptStore is the persistence layer of the payment receipts.
+type ReceiptStore interface {
+	// Find returns the receipts matching filter in the order of their numbers.
+	Find(ctx context.Context, filter ReceiptFilter) (Receipts, error)
+	// Insert inserts r.
+	// It returns ErrDuplicatedReceipt if there is a receipt of the same number already.
+	Insert(ctx context.Context, r Receipt) error
+}
+
+// Transactor runs the operations across the fee, log, journal, remittance and receipt stores atomically.
+type Transactor interface {
+	// Transaction runs fn in a transaction.
+	// The store operations made with the context passed to fn are committed together if fn returns nil,
+	// and discarded otherwise. They are not visible to the other operations until committed.
+	// fn may be run more than once on the transient failures, so it must not have the other side effects.
+	// A transaction in another transaction joins the outer one.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// LogFilter represents a fee log search condition.
+// The zero value matches every log.
+type LogFilter struct {
+	IDs       []primitive.ObjectID // log IDs to include (nil for all)
+	MemberIDs []string             // member IDs to include (nil for all)
+	Types     []int                // log types to include (nil for all)
+}
+
+// Match reports whether l matches f.
+func (f LogFilter) Match(l Log) bool {
+	return (f.IDs == nil || containsID(f.IDs, l.ID)) &&
+		(f.MemberIDs == nil || containsString(f.MemberIDs, l.MemberID)) &&
+		(f.Types == nil || containsInt(f.Types, l.Type))
+}
+
+// EntryFilter represents a journal entry search condition.
+// The zero value matches every entry.
+type EntryFilter struct {
+	IDs      []string // entry IDs to include (nil for all)
+	Year     int      // year of the entries (zero for all)
+	Semester int      // semester of the entries, if Year is not zero
+	Account  Account  // account the entries post to (empty for all)
+}
+
+// Match reports whether e matches f.
+func (f EntryFilter) Match(e Entry) bool {
+	if f.Account != "" {
+		posted := false
+		for _, posting := range e.Postings {
+			posted = posted || posting.Account == f.Account
+		}
+		if !posted {
+			return false
+		}
+	}
+	return (f.IDs == nil || containsString(f.IDs, e.ID)) &&
+		(f.Year == 0 || (f.Year == e.Year && f.Semester == e.Semester))
+}
+
+// RemittanceFilter represents a remittance search condition.
+// The zero value matches every remittance.
+type RemittanceFilter struct {
+	IDs      []string // remittance IDs to include (nil for all)
+	Year     int      // year of the remittances (zero for all)
+	Semester int      // semester of the remittances, if Year is not zero
+	Statuses []string // statuses to include (nil for all)
+}
+
+// Match reports whether r matches f.
+func (f RemittanceFilter) Match(r Remittance) bool {
+	return (f.IDs == nil || containsString(f.IDs, r.ID)) &&
+		(f.Year == 0 || (f.Year == r.Year && f.Semester == r.Semester)) &&
+		(f.Statuses == nil || containsString(f.Statuses, r.Status))
+}
+
+// ReceiptFilter represents a receipt search condition.
+// The zero value matches every receipt.
+type ReceiptFilter struct {
+	LogIDs   []primitive.ObjectID // IDs of the receipted logs to include (nil for all)
+	MemberID string               // student ID of the member (empty for all)
+}
+
+// Match reports whether r matches f.
+func (f ReceiptFilter) Match(r Receipt) bool {
+	return (f.LogIDs == nil || containsID(f.LogIDs, r.LogID)) &&
+		(f.MemberID == "" || f.MemberID == r.MemberID)
+}
+
+var (
+	feeStore        FeeStore
+	logStore        LogStore
+	journalStore    JournalStore
+	remittanceStore RemittanceStore
+	receiptStore    ReceiptStore
+	transactor      Transactor
+)
+
+// SetStore sets the persistence layer of the club fees to fs, ls, js, rs and cs,
+// and the transactor across them to tx.
+func SetStore(fs FeeStore, ls LogStore, js JournalStore, rs RemittanceStore, cs ReceiptStore, tx Transactor) {
+	feeStore, logStore, journalStore, remittanceStore, receiptStore, transactor = fs, ls, js, rs, cs, tx
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, elem := range ids {
+		if elem == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, str string) bool {
+	for _, elem := range strs {
+		if elem == str {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(ints []int, i int) bool {
+	for _, elem := range ints {
+		if elem == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mail provides the senders of the e-mails of the Buddy System.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var ErrNoRecipient = errors.New("no recipient")
+
+// Message represents a plain text e-mail.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender sends the e-mails.
+type Sender interface {
+	// Send sends msg.
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPSender is a Sender which relays the e-mails to an SMTP server.
+type SMTPSender struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+// NewSMTPSender returns a new Sender relaying to the SMTP server of addr ("host:port") as from.
+// The PLAIN authentication is used if username is not empty,
+// which requires TLS unless the server is on the localhost.
+func NewSMTPSender(addr, from, username, password string) *SMTPSender {
+	return &SMTPSender{addr: addr, from: from, username: username, password: password}
+}
+
+// Send implements Sender.
+// It gives up when ctx is done, as net/smtp does not support contexts.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipient
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.addr, auth, s.from, msg.To, s.encode(msg)) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// encode returns the RFC 5322 representation of msg,
+// with the UTF-8 subject and the base64 encoded body.
+func (s *SMTPSender) encode(msg Message) []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+
+	return buf.Bytes()
+}
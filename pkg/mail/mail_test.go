@@ -0,0 +1,135 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/mail"
+)
+
+// fakeServer is a fake SMTP server which accepts every e-mail.
+type fakeServer struct {
+	listener net.Listener
+	rcpts    []string
+	data     chan string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener, data: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(line string) {
+		w.WriteString(line + "\r\n")
+		w.Flush()
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data := new(strings.Builder)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data <- data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	sender := mail.NewSMTPSender(server.listener.Addr().String(), "buddy@kcc.example", "", "")
+	msg := mail.Message{To: []string{"gildong@kookmin.ac.kr"}, Subject: "회비 납부 안내", Body: "회비 15,000원을 납부해 주세요."}
+
+	if err := sender.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	data := <-server.data
+	if len(server.rcpts) != 1 || server.rcpts[0] != "gildong@kookmin.ac.kr" {
+		t.Errorf("unexpected recipients: %v", server.rcpts)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); err != nil || subject != msg.Subject {
+		t.Errorf("expected the subject %q, got %q, %v", msg.Subject, subject, err)
+	}
+	body, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != msg.Body {
+		t.Errorf("expected the body %q, got %q", msg.Body, body)
+	}
+}
+
+func TestNoRecipient(t *testing.T) {
+	sender := mail.NewSMTPSender("127.0.0.1:25", "buddy@kcc.example", "", "")
+	if err := sender.Send(context.Background(), mail.Message{Subject: "test"}); err != mail.ErrNoRecipient {
+		t.Errorf("expected %v, got %v", mail.ErrNoRecipient, err)
+	}
+}
@@ -21,10 +21,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kmu-kcc/buddy-backend/config"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
 )
 
 const (
@@ -46,40 +43,43 @@ var (
 
 // Member represents a club member state.
 type Member struct {
-	ID         string `json:"id" bson:"id"`                        // student ID
-	Password   string `json:"password" bson:"password"`            // password
-	Name       string `json:"name" bson:"name"`                    // Name
-	Department string `json:"department" bson:"department"`        // department
-	Phone      string `json:"phone" bson:"phone"`                  // phone number
-	Email      string `json:"email" bson:"email"`                  // e-mail address
-	Grade      int    `json:"grade" bson:"grade"`                  // grade
-	Attendance int    `json:"attendance" bson:"attendance"`        // attendance status (attending/absent/graduate)
-	Approved   bool   `json:"approved" bson:"approved"`            // approved or not
-	OnDelete   bool   `json:"on_delete" bson:"on_delete"`          // on exit process or not
-	CreatedAt  int64  `json:"created_at,string" bson:"created_at"` // when created - Unix timestamp
-	UpdatedAt  int64  `json:"updated_at,string" bson:"updated_at"` // last updated - Unix timestamp
-	Role       Role   `json:"role" bson:"role"`                    // role of member
+	ID                 string `json:"id" bson:"id"`                                     // student ID
+	Password           string `json:"-" bson:"password"`                                // bcrypt hash of password (plaintext for legacy records)
+	Name               string `json:"name" bson:"name"`                                 // Name
+	Department         string `json:"department" bson:"department"`                     // department
+	Phone              string `json:"phone" bson:"phone"`                               // phone number
+	Email              string `json:"email" bson:"email"`                               // e-mail address
+	Grade              int    `json:"grade" bson:"grade"`                               // grade
+	Attendance         int    `json:"attendance" bson:"attendance"`                     // attendance status (attending/absent/graduate)
+	Approved           bool   `json:"approved" bson:"approved"`                         // approved or not
+	OnDelete           bool   `json:"on_delete" bson:"on_delete"`                       // on exit process or not
+	MustChangePassword bool   `json:"must_change_password" bson:"must_change_password"` // still using the default password or not
+	CreatedAt          int64  `json:"created_at,string" bson:"created_at"`              // when created - Unix timestamp
+	UpdatedAt          int64  `json:"updated_at,string" bson:"updated_at"`              // last updated - Unix timestamp
+	Role               Role   `json:"-" bson:"role"`                                    // legacy role of member, superseded by the rbac package
 }
 
 type Members []Member
 
 // New returns a new club member.
+// Its password is the student ID, which must be changed on the first signin.
 func New(id, name, department, phone, email string, grade, attendance int) *Member {
 	now := time.Now().Unix()
 	return &Member{
-		ID:         id,
-		Password:   id,
-		Name:       name,
-		Department: department,
-		Phone:      phone,
-		Email:      email,
-		Grade:      grade,
-		Attendance: attendance,
-		Approved:   false,
-		OnDelete:   false,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-		Role:       Role{},
+		ID:                 id,
+		Password:           id,
+		Name:               name,
+		Department:         department,
+		Phone:              phone,
+		Email:              email,
+		Grade:              grade,
+		Attendance:         attendance,
+		Approved:           false,
+		OnDelete:           false,
+		MustChangePassword: true,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		Role:               Role{},
 	}
 }
 
@@ -92,7 +92,6 @@ func (m Member) Public() map[string]interface{} {
 	pub["department"] = m.Department
 	pub["email"] = m.Email
 	pub["grade"] = m.Grade
-	pub["role"] = m.Role
 
 	return pub
 }
@@ -109,53 +108,92 @@ func (ms Members) Public() []map[string]interface{} {
 }
 
 // SingIn checks whether m is a club member.
+// It returns ErrPasswordChangeRequired if m still uses the default password.
 //
 // NOTE:
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func (m Member) SingIn() error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func (m Member) SingIn(ctx context.Context) error {
+	member, err := m.authenticate(ctx)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
 
-	member := new(Member)
-
-	if err = client.Database("club").Collection("members").FindOne(ctx, bson.D{bson.E{Key: "id", Value: m.ID}}).Decode(member); err == mongo.ErrNoDocuments {
-		return ErrIdentityMismatch
-	} else if err != nil {
-		return err
-	}
-
-	if m.Password != member.Password {
-		return ErrIdentityMismatch
-	}
 	if member.ID != MASTER && !member.Approved {
 		return ErrUnderReview
 	}
+	if member.MustChangePassword {
+		return ErrPasswordChangeRequired
+	}
 	return nil
 }
 
-// SignUp applies a membership of m.
-// If m already exists (approved or not), nothing changes.
-// Else it registers an unapproved member.
-func (m Member) SignUp() error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+// ChangePassword changes the password of m to password.
+// m must have the current password.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to this operation.
+func (m Member) ChangePassword(ctx context.Context, password string) error {
+	if _, err := m.authenticate(ctx); err != nil {
+		return err
+	}
+	if err := Policy.Validate(m.ID, password); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	return mutate(self(ctx, m.ID), []string{m.ID}, audit.MemberChangePassword, func() error {
+		return store.Update(ctx, []string{m.ID}, map[string]interface{}{"password": hash, "must_change_password": false, "updated_at": time.Now().Unix()})
+	})
+}
 
-	collection := client.Database("club").Collection("members")
-	member := new(Member)
+// authenticate returns the member of m.ID if m has the correct password.
+// A legacy plaintext password is replaced with its hash on success.
+func (m Member) authenticate(ctx context.Context) (*Member, error) {
+	member, err := store.Get(ctx, m.ID)
+	if err == ErrNotFound {
+		return nil, ErrIdentityMismatch
+	} else if err != nil {
+		return nil, err
+	}
 
-	if err = collection.FindOne(ctx, bson.D{bson.E{Key: "id", Value: m.ID}}).Decode(member); err == mongo.ErrNoDocuments {
-		_, err = collection.InsertOne(ctx, m)
-		return err
+	if !comparePassword(member.Password, m.Password) {
+		return nil, ErrIdentityMismatch
+	}
+
+	if !hashed(member.Password) {
+		if member.Password, err = hashPassword(m.Password); err != nil {
+			return nil, err
+		}
+		// legacy accounts still using the student ID were created with the default password
+		member.MustChangePassword = member.MustChangePassword || m.Password == member.ID
+
+		if err = store.Update(ctx, []string{member.ID}, map[string]interface{}{"password": member.Password, "must_change_password": member.MustChangePassword}); err != nil {
+			return nil, err
+		}
+	}
+	return member, nil
+}
+
+// SignUp applies a membership of m.
+// If m already exists (approved or not), nothing changes.
+// Else it registers an unapproved member.
+func (m Member) SignUp(ctx context.Context) error {
+	member, err := store.Get(ctx, m.ID)
+	if err == ErrNotFound {
+		if m.Password, err = hashPassword(m.Password); err != nil {
+			return err
+		}
+		if err = store.Insert(ctx, m); err != nil {
+			return err
+		}
+		return audit.Record(self(ctx, m.ID), audit.MemberSignUp, target(m.ID), nil, m)
 	} else if err != nil {
 		return err
 	}
@@ -171,32 +209,9 @@ func (m Member) SignUp() error {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func SignUps() (members Members, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
-
-	cur, err := client.Database("club").Collection("members").Find(ctx, bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$ne", Value: MASTER}}}, bson.E{Key: "approved", Value: false}})
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
-	}
-
-	member := new(Member)
-
-	for cur.Next(ctx) {
-		if err = cur.Decode(member); err != nil {
-			return
-		}
-		members = append(members, *member)
-	}
-
-	return members, cur.Close(ctx)
+func SignUps(ctx context.Context) (Members, error) {
+	approved := false
+	return store.Find(ctx, Filter{ExcludedIDs: []string{MASTER}, Approved: &approved})
 }
 
 // Approve approves the signup requests of ids.
@@ -205,30 +220,16 @@ func SignUps() (members Members, err error) {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Approve(ids []string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
-
-	filter := func() bson.D {
-		arr := make(bson.A, len(ids))
-		for idx, id := range ids {
-			arr[idx] = id
-		}
-		return bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$in", Value: arr}}}}
-	}()
-
+func Approve(ctx context.Context, ids []string) error {
 	// FIXME
 	//
 	// there can be duplicated signup approval
 	//
 	// it needs to be handled in v1.1.0.
 
-	_, err = client.Database("club").Collection("members").UpdateMany(ctx, filter, bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "approved", Value: true}, bson.E{Key: "updated_at", Value: time.Now().Unix()}}}})
-	return err
+	return mutate(ctx, ids, audit.MemberApprove, func() error {
+		return store.Update(ctx, ids, map[string]interface{}{"approved": true, "updated_at": time.Now().Unix()})
+	})
 }
 
 // Delete deletes the members of ids.
@@ -237,24 +238,8 @@ func Approve(ids []string) error {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Delete(ids []string) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
-	}
-	defer client.Disconnect(ctx)
-
-	filter := func() bson.D {
-		arr := make(bson.A, len(ids))
-		for idx, id := range ids {
-			arr[idx] = id
-		}
-		return bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$in", Value: arr}}}}
-	}()
-
-	_, err = client.Database("club").Collection("members").DeleteMany(ctx, filter)
-	return err
+func Delete(ctx context.Context, ids []string) error {
+	return mutate(ctx, ids, audit.MemberDelete, func() error { return store.Delete(ctx, ids) })
 }
 
 // Exit applies an exit of m.
@@ -263,21 +248,19 @@ func Delete(ids []string) error {
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func (m *Member) Exit() error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func (m *Member) Exit(ctx context.Context) error {
+	member, err := store.Get(ctx, m.ID)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	*m = *member
 
-	if err = client.Database("club").Collection("members").FindOneAndUpdate(ctx, bson.D{bson.E{Key: "id", Value: m.ID}}, bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "on_delete", Value: true}, bson.E{Key: "updated_at", Value: time.Now().Unix()}}}}).Decode(m); err != nil {
-		return err
-	}
 	if m.OnDelete {
 		return ErrOnDelete
 	}
-	return nil
+	return mutate(ctx, []string{m.ID}, audit.MemberExit, func() error {
+		return store.Update(ctx, []string{m.ID}, map[string]interface{}{"on_delete": true, "updated_at": time.Now().Unix()})
+	})
 }
 
 // Exits returns the exit request list.
@@ -286,59 +269,24 @@ func (m *Member) Exit() error {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Exits() (members Members, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
-
-	cur, err := client.Database("club").Collection("members").Find(ctx, bson.D{bson.E{Key: "on_delete", Value: true}})
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
-	}
-
-	member := new(Member)
-
-	for cur.Next(ctx) {
-		if err = cur.Decode(member); err != nil {
-			return
-		}
-		members = append(members, *member)
-	}
-
-	return members, cur.Close(ctx)
+func Exits(ctx context.Context) (Members, error) {
+	onDelete := true
+	return store.Find(ctx, Filter{OnDelete: &onDelete})
 }
 
 // My returns the personal information of m.
-func (m *Member) My() (map[string]interface{}, error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func (m *Member) My(ctx context.Context) (map[string]interface{}, error) {
+	member, err := m.authenticate(ctx)
 	if err != nil {
-		return nil, err
-	}
-	defer client.Disconnect(ctx)
-
-	member := new(Member)
-
-	if err = client.Database("club").Collection("members").FindOne(ctx, bson.D{bson.E{Key: "id", Value: m.ID}}).Decode(member); err != nil {
 		return make(map[string]interface{}), err
 	}
 
-	if m.Password != member.Password {
-		return make(map[string]interface{}), ErrIdentityMismatch
-	}
-
 	data := member.Public()
-	data["password"] = member.Password
 	data["phone"] = member.Phone
 	data["attendance"] = member.Attendance
 	data["approved"] = member.Approved
 	data["on_delete"] = member.OnDelete
+	data["must_change_password"] = member.MustChangePassword
 
 	return data, nil
 }
@@ -349,77 +297,37 @@ func (m *Member) My() (map[string]interface{}, error) {
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func Search(query string) (members Members, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return
-	}
-	defer client.Disconnect(ctx)
-
-	filter := bson.D{
-		bson.E{Key: "approved", Value: true},
-		bson.E{Key: "$or", Value: bson.A{
-			bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$regex", Value: query}}}},
-			bson.D{bson.E{Key: "name", Value: bson.D{bson.E{Key: "$regex", Value: query}}}},
-			bson.D{bson.E{Key: "department", Value: bson.D{bson.E{Key: "$regex", Value: query}}}},
-		}}}
-
-	member := new(Member)
-	cur, err := client.Database("club").Collection("members").Find(ctx, filter)
-	if err == mongo.ErrNoDocuments {
-		return members, nil
-	} else if err != nil {
-		return
-	}
-
-	for cur.Next(ctx) {
-		if err = cur.Decode(member); err != nil {
-			return
-		}
-		members = append(members, *member)
-	}
-
-	return members, cur.Close(ctx)
+func Search(ctx context.Context, query string) (Members, error) {
+	approved := true
+	return store.Find(ctx, Filter{Approved: &approved, Query: query})
 }
 
-// Update updates the state of m to update.
+// Update applies update to m.
+// privileged reports whether update is made by a member manager.
+// See Update.Validate for the errors.
 //
 // NOTE:
 //
 // It is a member-limited operation:
 //	Only the authenticated members can access to this operation.
-func (m Member) Update(update map[string]interface{}) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
+func (m Member) Update(ctx context.Context, update Update, privileged bool) error {
+	if err := update.Validate(privileged); err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
 
-	update["updated_at"] = time.Now().Unix()
+	if _, err := store.Get(ctx, m.ID); err != nil {
+		return err
+	}
+
+	doc := update.document()
+	doc["updated_at"] = time.Now().Unix()
 
-	_, err = client.Database("club").Collection("members").UpdateOne(ctx, bson.D{bson.E{Key: "id", Value: m.ID}}, bson.D{bson.E{Key: "$set", Value: update}})
-	return err
+	return mutate(ctx, []string{m.ID}, audit.MemberUpdate, func() error { return store.Update(ctx, []string{m.ID}, doc) })
 }
 
 // Active returns the activation status for member signup.
-func Active() (bool, error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return false, err
-	}
-	defer client.Disconnect(ctx)
-
-	active := new(struct {
-		Active bool `bson:"active"`
-	})
-
-	if err = client.Database("club").Collection("signup").FindOne(ctx, bson.D{}).Decode(active); err != nil {
-		return false, err
-	}
-	return active.Active, nil
+func Active(ctx context.Context) (bool, error) {
+	return store.Active(ctx)
 }
 
 // Activate updates the activation status for member signup.
@@ -428,30 +336,21 @@ func Active() (bool, error) {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Activate(activate bool) (bool, error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func Activate(ctx context.Context, activate bool) (bool, error) {
+	active, err := store.SetActive(ctx, activate)
 	if err != nil {
 		return false, err
 	}
-	defer client.Disconnect(ctx)
-
-	active := struct {
-		Active bool `bson:"active"`
-	}{Active: activate}
 
-	if err = client.Database("club").Collection("signup").FindOneAndUpdate(ctx, bson.D{}, bson.D{bson.E{Key: "$set", Value: active}}).Decode(&active); err != nil {
-		return false, err
-	}
-
-	if active.Active == activate {
+	if active == activate {
 		if activate {
-			return active.Active, ErrAlreadyActive
+			return active, ErrAlreadyActive
 		} else {
-			return active.Active, ErrAlreadyInactive
+			return active, ErrAlreadyInactive
 		}
 	}
-	return activate, nil
+	return activate, audit.Record(ctx, audit.MemberActivate, audit.Target("signup", "active"),
+		map[string]bool{"active": active}, map[string]bool{"active": activate})
 }
 
 // Graduates returns all graduate members.
@@ -460,60 +359,81 @@ func Activate(activate bool) (bool, error) {
 //
 // It is a privileged operation:
 //	Only the club managers can access to this operation.
-func Graduates() (members Members, err error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+func Graduates(ctx context.Context) (Members, error) {
+	graduate := Graduate
+	return store.Find(ctx, Filter{Attendance: &graduate})
+}
+
+// ClearLegacyRoles clears the legacy roles of the members of ids,
+// once they are migrated to the rbac package.
+func ClearLegacyRoles(ctx context.Context, ids []string) error {
+	return store.Update(ctx, ids, map[string]interface{}{"role": Role{}})
+}
+
+// Get returns the member of id.
+func Get(ctx context.Context, id string) (*Member, error) {
+	return store.Get(ctx, id)
+}
+
+// Find returns the members matching filter.
+func Find(ctx context.Context, filter Filter) (Members, error) {
+	return store.Find(ctx, filter)
+}
+
+// mutate runs fn which mutates the members of ids,
+// and records action with the states of each member around it.
+func mutate(ctx context.Context, ids []string, action string, fn func() error) error {
+	// a nil IDs filter would match every member
+	filter := Filter{IDs: append([]string{}, ids...)}
+
+	before, err := store.Find(ctx, filter)
 	if err != nil {
-		return
+		return err
+	}
+
+	if err = fn(); err != nil {
+		return err
 	}
-	defer client.Disconnect(ctx)
 
-	cur, err := client.Database("club").Collection("members").Find(ctx, bson.D{bson.E{Key: "attendance", Value: Graduate}})
+	after, err := store.Find(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			err = nil
-		}
-		return
+		return err
 	}
 
-	member := new(Member)
+	states := make(map[string]Member)
+	for _, member := range after {
+		states[member.ID] = member
+	}
 
-	for cur.Next(ctx) {
-		if err = cur.Decode(member); err != nil {
-			return
+	for _, member := range before {
+		var state interface{}
+		if s, ok := states[member.ID]; ok {
+			state = s
+		}
+		if err = audit.Record(ctx, action, target(member.ID), member, state); err != nil {
+			return err
 		}
-		members = append(members, *member)
 	}
-
-	return members, cur.Close(ctx)
+	return nil
 }
 
-// UpdateRole updates the role of member of id.
-//
-// NOTE:
-//
-// It is a privileged operation:
-//	Only the club managers can access to this operation.
-func UpdateRole(id string, role Role) error {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		return err
+// self attributes the unauthenticated mutations of ctx to the member of id, who makes them by oneself.
+func self(ctx context.Context, id string) context.Context {
+	if audit.Actor(ctx) == "" {
+		return audit.WithActor(ctx, id)
 	}
-	defer client.Disconnect(ctx)
-
-	_, err = client.Database("club").Collection("members").UpdateOne(ctx, bson.D{bson.E{Key: "id", Value: id}}, bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "role", Value: role}}}})
-	return err
+	return ctx
 }
 
+// target returns the audit target of the member of id.
+func target(id string) string { return audit.Target("member", id) }
+
 // String implements fmt.Stringer.
 func (m Member) String() string {
 	return fmt.Sprintf(
-		"Member {\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%d\n  %-12s%d\n  %-12s%t\n  %-12s%t\n  %-12s%d\n  %-12s%d\n}",
+		"Member {\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%s\n  %-12s%d\n  %-12s%d\n  %-12s%t\n  %-12s%t\n  %-12s%d\n  %-12s%d\n}",
 		"ID:",
 		m.ID,
-		"Password:",
-		m.Password,
 		"Name:",
 		m.Name,
 		"Department:",
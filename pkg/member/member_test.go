@@ -15,11 +15,27 @@
 package member_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
 	"testing"
 
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
 	"github.com/kmu-kcc/buddy-backend/pkg/member"
 )
 
+var (
+	ctx   = context.Background()
+	store = member.NewMemoryStore()
+)
+
+func TestMain(m *testing.M) {
+	member.SetStore(store)
+	audit.SetStore(audit.NewMemoryStore())
+	os.Exit(m.Run())
+}
+
 func TestSignUp(t *testing.T) {
 	guests := []*member.Member{
 		member.New("20210001", "Test1", "Department1", "010-2021-0001", "testmail1", 1, member.Attending),
@@ -29,14 +45,14 @@ func TestSignUp(t *testing.T) {
 	}
 
 	for _, guest := range guests {
-		if err := guest.SignUp(); err != nil {
+		if err := guest.SignUp(ctx); err != nil {
 			t.Error(err)
 		}
 	}
 }
 
 func TestSignUps(t *testing.T) {
-	guests, err := member.SignUps()
+	guests, err := member.SignUps(ctx)
 	if err != nil {
 		t.Error(err)
 	}
@@ -51,7 +67,7 @@ func TestSignUps(t *testing.T) {
 
 func TestApprove(t *testing.T) {
 	ids := []string{"20210001", "20190003"}
-	if err := member.Approve(ids); err != nil {
+	if err := member.Approve(ctx, ids); err != nil {
 		t.Error(err)
 	}
 }
@@ -60,10 +76,21 @@ func TestSignIn(t *testing.T) {
 	memb := member.Member{ID: "20210001", Password: "20210001"}
 	guest := member.Member{ID: "20190002", Password: "20190002"}
 
-	if err := memb.SingIn(); err != nil {
+	if err := memb.SingIn(ctx); err != member.ErrPasswordChangeRequired {
+		t.Errorf("expected %v, got %v", member.ErrPasswordChangeRequired, err)
+	}
+	if err := memb.ChangePassword(ctx, "buddy2021"); err != nil {
+		t.Fatal(err)
+	}
+	if err := memb.SingIn(ctx); err != member.ErrIdentityMismatch {
+		t.Errorf("expected %v, got %v", member.ErrIdentityMismatch, err)
+	}
+
+	memb.Password = "buddy2021"
+	if err := memb.SingIn(ctx); err != nil {
 		t.Error(err)
 	}
-	if err := guest.SingIn(); err == member.ErrUnderReview {
+	if err := guest.SingIn(ctx); err == member.ErrUnderReview {
 		t.Log(err)
 	} else if err != nil {
 		t.Error(err)
@@ -72,23 +99,23 @@ func TestSignIn(t *testing.T) {
 
 func TestExit(t *testing.T) {
 	memb := member.Member{ID: "20210001"}
-	if err := memb.Exit(); err != nil {
+	if err := memb.Exit(ctx); err != nil {
 		t.Error(err)
 	}
-	if err := memb.Exit(); err == member.ErrOnDelete {
+	if err := memb.Exit(ctx); err == member.ErrOnDelete {
 		t.Log(err)
 	} else if err != nil {
 		t.Error(err)
 	}
 
 	memb.ID = "20190003"
-	if err := memb.Exit(); err != nil {
+	if err := memb.Exit(ctx); err != nil {
 		t.Error(err)
 	}
 }
 
 func TestExits(t *testing.T) {
-	if membs, err := member.Exits(); err != nil {
+	if membs, err := member.Exits(ctx); err != nil {
 		t.Error(err)
 	} else {
 		for _, memb := range membs {
@@ -98,26 +125,105 @@ func TestExits(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	if err := member.Delete([]string{"20190003"}); err != nil {
+	if err := member.Delete(ctx, []string{"20190003"}); err != nil {
 		t.Error(err)
 	}
 }
 
 func TestUpdate(t *testing.T) {
-	if err := member.Approve([]string{"20190002"}); err != nil {
+	if err := member.Approve(ctx, []string{"20190002"}); err != nil {
 		t.Error(err)
 	}
 
 	memb := member.Member{ID: "20190002"}
-	if err := memb.Update(map[string]interface{}{
-		"attendance": member.Attending,
-		"password":   "00000000"}); err != nil {
+	for data, expected := range map[string]error{
+		`{}`:                               member.ErrEmptyUpdate,
+		`{"role": {"master": true}}`:       member.ErrUnknownField,
+		`{"grade": "2"}`:                   member.ErrInvalidField,
+		`{"attendance": 1}`:                member.ErrPermissionDenied,
+		`{"approved": false}`:              member.ErrPermissionDenied,
+		`{"phone": "02-1234-5678"}`:        member.ErrInvalidField,
+		`{"email": "Tom <tom@gmail.com>"}`: member.ErrInvalidField,
+		`{"department": " "}`:              member.ErrInvalidField,
+		`{"password": "buddy0000"}`:        member.ErrUnknownField,
+		`{"phone": "010-2019-0002", "email": "test2@kookmin.ac.kr"}`: nil,
+	} {
+		update := member.Update{}
+		err := json.Unmarshal([]byte(data), &update)
+		if err == nil {
+			err = memb.Update(ctx, update, false)
+		}
+		if !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", data, expected, err)
+		}
+	}
+
+	grade := 6
+	if err := memb.Update(ctx, member.Update{Grade: &grade}, true); !errors.Is(err, member.ErrInvalidField) {
+		t.Errorf("expected %v, got %v", member.ErrInvalidField, err)
+	}
+
+	grade, attendance := 3, member.Absent
+	if err := memb.Update(ctx, member.Update{Grade: &grade, Attendance: &attendance}, true); err != nil {
+		t.Error(err)
+	}
+	if err := (member.Member{ID: "20990099"}).Update(ctx, member.Update{Grade: &grade}, true); err != member.ErrNotFound {
+		t.Errorf("expected %v, got %v", member.ErrNotFound, err)
+	}
+
+	if stored, err := store.Get(ctx, memb.ID); err != nil {
 		t.Error(err)
+	} else if stored.Grade != 3 || stored.Attendance != member.Absent || stored.Phone != "010-2019-0002" {
+		t.Errorf("unexpected member: %v", stored)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := member.PasswordPolicy{MinLength: 8, RequireLetter: true, RequireDigit: true, RequireSymbol: true}
+
+	for password, valid := range map[string]bool{
+		"b2021!":      false,
+		"buddybuddy!": false,
+		"2021202100!": false,
+		"buddy20210":  false,
+		"20210001":    false,
+		"buddy2021!":  true,
+		"버디시스템2021!":  true,
+	} {
+		if err := policy.Validate("20210001", password); (err == nil) != valid {
+			t.Errorf("%q: expected valid to be %t, got %v", password, valid, err)
+		}
+	}
+}
+
+func TestLegacyPassword(t *testing.T) {
+	if err := store.Insert(ctx, member.Member{ID: "20150005", Password: "legacy2015", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	memb := member.Member{ID: "20150005", Password: "legacy2015"}
+	if err := memb.SingIn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Get(ctx, memb.ID); err != nil {
+		t.Fatal(err)
+	} else if stored.Password == memb.Password {
+		t.Error("legacy password is not hashed")
+	}
+	if err := memb.SingIn(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if err := store.Insert(ctx, member.Member{ID: "20150006", Password: "20150006", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (member.Member{ID: "20150006", Password: "20150006"}).SingIn(ctx); err != member.ErrPasswordChangeRequired {
+		t.Errorf("expected %v, got %v", member.ErrPasswordChangeRequired, err)
 	}
 }
 
 func TestSearch(t *testing.T) {
-	if membs, err := member.Search("2021"); err != nil {
+	if membs, err := member.Search(ctx, "2021"); err != nil {
 		t.Error(err)
 	} else {
 		for _, memb := range membs {
@@ -127,7 +233,7 @@ func TestSearch(t *testing.T) {
 }
 
 func TestActive(t *testing.T) {
-	if active, err := member.Active(); err != nil {
+	if active, err := member.Active(ctx); err != nil {
 		t.Error(err)
 	} else {
 		t.Logf("active: %t", active)
@@ -135,7 +241,7 @@ func TestActive(t *testing.T) {
 }
 
 func TestActivate(t *testing.T) {
-	if active, err := member.Activate(true); err != nil {
+	if active, err := member.Activate(ctx, true); err != nil {
 		t.Error(err)
 	} else {
 		t.Logf("active: %t", active)
@@ -143,7 +249,7 @@ func TestActivate(t *testing.T) {
 }
 
 func TestGraduates(t *testing.T) {
-	members, err := member.Graduates()
+	members, err := member.Graduates(ctx)
 	if err != nil {
 		t.Error(err)
 	}
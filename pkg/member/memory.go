@@ -0,0 +1,144 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package member provides access to the club member of the Buddy System.
+package member
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemoryStore is a MemberStore which keeps the members in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	members Members
+	active  bool
+}
+
+// NewMemoryStore returns a new empty MemberStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{} }
+
+// Get implements MemberStore.
+func (s *MemoryStore) Get(_ context.Context, id string) (*Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, member := range s.members {
+		if member.ID == id {
+			return &member, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Find implements MemberStore.
+func (s *MemoryStore) Find(_ context.Context, filter Filter) (members Members, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, member := range s.members {
+		ok, err := filter.Match(member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			members = append(members, member)
+		}
+	}
+	return
+}
+
+// Insert implements MemberStore.
+func (s *MemoryStore) Insert(_ context.Context, m Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.members = append(s.members, m)
+	return nil
+}
+
+// Update implements MemberStore.
+func (s *MemoryStore) Update(_ context.Context, ids []string, update map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx, member := range s.members {
+		if !contains(ids, member.ID) {
+			continue
+		}
+		if err := set(&member, update); err != nil {
+			return err
+		}
+		s.members[idx] = member
+	}
+	return nil
+}
+
+// Delete implements MemberStore.
+func (s *MemoryStore) Delete(_ context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.members[:0]
+	for _, member := range s.members {
+		if !contains(ids, member.ID) {
+			members = append(members, member)
+		}
+	}
+	s.members = members
+	return nil
+}
+
+// Active implements MemberStore.
+func (s *MemoryStore) Active(context.Context) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.active, nil
+}
+
+// SetActive implements MemberStore.
+func (s *MemoryStore) SetActive(_ context.Context, active bool) (prev bool, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, s.active = s.active, active
+	return prev, nil
+}
+
+// set applies update to v in the same way as the MongoDB $set operator does,
+// by round-tripping v through its bson representation.
+func set(v interface{}, update map[string]interface{}) error {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	doc := make(bson.M)
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for key, value := range update {
+		doc[key] = value
+	}
+
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, v)
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package member provides access to the club member of the Buddy System.
+package member
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore is a MemberStore backed by MongoDB.
+type MongoStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoStore returns a new MemberStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoStore(db *mongo.Database, timeout time.Duration) *MongoStore {
+	return &MongoStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the club database within the operation timeout.
+func (s *MongoStore) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db)
+}
+
+// Get implements MemberStore.
+func (s *MongoStore) Get(ctx context.Context, id string) (member *Member, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		member = new(Member)
+		err := db.Collection("members").FindOne(ctx, bson.D{bson.E{Key: "id", Value: id}}).Decode(member)
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Find implements MemberStore.
+func (s *MongoStore) Find(ctx context.Context, filter Filter) (members Members, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("members").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		member := new(Member)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(member); err != nil {
+				return err
+			}
+			members = append(members, *member)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements MemberStore.
+func (s *MongoStore) Insert(ctx context.Context, m Member) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("members").InsertOne(ctx, m)
+		return err
+	})
+}
+
+// Update implements MemberStore.
+func (s *MongoStore) Update(ctx context.Context, ids []string, update map[string]interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("members").UpdateMany(ctx, Filter{IDs: ids}.document(), bson.D{bson.E{Key: "$set", Value: update}})
+		return err
+	})
+}
+
+// Delete implements MemberStore.
+func (s *MongoStore) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("members").DeleteMany(ctx, Filter{IDs: ids}.document())
+		return err
+	})
+}
+
+// Active implements MemberStore.
+func (s *MongoStore) Active(ctx context.Context) (bool, error) {
+	active := new(struct {
+		Active bool `bson:"active"`
+	})
+
+	err := s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		return db.Collection("signup").FindOne(ctx, bson.D{}).Decode(active)
+	})
+	return active.Active, err
+}
+
+// SetActive implements MemberStore.
+func (s *MongoStore) SetActive(ctx context.Context, activate bool) (bool, error) {
+	active := struct {
+		Active bool `bson:"active"`
+	}{Active: activate}
+
+	err := s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		return db.Collection("signup").FindOneAndUpdate(ctx, bson.D{}, bson.D{bson.E{Key: "$set", Value: active}}).Decode(&active)
+	})
+	return active.Active, err
+}
+
+// document returns the MongoDB query document of f.
+func (f Filter) document() bson.D {
+	filter := bson.D{}
+
+	if f.IDs != nil || f.ExcludedIDs != nil {
+		cond := bson.D{}
+		if f.IDs != nil {
+			cond = append(cond, bson.E{Key: "$in", Value: array(f.IDs)})
+		}
+		if f.ExcludedIDs != nil {
+			cond = append(cond, bson.E{Key: "$nin", Value: array(f.ExcludedIDs)})
+		}
+		filter = append(filter, bson.E{Key: "id", Value: cond})
+	}
+	if f.Approved != nil {
+		filter = append(filter, bson.E{Key: "approved", Value: *f.Approved})
+	}
+	if f.OnDelete != nil {
+		filter = append(filter, bson.E{Key: "on_delete", Value: *f.OnDelete})
+	}
+	if f.Attendance != nil || f.ExcludedAttendance != nil {
+		cond := bson.D{}
+		if f.Attendance != nil {
+			cond = append(cond, bson.E{Key: "$eq", Value: *f.Attendance})
+		}
+		if f.ExcludedAttendance != nil {
+			cond = append(cond, bson.E{Key: "$ne", Value: *f.ExcludedAttendance})
+		}
+		filter = append(filter, bson.E{Key: "attendance", Value: cond})
+	}
+	if f.Query != "" {
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{bson.E{Key: "id", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+			bson.D{bson.E{Key: "name", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+			bson.D{bson.E{Key: "department", Value: bson.D{bson.E{Key: "$regex", Value: f.Query}}}},
+		}})
+	}
+	return filter
+}
+
+func array(ids []string) bson.A {
+	arr := make(bson.A, len(ids))
+	for idx, id := range ids {
+		arr[idx] = id
+	}
+	return arr
+}
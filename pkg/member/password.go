@@ -0,0 +1,104 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package member provides access to the club member of the Buddy System.
+package member
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/kmu-kcc/buddy-backend/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrWeakPassword           = errors.New("비밀번호 정책에 맞지 않습니다")
+	ErrPasswordChangeRequired = errors.New("비밀번호를 변경해주세요")
+)
+
+// PasswordPolicy represents the requirements of a member password.
+type PasswordPolicy struct {
+	MinLength     int  // minimum number of characters
+	RequireLetter bool // at least one letter
+	RequireDigit  bool // at least one digit
+	RequireSymbol bool // at least one character which is neither a letter nor a digit
+}
+
+// Policy is the password policy applied to every password change.
+var Policy = PasswordPolicy{
+	MinLength:     config.PasswordMinLength,
+	RequireLetter: config.PasswordRequireLetter,
+	RequireDigit:  config.PasswordRequireDigit,
+	RequireSymbol: config.PasswordRequireSymbol,
+}
+
+// maxPasswordLength is the maximum length of the input of bcrypt.
+const maxPasswordLength = 72
+
+// Validate reports whether password of the member of id satisfies p.
+// The returned error wraps ErrWeakPassword with the violated requirement.
+func (p PasswordPolicy) Validate(id, password string) error {
+	var letter, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	switch {
+	case len([]rune(password)) < p.MinLength:
+		return fmt.Errorf("%w: %d자 이상이어야 합니다", ErrWeakPassword, p.MinLength)
+	case len(password) > maxPasswordLength:
+		return fmt.Errorf("%w: %d바이트 이하여야 합니다", ErrWeakPassword, maxPasswordLength)
+	case p.RequireLetter && !letter:
+		return fmt.Errorf("%w: 문자를 포함해야 합니다", ErrWeakPassword)
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("%w: 숫자를 포함해야 합니다", ErrWeakPassword)
+	case p.RequireSymbol && !symbol:
+		return fmt.Errorf("%w: 특수문자를 포함해야 합니다", ErrWeakPassword)
+	case password == id:
+		return fmt.Errorf("%w: 학번과 달라야 합니다", ErrWeakPassword)
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// hashed reports whether password is a bcrypt hash,
+// rather than a legacy plaintext password.
+func hashed(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
+
+// comparePassword reports whether password matches the stored password.
+func comparePassword(stored, password string) bool {
+	if hashed(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
@@ -15,7 +15,12 @@
 // Package member provides access to the club member of the Buddy System.
 package member
 
-// Role represents the member role.
+// Role represents the legacy member role.
+//
+// NOTE:
+//
+// It is superseded by the rbac package,
+// and only kept to migrate the stored roles to the built-in rbac roles.
 type Role struct {
 	Master             bool `json:"-" bson:"master"`
 	MemberManagement   bool `json:"member_management" bson:"member_management"`
@@ -0,0 +1,101 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package member provides access to the club member of the Buddy System.
+package member
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+var ErrNotFound = errors.New("존재하지 않는 회원입니다")
+
+// MemberStore is the persistence layer of the club members.
+type MemberStore interface {
+	// Get returns the member of id.
+	// It returns ErrNotFound if there is no such member.
+	Get(ctx context.Context, id string) (*Member, error)
+	// Find returns the members matching filter in insertion order.
+	Find(ctx context.Context, filter Filter) (Members, error)
+	// Insert inserts m.
+	Insert(ctx context.Context, m Member) error
+	// Update sets the fields of update to the members of ids.
+	// The keys of update are the bson field names of Member.
+	Update(ctx context.Context, ids []string, update map[string]interface{}) error
+	// Delete deletes the members of ids.
+	Delete(ctx context.Context, ids []string) error
+	// Active returns the activation status for member signup.
+	Active(ctx context.Context) (bool, error)
+	// SetActive updates the activation status for member signup to active
+	// and returns the previous status.
+	SetActive(ctx context.Context, active bool) (bool, error)
+}
+
+// Filter represents a member search condition.
+// The zero value matches every member.
+type Filter struct {
+	IDs                []string // member IDs to include (nil for all)
+	ExcludedIDs        []string // member IDs to exclude
+	Approved           *bool    // approved or not
+	OnDelete           *bool    // on exit process or not
+	Attendance         *int     // attendance status to include
+	ExcludedAttendance *int     // attendance status to exclude
+	Query              string   // regular expression to match with ID, name or department
+}
+
+// Match reports whether m matches f.
+func (f Filter) Match(m Member) (bool, error) {
+	if f.IDs != nil && !contains(f.IDs, m.ID) {
+		return false, nil
+	}
+	if contains(f.ExcludedIDs, m.ID) {
+		return false, nil
+	}
+	if f.Approved != nil && *f.Approved != m.Approved {
+		return false, nil
+	}
+	if f.OnDelete != nil && *f.OnDelete != m.OnDelete {
+		return false, nil
+	}
+	if f.Attendance != nil && *f.Attendance != m.Attendance {
+		return false, nil
+	}
+	if f.ExcludedAttendance != nil && *f.ExcludedAttendance == m.Attendance {
+		return false, nil
+	}
+	if f.Query != "" {
+		re, err := regexp.Compile(f.Query)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(m.ID) || re.MatchString(m.Name) || re.MatchString(m.Department), nil
+	}
+	return true, nil
+}
+
+var store MemberStore
+
+// SetStore sets the persistence layer of the club members to s.
+func SetStore(s MemberStore) { store = s }
+
+func contains(ids []string, id string) bool {
+	for _, elem := range ids {
+		if elem == id {
+			return true
+		}
+	}
+	return false
+}
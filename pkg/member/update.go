@@ -0,0 +1,160 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package member provides access to the club member of the Buddy System.
+package member
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+const (
+	MinGrade = 1
+	MaxGrade = 5 // students beyond the 4th grade are all in the 5th
+)
+
+var (
+	ErrUnknownField = errors.New("변경할 수 없는 항목입니다")
+	ErrInvalidField = errors.New("올바르지 않은 값입니다")
+	ErrEmptyUpdate  = errors.New("변경할 항목이 없습니다")
+)
+
+var phonePattern = regexp.MustCompile(`^01[016789]-?[0-9]{3,4}-?[0-9]{4}$`)
+
+// Update represents the changes of a member.
+// Only the given fields are changed.
+//
+// NOTE:
+//
+// A member can change its own Phone, Email and Department,
+// while only the member managers can change Grade, Attendance and Approved.
+// The password is changed only by ChangePassword, which requires the current password.
+type Update struct {
+	Phone      *string `json:"phone"`
+	Email      *string `json:"email"`
+	Department *string `json:"department"`
+	Grade      *int    `json:"grade"`
+	Attendance *int    `json:"attendance"`
+	Approved   *bool   `json:"approved"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// It rejects the unknown fields and the fields of wrong types with ErrUnknownField and ErrInvalidField.
+func (u *Update) UnmarshalJSON(data []byte) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidField, err)
+	}
+
+	update := Update{}
+	targets := map[string]interface{}{
+		"phone":      &update.Phone,
+		"email":      &update.Email,
+		"department": &update.Department,
+		"grade":      &update.Grade,
+		"attendance": &update.Attendance,
+		"approved":   &update.Approved,
+	}
+
+	for key, value := range fields {
+		target, ok := targets[key]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownField, key)
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("%w: %s: 타입이 올바르지 않습니다", ErrInvalidField, key)
+		}
+	}
+
+	*u = update
+	return nil
+}
+
+// Validate validates the fields of u for the member of id.
+// privileged reports whether the changes are made by a member manager.
+//
+// The returned error wraps
+// ErrEmptyUpdate if there is no field to change,
+// ErrPermissionDenied if u has a field which only the member managers can change,
+// and ErrInvalidField otherwise.
+func (u Update) Validate(privileged bool) error {
+	if u == (Update{}) {
+		return ErrEmptyUpdate
+	}
+
+	if !privileged {
+		for key, given := range map[string]bool{
+			"grade":      u.Grade != nil,
+			"attendance": u.Attendance != nil,
+			"approved":   u.Approved != nil,
+		} {
+			if given {
+				return fmt.Errorf("%w: %s", ErrPermissionDenied, key)
+			}
+		}
+	}
+
+	if u.Phone != nil && !phonePattern.MatchString(*u.Phone) {
+		return fmt.Errorf("%w: phone: 전화번호 형식이 아닙니다", ErrInvalidField)
+	}
+	if u.Email != nil {
+		if addr, err := mail.ParseAddress(*u.Email); err != nil || addr.Address != *u.Email {
+			return fmt.Errorf("%w: email: 이메일 형식이 아닙니다", ErrInvalidField)
+		}
+	}
+	if u.Department != nil && strings.TrimSpace(*u.Department) == "" {
+		return fmt.Errorf("%w: department: 비어 있습니다", ErrInvalidField)
+	}
+	if u.Grade != nil && (*u.Grade < MinGrade || MaxGrade < *u.Grade) {
+		return fmt.Errorf("%w: grade: %d 이상 %d 이하여야 합니다", ErrInvalidField, MinGrade, MaxGrade)
+	}
+	if u.Attendance != nil {
+		switch *u.Attendance {
+		case Attending, Absent, Graduate:
+		default:
+			return fmt.Errorf("%w: attendance: 재학(%d), 휴학(%d), 졸업(%d) 중 하나여야 합니다", ErrInvalidField, Attending, Absent, Graduate)
+		}
+	}
+	return nil
+}
+
+// document returns the $set document of u.
+func (u Update) document() map[string]interface{} {
+	update := make(map[string]interface{})
+
+	if u.Phone != nil {
+		update["phone"] = *u.Phone
+	}
+	if u.Email != nil {
+		update["email"] = *u.Email
+	}
+	if u.Department != nil {
+		update["department"] = strings.TrimSpace(*u.Department)
+	}
+	if u.Grade != nil {
+		update["grade"] = *u.Grade
+	}
+	if u.Attendance != nil {
+		update["attendance"] = *u.Attendance
+	}
+	if u.Approved != nil {
+		update["approved"] = *u.Approved
+	}
+	return update
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oauth2 provides OAuth 2.0 verification.
+package oauth2
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a TokenStore which keeps the refresh tokens and the sessions in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]RefreshToken
+	sessions Sessions
+}
+
+// NewMemoryStore returns a new empty TokenStore.
+func NewMemoryStore() *MemoryStore { return &MemoryStore{tokens: make(map[string]RefreshToken)} }
+
+// Get implements TokenStore.
+func (s *MemoryStore) Get(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rt, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return &rt, nil
+}
+
+// Insert implements TokenStore.
+func (s *MemoryStore) Insert(_ context.Context, rt RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[rt.Hash] = rt
+	return nil
+}
+
+// Use implements TokenStore.
+func (s *MemoryStore) Use(_ context.Context, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[hash]
+	if !ok || rt.Used {
+		return false, nil
+	}
+	rt.Used = true
+	s.tokens[hash] = rt
+	return true, nil
+}
+
+// RevokeFamily implements TokenStore.
+func (s *MemoryStore) RevokeFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, rt := range s.tokens {
+		if rt.Family == family {
+			rt.Revoked = true
+			s.tokens[hash] = rt
+		}
+	}
+	return nil
+}
+
+// GetSession implements TokenStore.
+func (s *MemoryStore) GetSession(_ context.Context, id string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.ID == id {
+			return &session, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// FindSessions implements TokenStore.
+func (s *MemoryStore) FindSessions(_ context.Context, memberID string) (sessions Sessions, _ error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.MemberID == memberID {
+			sessions = append(sessions, session)
+		}
+	}
+	return
+}
+
+// InsertSession implements TokenStore.
+func (s *MemoryStore) InsertSession(_ context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+// TouchSession implements TokenStore.
+func (s *MemoryStore) TouchSession(_ context.Context, id string, lastUsedAt, expiredAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx := range s.sessions {
+		if s.sessions[idx].ID == id {
+			s.sessions[idx].LastUsedAt, s.sessions[idx].ExpiredAt = lastUsedAt, expiredAt
+		}
+	}
+	return nil
+}
+
+// RevokeSessions implements TokenStore.
+func (s *MemoryStore) RevokeSessions(_ context.Context, memberID string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx, session := range s.sessions {
+		if session.MemberID != memberID {
+			continue
+		}
+		if ids == nil {
+			s.sessions[idx].Revoked = true
+			continue
+		}
+		for _, id := range ids {
+			if session.ID == id {
+				s.sessions[idx].Revoked = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oauth2 provides OAuth 2.0 verification.
+package oauth2
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore is a TokenStore backed by MongoDB.
+type MongoStore struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// NewMongoStore returns a new TokenStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoStore(db *mongo.Database, timeout time.Duration) *MongoStore {
+	return &MongoStore{db: db, timeout: timeout}
+}
+
+// do runs fn against the club database within the operation timeout.
+func (s *MongoStore) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx, s.db)
+}
+
+// Get implements TokenStore.
+func (s *MongoStore) Get(ctx context.Context, hash string) (rt *RefreshToken, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		rt = new(RefreshToken)
+		err := db.Collection("tokens").FindOne(ctx, bson.D{bson.E{Key: "_id", Value: hash}}).Decode(rt)
+		if err == mongo.ErrNoDocuments {
+			return ErrInvalidToken
+		}
+		return err
+	})
+	return
+}
+
+// Insert implements TokenStore.
+func (s *MongoStore) Insert(ctx context.Context, rt RefreshToken) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("tokens").InsertOne(ctx, rt)
+		return err
+	})
+}
+
+// Use implements TokenStore.
+func (s *MongoStore) Use(ctx context.Context, hash string) (ok bool, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		res, err := db.Collection("tokens").UpdateOne(ctx,
+			bson.D{bson.E{Key: "_id", Value: hash}, bson.E{Key: "used", Value: false}},
+			bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "used", Value: true}}}})
+		if err != nil {
+			return err
+		}
+		ok = res.ModifiedCount == 1
+		return nil
+	})
+	return
+}
+
+// RevokeFamily implements TokenStore.
+func (s *MongoStore) RevokeFamily(ctx context.Context, family string) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("tokens").UpdateMany(ctx,
+			bson.D{bson.E{Key: "family", Value: family}},
+			bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "revoked", Value: true}}}})
+		return err
+	})
+}
+
+// GetSession implements TokenStore.
+func (s *MongoStore) GetSession(ctx context.Context, id string) (session *Session, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		session = new(Session)
+		err := db.Collection("sessions").FindOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}).Decode(session)
+		if err == mongo.ErrNoDocuments {
+			return ErrInvalidToken
+		}
+		return err
+	})
+	return
+}
+
+// FindSessions implements TokenStore.
+func (s *MongoStore) FindSessions(ctx context.Context, memberID string) (sessions Sessions, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("sessions").Find(ctx, bson.D{bson.E{Key: "member_id", Value: memberID}})
+		if err != nil {
+			return err
+		}
+
+		session := new(Session)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(session); err != nil {
+				return err
+			}
+			sessions = append(sessions, *session)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// InsertSession implements TokenStore.
+func (s *MongoStore) InsertSession(ctx context.Context, session Session) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("sessions").InsertOne(ctx, session)
+		return err
+	})
+}
+
+// TouchSession implements TokenStore.
+func (s *MongoStore) TouchSession(ctx context.Context, id string, lastUsedAt, expiredAt int64) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("sessions").UpdateOne(ctx,
+			bson.D{bson.E{Key: "_id", Value: id}},
+			bson.D{bson.E{Key: "$set", Value: bson.D{
+				bson.E{Key: "last_used_at", Value: lastUsedAt},
+				bson.E{Key: "expired_at", Value: expiredAt},
+			}}})
+		return err
+	})
+}
+
+// RevokeSessions implements TokenStore.
+func (s *MongoStore) RevokeSessions(ctx context.Context, memberID string, ids []string) error {
+	filter := bson.D{bson.E{Key: "member_id", Value: memberID}}
+	if ids != nil {
+		arr := make(bson.A, len(ids))
+		for idx, id := range ids {
+			arr[idx] = id
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("sessions").UpdateMany(ctx, filter,
+			bson.D{bson.E{Key: "$set", Value: bson.D{bson.E{Key: "revoked", Value: true}}}})
+		return err
+	})
+}
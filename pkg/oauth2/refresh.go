@@ -0,0 +1,149 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oauth2 provides OAuth 2.0 verification.
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrTokenReused = errors.New("refresh token reused")
+
+// RefreshToken represents the stored state of a refresh token.
+// The token itself is never stored, only its SHA-256 hash.
+//
+// Every refresh token is used only once: refreshing issues a new one of the same family.
+// Presenting an used refresh token again revokes the whole family,
+// since either the legitimate client or an attacker holds a stolen copy.
+type RefreshToken struct {
+	Hash      string `json:"-" bson:"_id"`                        // SHA-256 hash of the token
+	Family    string `json:"family" bson:"family"`                // ID of the session the token is rotated in
+	MemberID  string `json:"member_id" bson:"member_id"`          // owner of the token
+	Used      bool   `json:"used" bson:"used"`                    // already exchanged or not
+	Revoked   bool   `json:"revoked" bson:"revoked"`              // revoked or not
+	CreatedAt int64  `json:"created_at,string" bson:"created_at"` // when issued - Unix timestamp
+	ExpiredAt int64  `json:"expired_at,string" bson:"expired_at"` // when expires - Unix timestamp
+}
+
+// Pair represents an access token with its refresh token.
+type Pair struct {
+	AccessToken      Token  `json:"access_token"`
+	ExpiredAt        int64  `json:"expired_at,string"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiredAt int64  `json:"refresh_expired_at,string"`
+}
+
+// Issue starts a new session on device for the member of id,
+// and issues its first token pair.
+func Issue(ctx context.Context, id string, device Device) (*Pair, error) {
+	now := time.Now()
+	session := Session{
+		ID:         primitive.NewObjectID().Hex(),
+		MemberID:   id,
+		Device:     device,
+		CreatedAt:  now.Unix(),
+		LastUsedAt: now.Unix(),
+		ExpiredAt:  now.Add(config.RefreshTokenTTL).Unix(),
+	}
+
+	if err := store.InsertSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return issue(ctx, id, session.ID)
+}
+
+// Refresh exchanges refreshToken for a new token pair of the same session.
+// It returns ErrTokenReused and revokes the session if refreshToken is already used.
+func Refresh(ctx context.Context, refreshToken string) (*Pair, error) {
+	rt, err := store.Get(ctx, hash(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if rt.Revoked || rt.ExpiredAt <= time.Now().Unix() {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := store.GetSession(ctx, rt.Family)
+	if err != nil {
+		return nil, err
+	}
+	if !session.active() {
+		return nil, ErrInvalidToken
+	}
+
+	if ok, err := store.Use(ctx, rt.Hash); err != nil {
+		return nil, err
+	} else if !ok {
+		if err = store.RevokeFamily(ctx, rt.Family); err != nil {
+			return nil, err
+		}
+		if err = Revoke(ctx, rt.MemberID, []string{rt.Family}); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	}
+
+	pair, err := issue(ctx, rt.MemberID, rt.Family)
+	if err != nil {
+		return nil, err
+	}
+	return pair, store.TouchSession(ctx, rt.Family, time.Now().Unix(), pair.RefreshExpiredAt)
+}
+
+// issue issues a new token pair of session for the member of id.
+func issue(ctx context.Context, id, session string) (*Pair, error) {
+	pair := new(Pair)
+
+	var err error
+	if pair.AccessToken, pair.ExpiredAt, err = NewToken(id, session); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pair.RefreshToken = base64.RawURLEncoding.EncodeToString(buf)
+	pair.RefreshExpiredAt = now.Add(config.RefreshTokenTTL).Unix()
+
+	if err = store.Insert(ctx, RefreshToken{
+		Hash:      hash(pair.RefreshToken),
+		Family:    session,
+		MemberID:  id,
+		CreatedAt: now.Unix(),
+		ExpiredAt: pair.RefreshExpiredAt,
+	}); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// hash returns the hex encoded SHA-256 hash of token.
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oauth2 provides OAuth 2.0 verification.
+package oauth2
+
+import (
+	"context"
+	"time"
+)
+
+// Device represents the client which signed in.
+type Device struct {
+	Name      string `json:"device" bson:"device"`         // device name given by the client
+	UserAgent string `json:"user_agent" bson:"user_agent"` // User-Agent header
+	IP        string `json:"ip" bson:"ip"`                 // client IP address
+}
+
+// Session represents a signin of a member.
+// Every token issued from the signin, including the rotated refresh tokens,
+// belongs to the session and dies with it.
+type Session struct {
+	ID         string `json:"id" bson:"_id"`
+	MemberID   string `json:"member_id" bson:"member_id"`
+	Device     `bson:",inline"`
+	Revoked    bool  `json:"-" bson:"revoked"`
+	CreatedAt  int64 `json:"created_at,string" bson:"created_at"`     // when signed in - Unix timestamp
+	LastUsedAt int64 `json:"last_used_at,string" bson:"last_used_at"` // when refreshed last - Unix timestamp
+	ExpiredAt  int64 `json:"expired_at,string" bson:"expired_at"`     // when the last refresh token expires - Unix timestamp
+}
+
+type Sessions []Session
+
+// active reports whether s is neither revoked nor expired.
+func (s Session) active() bool {
+	return !s.Revoked && time.Now().Unix() < s.ExpiredAt
+}
+
+// ActiveSessions returns the active sessions of the member of id.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//
+//	Only the authenticated members can access to this operation.
+func ActiveSessions(ctx context.Context, id string) (Sessions, error) {
+	sessions, err := store.FindSessions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	actives := Sessions{}
+	for _, session := range sessions {
+		if session.active() {
+			actives = append(actives, session)
+		}
+	}
+	return actives, nil
+}
+
+// Revoke revokes the sessions of ids of the member of id.
+// If ids is nil, it revokes every session of the member, namely forces logout.
+func Revoke(ctx context.Context, id string, ids []string) error {
+	return store.RevokeSessions(ctx, id, ids)
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oauth2 provides OAuth 2.0 verification.
+package oauth2
+
+import "context"
+
+// TokenStore is the persistence layer of the refresh tokens and the sessions.
+type TokenStore interface {
+	// Get returns the refresh token of hash.
+	// It returns ErrInvalidToken if there is no such token.
+	Get(ctx context.Context, hash string) (*RefreshToken, error)
+	// Insert inserts rt.
+	Insert(ctx context.Context, rt RefreshToken) error
+	// Use marks the refresh token of hash as used,
+	// and reports whether it was unused before, atomically.
+	Use(ctx context.Context, hash string) (bool, error)
+	// RevokeFamily revokes every refresh token of family.
+	RevokeFamily(ctx context.Context, family string) error
+	// GetSession returns the session of id.
+	// It returns ErrInvalidToken if there is no such session.
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// FindSessions returns the sessions of the member of memberID.
+	FindSessions(ctx context.Context, memberID string) (Sessions, error)
+	// InsertSession inserts session.
+	InsertSession(ctx context.Context, session Session) error
+	// TouchSession updates the last used time and the expiry of the session of id.
+	TouchSession(ctx context.Context, id string, lastUsedAt, expiredAt int64) error
+	// RevokeSessions revokes the sessions of ids of the member of memberID.
+	// If ids is nil, it revokes every session of the member.
+	RevokeSessions(ctx context.Context, memberID string, ids []string) error
+}
+
+var store TokenStore
+
+// SetStore sets the persistence layer of the refresh tokens and the sessions to s.
+func SetStore(s TokenStore) { store = s }
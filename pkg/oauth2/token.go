@@ -22,47 +22,77 @@ import (
 
 	"github.com/golang-jwt/jwt"
 	"github.com/kmu-kcc/buddy-backend/config"
-	"github.com/kmu-kcc/buddy-backend/pkg/member"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Token represents an access token.
 type Token string
 
-var (
-	tokens = make(map[Token]map[string]interface{})
+var ErrInvalidToken = errors.New("invalid token")
 
-	ErrInvalidToken = errors.New("invalid token")
-)
-
-// NewToken generates an access token.
-func NewToken(id string) (Token, int64, error) {
-	atClaims := make(jwt.MapClaims)
-	exp := time.Now().Add(6 * time.Hour).Unix()
+// claims represents the claims of an access token.
+type claims struct {
+	jwt.StandardClaims
+	Session string `json:"sid"` // session ID
+}
 
-	atClaims["authorized"] = true
-	atClaims["id"] = id
-	atClaims["expire"] = exp
+// NewToken generates an access token of session for the member of id.
+// It expires after config.AccessTokenTTL.
+func NewToken(id, session string) (Token, int64, error) {
+	now := time.Now()
+	exp := now.Add(config.AccessTokenTTL).Unix()
+
+	at := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        primitive.NewObjectID().Hex(),
+			Subject:   id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: exp,
+		},
+		Session: session,
+	})
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
 	token, err := at.SignedString([]byte(config.AccessSecret))
 	if err != nil {
 		return "", 0, err
 	}
-	tokens[Token(token)] = make(map[string]interface{})
-	tokens[Token(token)]["id"] = id
-	tokens[Token(token)]["exp"] = exp
+	return Token(token), exp, nil
+}
 
-	time.AfterFunc(6*time.Hour, func() { delete(tokens, Token(token)) })
+// claims returns the verified claims of t.
+func (t Token) claims() (*claims, error) {
+	c := new(claims)
 
-	return Token(token), exp, err
+	_, err := jwt.ParseWithClaims(string(t), c, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(config.AccessSecret), nil
+	})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// exp, iat and sub are optional in jwt.StandardClaims.Valid, but not for us.
+	if c.ExpiresAt == 0 || c.IssuedAt == 0 || c.Subject == "" || c.Session == "" {
+		return nil, ErrInvalidToken
+	}
+	return c, nil
 }
 
 // Valid reports whether t is valid or not.
-func (t Token) Valid() error {
-	if _, exists := tokens[t]; !exists {
+// t is valid if it is signed by us, not expired, and its session is not revoked.
+func (t Token) Valid(ctx context.Context) error {
+	c, err := t.claims()
+	if err != nil {
+		return err
+	}
+
+	session, err := store.GetSession(ctx, c.Session)
+	if err != nil {
+		return err
+	}
+	if !session.active() || session.MemberID != c.Subject {
 		return ErrInvalidToken
 	}
 	return nil
@@ -70,26 +100,27 @@ func (t Token) Valid() error {
 
 // ID returns the id of t.
 func (t Token) ID() string {
-	meta, ok := tokens[t]
-	if !ok {
+	c, err := t.claims()
+	if err != nil {
 		return ""
 	}
-	return meta["id"].(string)
+	return c.Subject
 }
 
-// Role returns the role corresponding to t.
-func (t Token) Role() (member.Role, error) {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+// Session returns the session ID of t.
+func (t Token) Session() string {
+	c, err := t.claims()
 	if err != nil {
-		return member.Role{}, err
+		return ""
 	}
-	defer client.Disconnect(ctx)
-
-	memb := new(member.Member)
+	return c.Session
+}
 
-	if err = client.Database("club").Collection("members").FindOne(ctx, bson.D{bson.E{Key: "id", Value: t.ID()}}).Decode(memb); err != nil {
-		return member.Role{}, err
+// Revoke revokes the session of t, namely logs out.
+func (t Token) Revoke(ctx context.Context) error {
+	c, err := t.claims()
+	if err != nil {
+		return err
 	}
-	return memb.Role, nil
+	return Revoke(ctx, c.Subject, []string{c.Session})
 }
@@ -15,22 +15,203 @@
 package oauth2_test
 
 import (
+	"context"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt"
+	"github.com/kmu-kcc/buddy-backend/config"
 	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
 )
 
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	config.AccessSecret = "secret"
+	oauth2.SetStore(oauth2.NewMemoryStore())
+	os.Exit(m.Run())
+}
+
 func TestNewToken(t *testing.T) {
-	token, exp, err := oauth2.NewToken("20210001")
+	pair, err := oauth2.Issue(ctx, "20210001", oauth2.Device{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, exp, err := oauth2.NewToken("20210001", pair.AccessToken.Session())
 	if err != nil {
 		t.Error(err)
 	}
 
 	t.Logf("token: %s\nexpired_at: %d", token, exp)
 
-	if err = token.Valid(); err != nil {
+	if err = token.Valid(ctx); err != nil {
 		t.Error(err)
 	}
 
-	t.Logf("ID: %s", token.ID())
+	if id := token.ID(); id != "20210001" {
+		t.Errorf("expected 20210001, got %s", id)
+	}
+
+	// a token of an unknown session or of the other member is not valid
+	for _, token := range []oauth2.Token{
+		mustToken(t, "20210001", "unknown"),
+		mustToken(t, "20210002", pair.AccessToken.Session()),
+	} {
+		if err = token.Valid(ctx); err != oauth2.ErrInvalidToken {
+			t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+		}
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	pair, err := oauth2.Issue(ctx, "20210001", oauth2.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := pair.AccessToken.Session()
+
+	sign := func(claims jwt.StandardClaims, secret string) oauth2.Token {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, struct {
+			jwt.StandardClaims
+			Session string `json:"sid"`
+		}{claims, session}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oauth2.Token(token)
+	}
+
+	now := time.Now()
+	for name, token := range map[string]oauth2.Token{
+		"malformed":      "abc.def.ghi",
+		"wrong secret":   sign(jwt.StandardClaims{Subject: "20210001", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}, "wrong"),
+		"expired":        sign(jwt.StandardClaims{Subject: "20210001", IssuedAt: now.Add(-2 * time.Hour).Unix(), ExpiresAt: now.Add(-time.Hour).Unix()}, "secret"),
+		"missing exp":    sign(jwt.StandardClaims{Subject: "20210001", IssuedAt: now.Unix()}, "secret"),
+		"missing iat":    sign(jwt.StandardClaims{Subject: "20210001", ExpiresAt: now.Add(time.Hour).Unix()}, "secret"),
+		"missing sub":    sign(jwt.StandardClaims{IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}, "secret"),
+		"issued in past": sign(jwt.StandardClaims{Subject: "20210001", IssuedAt: now.Add(time.Hour).Unix(), ExpiresAt: now.Add(2 * time.Hour).Unix()}, "secret"),
+	} {
+		if err := token.Valid(ctx); err != oauth2.ErrInvalidToken {
+			t.Errorf("%s: expected %v, got %v", name, oauth2.ErrInvalidToken, err)
+		}
+		if id := token.ID(); id != "" {
+			t.Errorf("%s: expected empty ID, got %s", name, id)
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	pair, err := oauth2.Issue(ctx, "20210001", oauth2.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pair.AccessToken.Valid(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := oauth2.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Error("refresh token is not rotated")
+	}
+	if id := rotated.AccessToken.ID(); id != "20210001" {
+		t.Errorf("expected 20210001, got %s", id)
+	}
+
+	if _, err = oauth2.Refresh(ctx, "unknown"); err != oauth2.ErrInvalidToken {
+		t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+	}
+}
+
+func TestRefreshReuse(t *testing.T) {
+	pair, err := oauth2.Issue(ctx, "20210001", oauth2.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := oauth2.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stolen copy of the first refresh token revokes the whole family
+	if _, err = oauth2.Refresh(ctx, pair.RefreshToken); err != oauth2.ErrTokenReused {
+		t.Errorf("expected %v, got %v", oauth2.ErrTokenReused, err)
+	}
+	if _, err = oauth2.Refresh(ctx, rotated.RefreshToken); err != oauth2.ErrInvalidToken {
+		t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+	}
+
+	// the other families are not affected
+	other, err := oauth2.Issue(ctx, "20210001", oauth2.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = oauth2.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	laptop, err := oauth2.Issue(ctx, "20210003", oauth2.Device{Name: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := oauth2.Issue(ctx, "20210003", oauth2.Device{Name: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sessions, err := oauth2.ActiveSessions(ctx, "20210003"); err != nil {
+		t.Error(err)
+	} else if len(sessions) != 2 {
+		t.Errorf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	// logout revokes both the access token and the refresh token of the session
+	if err = laptop.AccessToken.Revoke(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = laptop.AccessToken.Valid(ctx); err != oauth2.ErrInvalidToken {
+		t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+	}
+	if _, err = oauth2.Refresh(ctx, laptop.RefreshToken); err != oauth2.ErrInvalidToken {
+		t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+	}
+	if err = phone.AccessToken.Valid(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if sessions, err := oauth2.ActiveSessions(ctx, "20210003"); err != nil {
+		t.Error(err)
+	} else if len(sessions) != 1 || sessions[0].Name != "phone" {
+		t.Errorf("expected the phone session only, got %v", sessions)
+	}
+
+	// the other member can not revoke the sessions
+	if err = oauth2.Revoke(ctx, "20210001", []string{phone.AccessToken.Session()}); err != nil {
+		t.Fatal(err)
+	}
+	if err = phone.AccessToken.Valid(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if err = oauth2.Revoke(ctx, "20210003", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = phone.AccessToken.Valid(ctx); err != oauth2.ErrInvalidToken {
+		t.Errorf("expected %v, got %v", oauth2.ErrInvalidToken, err)
+	}
+}
+
+func mustToken(t *testing.T, id, session string) oauth2.Token {
+	token, _, err := oauth2.NewToken(id, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
 }
@@ -0,0 +1,145 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pdf provides a minimal PDF writer of the text documents in Korean.
+//
+// The documents use the predefined Korean CID font of the PDF readers without embedding it,
+// so they are small but are rendered with the Korean font of each reader.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// The size of an A4 page in points.
+const (
+	Width  = 595.28
+	Height = 841.89
+)
+
+// font is the predefined Korean font of the Adobe-Korea1 character collection.
+const font = "HYGoThic-Medium"
+
+// Document represents a PDF document of pages.
+// The origin of a page is the lower-left corner.
+type Document struct {
+	pages []*bytes.Buffer
+}
+
+// New returns a new empty document.
+func New() *Document { return &Document{} }
+
+// AddPage adds a new A4 page to d, where the following drawings go.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+// page returns the current page, adding one if d is empty.
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text draws text of size at x and y of the baseline.
+func (d *Document) Text(x, y, size float64, text string) {
+	fmt.Fprintf(d.page(), "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, y, encode(text))
+}
+
+// TextRight draws text of size whose right end is at x.
+func (d *Document) TextRight(x, y, size float64, text string) {
+	d.Text(x-TextWidth(text, size), y, size, text)
+}
+
+// Line draws a line from x1, y1 to x2, y2.
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// TextWidth returns the width of text of size,
+// where the ASCII characters are half as wide as the others.
+func TextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r < 0x80 {
+			width += size / 2
+		} else {
+			width += size
+		}
+	}
+	return width
+}
+
+// encode returns the hexadecimal UCS-2 encoding of text.
+// The characters out of the Basic Multilingual Plane are replaced with "?".
+func encode(text string) string {
+	buf := new(bytes.Buffer)
+	for _, r := range text {
+		if r > 0xffff {
+			r = '?'
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(buf, "%04X", u)
+		}
+	}
+	return buf.String()
+}
+
+// WriteTo writes d to w in PDF.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	d.page()
+
+	// the objects are numbered from 1: catalog, pages, font, descendant font, font descriptor,
+	// and then a page and its contents for each page.
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // pages, filled below
+		fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /UniKS-UCS2-H /DescendantFonts [4 0 R] >>", font),
+		fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Korea1) /Supplement 1 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>", font),
+		fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 4 /FontBBox [-6 -145 1003 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>", font),
+	}
+
+	kids := new(bytes.Buffer)
+	for _, content := range d.pages {
+		page := len(objects) + 1
+		fmt.Fprintf(kids, "%d 0 R ", page)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", Width, Height, page+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", bytes.TrimSpace(kids.Bytes()), len(d.pages))
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+	for idx, object := range objects {
+		offsets[idx] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", idx+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.WriteTo(w)
+}
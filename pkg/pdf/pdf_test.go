@@ -0,0 +1,74 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/pdf"
+)
+
+func TestWriteTo(t *testing.T) {
+	doc := pdf.New()
+	doc.Text(50, 800, 12, "회비 납부 내역서")
+	doc.TextRight(545, 780, 10, "15,000")
+	doc.Line(50, 770, 545, 770)
+	doc.AddPage()
+	doc.Text(50, 800, 12, "2")
+
+	buf := new(bytes.Buffer)
+	if _, err := doc.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "%PDF-1.4\n") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatalf("malformed document: %q", out)
+	}
+	if !strings.Contains(out, "/Count 2") {
+		t.Errorf("expected 2 pages")
+	}
+	// "회비" in UCS-2
+	if !strings.Contains(out, "<D68CBE44") {
+		t.Errorf("expected the encoded text")
+	}
+
+	// every object is at the offset of the cross-reference table
+	xref := strings.Index(out, "xref\n")
+	if start := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(out); start == nil || start[1] != strconv.Itoa(xref) {
+		t.Errorf("expected startxref %d, got %v", xref, start)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllStringSubmatch(out, -1)
+	if len(offsets) != 9 {
+		t.Fatalf("expected 9 objects, got %d", len(offsets))
+	}
+	for idx, offset := range offsets {
+		at, _ := strconv.Atoi(offset[1])
+		if !strings.HasPrefix(out[at:], fmt.Sprintf("%d 0 obj", idx+1)) {
+			t.Errorf("object %d is not at %d", idx+1, at)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if width := pdf.TextWidth("회비 15,000", 10); width != 20+5*7 {
+		t.Errorf("expected %d, got %f", 20+5*7, width)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemoryRoleStore is a RoleStore which keeps the roles in memory.
+// It is safe for concurrent use.
+type MemoryRoleStore struct {
+	mu    sync.RWMutex
+	roles Roles
+}
+
+// NewMemoryRoleStore returns a new empty RoleStore.
+func NewMemoryRoleStore() *MemoryRoleStore { return &MemoryRoleStore{} }
+
+// Get implements RoleStore.
+func (s *MemoryRoleStore) Get(_ context.Context, name string) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if idx := s.index(name); idx != -1 {
+		role := s.roles[idx].clone()
+		return &role, nil
+	}
+	return nil, ErrRoleNotFound
+}
+
+// Find implements RoleStore.
+func (s *MemoryRoleStore) Find(context.Context) (Roles, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make(Roles, len(s.roles))
+	for idx, role := range s.roles {
+		roles[idx] = role.clone()
+	}
+	return roles, nil
+}
+
+// Insert implements RoleStore.
+func (s *MemoryRoleStore) Insert(_ context.Context, role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(role.Name) != -1 {
+		return ErrRoleExists
+	}
+	s.roles = append(s.roles, role.clone())
+	return nil
+}
+
+// Update implements RoleStore.
+func (s *MemoryRoleStore) Update(_ context.Context, name string, update map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.index(name)
+	if idx == -1 {
+		return nil
+	}
+
+	role := s.roles[idx]
+	if err := set(&role, update); err != nil {
+		return err
+	}
+	s.roles[idx] = role
+	return nil
+}
+
+// Delete implements RoleStore.
+func (s *MemoryRoleStore) Delete(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idx := s.index(name); idx != -1 {
+		s.roles = append(s.roles[:idx], s.roles[idx+1:]...)
+	}
+	return nil
+}
+
+// index returns the index of the role of name, or -1 if not present.
+func (s *MemoryRoleStore) index(name string) int {
+	for idx, role := range s.roles {
+		if role.Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// clone returns a deep copy of r.
+func (r Role) clone() Role {
+	r.Permissions = append(make(Permissions, 0, len(r.Permissions)), r.Permissions...)
+	return r
+}
+
+// MemoryGrantStore is a GrantStore which keeps the grants in memory.
+// It is safe for concurrent use.
+type MemoryGrantStore struct {
+	mu     sync.RWMutex
+	grants Grants
+}
+
+// NewMemoryGrantStore returns a new empty GrantStore.
+func NewMemoryGrantStore() *MemoryGrantStore { return &MemoryGrantStore{} }
+
+// Find implements GrantStore.
+func (s *MemoryGrantStore) Find(_ context.Context, filter GrantFilter) (grants Grants, _ error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, grant := range s.grants {
+		if filter.Match(grant) {
+			grants = append(grants, grant)
+		}
+	}
+	return
+}
+
+// Upsert implements GrantStore.
+func (s *MemoryGrantStore) Upsert(_ context.Context, grant Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx := range s.grants {
+		if s.grants[idx].ID == grant.ID {
+			s.grants[idx] = grant
+			return nil
+		}
+	}
+	s.grants = append(s.grants, grant)
+	return nil
+}
+
+// Delete implements GrantStore.
+func (s *MemoryGrantStore) Delete(_ context.Context, filter GrantFilter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grants := s.grants[:0]
+	for _, grant := range s.grants {
+		if !filter.Match(grant) {
+			grants = append(grants, grant)
+		}
+	}
+	s.grants = grants
+	return nil
+}
+
+// set applies update to v in the same way as the MongoDB $set operator does,
+// by round-tripping v through its bson representation.
+func set(v interface{}, update map[string]interface{}) error {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	doc := make(bson.M)
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for key, value := range update {
+		doc[key] = value
+	}
+
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, v)
+}
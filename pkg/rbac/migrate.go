@@ -0,0 +1,92 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+import (
+	"context"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+)
+
+// Migrate grants the built-in roles equivalent to the legacy member.Role booleans,
+// and then clears the booleans.
+// It is idempotent, so it is safe to run on every startup.
+func Migrate(ctx context.Context) error {
+	members, err := member.Find(ctx, member.Filter{})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	migrated := []string{}
+
+	for _, memb := range members {
+		names := legacy(memb.Role)
+		if len(names) == 0 {
+			continue
+		}
+
+		grants, err := grantStore.Find(ctx, GrantFilter{MemberIDs: []string{memb.ID}})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if granted(grants, name) {
+				continue
+			}
+			if err = grantStore.Upsert(ctx, Grant{
+				ID:        name + "/" + memb.ID,
+				Role:      name,
+				MemberID:  memb.ID,
+				CreatedAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+		migrated = append(migrated, memb.ID)
+	}
+
+	return member.ClearLegacyRoles(ctx, migrated)
+}
+
+// legacy returns the names of the built-in roles equivalent to role.
+func legacy(role member.Role) (names []string) {
+	if role.Master {
+		names = append(names, Master)
+	}
+	if role.MemberManagement {
+		names = append(names, MemberManager)
+	}
+	if role.ActivityManagement {
+		names = append(names, ActivityManager)
+	}
+	if role.FeeManagement {
+		names = append(names, FeeManager)
+	}
+	return
+}
+
+// granted reports whether grants has a grant of the role of name.
+func granted(grants Grants, name string) bool {
+	for _, grant := range grants {
+		if grant.Role == name {
+			return true
+		}
+	}
+	return false
+}
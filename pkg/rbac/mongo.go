@@ -0,0 +1,184 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDB is the club database of a MongoDB with an operation timeout.
+type mongoDB struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// do runs fn against the club database within the operation timeout.
+func (m mongoDB) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	return fn(ctx, m.db)
+}
+
+// MongoRoleStore is a RoleStore backed by MongoDB.
+type MongoRoleStore struct {
+	mongoDB
+}
+
+// NewMongoRoleStore returns a new RoleStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoRoleStore(db *mongo.Database, timeout time.Duration) *MongoRoleStore {
+	return &MongoRoleStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Get implements RoleStore.
+func (s *MongoRoleStore) Get(ctx context.Context, name string) (role *Role, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		role = new(Role)
+		err := db.Collection("roles").FindOne(ctx, bson.D{bson.E{Key: "_id", Value: name}}).Decode(role)
+		if err == mongo.ErrNoDocuments {
+			return ErrRoleNotFound
+		}
+		return err
+	})
+	return
+}
+
+// Find implements RoleStore.
+func (s *MongoRoleStore) Find(ctx context.Context) (roles Roles, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("roles").Find(ctx, bson.D{})
+		if err != nil {
+			return err
+		}
+
+		role := new(Role)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(role); err != nil {
+				return err
+			}
+			roles = append(roles, *role)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements RoleStore.
+func (s *MongoRoleStore) Insert(ctx context.Context, role Role) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("roles").InsertOne(ctx, role)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrRoleExists
+		}
+		return err
+	})
+}
+
+// Update implements RoleStore.
+func (s *MongoRoleStore) Update(ctx context.Context, name string, update map[string]interface{}) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("roles").UpdateOne(ctx, bson.D{bson.E{Key: "_id", Value: name}}, bson.D{bson.E{Key: "$set", Value: update}})
+		return err
+	})
+}
+
+// Delete implements RoleStore.
+func (s *MongoRoleStore) Delete(ctx context.Context, name string) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("roles").DeleteOne(ctx, bson.D{bson.E{Key: "_id", Value: name}})
+		return err
+	})
+}
+
+// MongoGrantStore is a GrantStore backed by MongoDB.
+type MongoGrantStore struct {
+	mongoDB
+}
+
+// NewMongoGrantStore returns a new GrantStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoGrantStore(db *mongo.Database, timeout time.Duration) *MongoGrantStore {
+	return &MongoGrantStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements GrantStore.
+func (s *MongoGrantStore) Find(ctx context.Context, filter GrantFilter) (grants Grants, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("grants").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		grant := new(Grant)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(grant); err != nil {
+				return err
+			}
+			grants = append(grants, *grant)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Upsert implements GrantStore.
+func (s *MongoGrantStore) Upsert(ctx context.Context, grant Grant) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("grants").ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: grant.ID}}, grant, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+// Delete implements GrantStore.
+func (s *MongoGrantStore) Delete(ctx context.Context, filter GrantFilter) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("grants").DeleteMany(ctx, filter.document())
+		return err
+	})
+}
+
+// document returns the MongoDB query document of f.
+func (f GrantFilter) document() bson.D {
+	filter := bson.D{}
+
+	if f.Roles != nil {
+		filter = append(filter, bson.E{Key: "role", Value: bson.D{bson.E{Key: "$in", Value: array(f.Roles)}}})
+	}
+	if f.MemberIDs != nil {
+		filter = append(filter, bson.E{Key: "member_id", Value: bson.D{bson.E{Key: "$in", Value: array(f.MemberIDs)}}})
+	}
+	return filter
+}
+
+func array(strs []string) bson.A {
+	arr := make(bson.A, len(strs))
+	for idx, str := range strs {
+		arr[idx] = str
+	}
+	return arr
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+// Permission represents an operation a member may be allowed to.
+type Permission string
+
+const (
+	MemberRead           Permission = "member.read"            // list the signups, exits and graduates, and read the private member informations
+	MemberApprove        Permission = "member.approve"         // approve the signups
+	MemberDelete         Permission = "member.delete"          // refuse the signups and delete the members
+	MemberUpdate         Permission = "member.update"          // update the other members, and the grade, attendance and approval
+	MemberActivate       Permission = "member.activate"        // open and close the signup
+	MemberSessionsRevoke Permission = "member.sessions.revoke" // force the other members to logout
+	RoleManage           Permission = "role.manage"            // manage the roles and their grants
+	ActivityCreate       Permission = "activity.create"        // create the activities
+	ActivityUpdate       Permission = "activity.update"        // update the activities
+	ActivityDelete       Permission = "activity.delete"        // delete the activities
+	ActivityPrivateRead  Permission = "activity.private.read"  // read the private activities
+	ActivityFilesUpload  Permission = "activity.files.upload"  // upload the activity files
+	ActivityFilesDelete  Permission = "activity.files.delete"  // delete the activity files
+	ActivityCheckIn      Permission = "activity.checkin"       // open and close the check-ins, and read the attendances
+	FeeCreate            Permission = "fee.create"             // create the fees
+	FeeRead              Permission = "fee.read"               // read the payers, the deptors and the amount of the other members
+	FeePay               Permission = "fee.pay"                // record the payments
+	FeeDeposit           Permission = "fee.deposit"            // record the deposits
+	FeeExempt            Permission = "fee.exempt"             // exempt the members
+	FeeExpend            Permission = "fee.expend"             // record the expenses
+	FeeCheck             Permission = "fee.check"              // find and repair the orphaned fee logs
+	FeeClose             Permission = "fee.close"              // close and reopen the semesters, and recompute the carry-overs
+	FeeReverse           Permission = "fee.reverse"            // reverse the fee logs
+	AuditRead            Permission = "audit.read"             // read the audit log
+)
+
+// Permissions represents a set of permissions.
+type Permissions []Permission
+
+// All is every permission.
+var All = Permissions{
+	MemberRead,
+	MemberApprove,
+	MemberDelete,
+	MemberUpdate,
+	MemberActivate,
+	MemberSessionsRevoke,
+	RoleManage,
+	ActivityCreate,
+	ActivityUpdate,
+	ActivityDelete,
+	ActivityPrivateRead,
+	ActivityFilesUpload,
+	ActivityFilesDelete,
+	ActivityCheckIn,
+	FeeCreate,
+	FeeRead,
+	FeePay,
+	FeeDeposit,
+	FeeExempt,
+	FeeExpend,
+	FeeCheck,
+	FeeClose,
+	FeeReverse,
+	AuditRead,
+}
+
+// Has reports whether ps has p.
+func (ps Permissions) Has(p Permission) bool {
+	for _, elem := range ps {
+		if elem == p {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAny reports whether ps has any of others.
+func (ps Permissions) HasAny(others ...Permission) bool {
+	for _, p := range others {
+		if ps.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether p is a known permission.
+func (p Permission) Valid() bool { return All.Has(p) }
@@ -0,0 +1,177 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+)
+
+var (
+	ctx     = context.Background()
+	members = member.NewMemoryStore()
+)
+
+func TestMain(m *testing.M) {
+	member.SetStore(members)
+	rbac.SetStore(rbac.NewMemoryRoleStore(), rbac.NewMemoryGrantStore())
+	audit.SetStore(audit.NewMemoryStore())
+	os.Exit(m.Run())
+}
+
+func TestCreate(t *testing.T) {
+	for _, tc := range []struct {
+		role     *rbac.Role
+		expected error
+	}{
+		{rbac.New("Study Lead", "", nil), rbac.ErrInvalidRoleName},
+		{rbac.New(rbac.FeeManager, "", nil), rbac.ErrRoleExists},
+		{rbac.New("study-lead", "", rbac.Permissions{"activity.everything"}), rbac.ErrUnknownPermission},
+		{rbac.New("study-lead", "스터디장", rbac.Permissions{rbac.ActivityCreate, rbac.ActivityFilesUpload, rbac.ActivityCreate}), nil},
+		{rbac.New("study-lead", "", nil), rbac.ErrRoleExists},
+	} {
+		if err := tc.role.Create(ctx); !errors.Is(err, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.role.Name, tc.expected, err)
+		}
+	}
+
+	role, err := rbac.Get(ctx, "study-lead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Permissions) != 2 {
+		t.Errorf("expected 2 permissions, got %v", role.Permissions)
+	}
+
+	roles, err := rbac.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 5 || !roles[0].BuiltIn || roles[4].BuiltIn {
+		t.Errorf("unexpected roles: %v", roles)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	if err := rbac.Update(ctx, rbac.Master, "", nil); err != rbac.ErrBuiltInRole {
+		t.Errorf("expected %v, got %v", rbac.ErrBuiltInRole, err)
+	}
+	if err := rbac.Update(ctx, "president", "", nil); err != rbac.ErrRoleNotFound {
+		t.Errorf("expected %v, got %v", rbac.ErrRoleNotFound, err)
+	}
+	if err := rbac.Update(ctx, "study-lead", "스터디장", rbac.Permissions{rbac.ActivityCreate, rbac.ActivityUpdate}); err != nil {
+		t.Fatal(err)
+	}
+
+	if role, err := rbac.Get(ctx, "study-lead"); err != nil {
+		t.Error(err)
+	} else if !role.Permissions.Has(rbac.ActivityUpdate) || role.Permissions.Has(rbac.ActivityFilesUpload) {
+		t.Errorf("unexpected permissions: %v", role.Permissions)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	if err := rbac.Assign(ctx, "president", []string{"20210001"}, 0, member.MASTER); err != rbac.ErrRoleNotFound {
+		t.Errorf("expected %v, got %v", rbac.ErrRoleNotFound, err)
+	}
+	if err := rbac.Assign(ctx, "study-lead", []string{"20210001"}, time.Now().Add(-time.Hour).Unix(), member.MASTER); err != rbac.ErrInvalidExpiry {
+		t.Errorf("expected %v, got %v", rbac.ErrInvalidExpiry, err)
+	}
+
+	if err := rbac.Assign(ctx, "study-lead", []string{"20210001", "20210002"}, 0, member.MASTER); err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.Assign(ctx, rbac.FeeManager, []string{"20210001"}, time.Now().Add(time.Hour).Unix(), member.MASTER); err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, err := rbac.PermissionsOf(ctx, "20210001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !permissions.Has(rbac.ActivityUpdate) || !permissions.Has(rbac.FeePay) || permissions.Has(rbac.MemberApprove) {
+		t.Errorf("unexpected permissions: %v", permissions)
+	}
+
+	if err = rbac.Unassign(ctx, rbac.FeeManager, []string{"20210001"}); err != nil {
+		t.Fatal(err)
+	}
+	if permissions, err = rbac.PermissionsOf(ctx, "20210001"); err != nil {
+		t.Fatal(err)
+	} else if permissions.Has(rbac.FeePay) {
+		t.Errorf("unexpected permissions: %v", permissions)
+	}
+
+	// deleting a role revokes its grants
+	if err = rbac.Delete(ctx, "study-lead"); err != nil {
+		t.Fatal(err)
+	}
+	if grants, err := rbac.Find(ctx, rbac.GrantFilter{Roles: []string{"study-lead"}}); err != nil {
+		t.Error(err)
+	} else if len(grants) != 0 {
+		t.Errorf("expected no grants, got %v", grants)
+	}
+	if err = rbac.Delete(ctx, rbac.Master); err != rbac.ErrBuiltInRole {
+		t.Errorf("expected %v, got %v", rbac.ErrBuiltInRole, err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	for _, memb := range []member.Member{
+		{ID: "20150001", Role: member.Role{Master: true, MemberManagement: true, ActivityManagement: true, FeeManagement: true}},
+		{ID: "20150002", Role: member.Role{FeeManagement: true}},
+		{ID: "20150003"},
+	} {
+		if err := members.Insert(ctx, memb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// migrating twice grants nothing more
+	for i := 0; i < 2; i++ {
+		if err := rbac.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roles, err := rbac.RolesOf(ctx, []string{"20150001", "20150002", "20150003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[string]int{"20150001": 4, "20150002": 1, "20150003": 0} {
+		if len(roles[id]) != expected {
+			t.Errorf("%s: expected %d roles, got %v", id, expected, roles[id])
+		}
+	}
+
+	if permissions, err := rbac.PermissionsOf(ctx, "20150002"); err != nil {
+		t.Error(err)
+	} else if !permissions.Has(rbac.FeeExempt) || permissions.Has(rbac.RoleManage) {
+		t.Errorf("unexpected permissions: %v", permissions)
+	}
+
+	if memb, err := members.Get(ctx, "20150001"); err != nil {
+		t.Error(err)
+	} else if memb.Role != (member.Role{}) {
+		t.Errorf("legacy role is not cleared: %v", memb.Role)
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+)
+
+// The built-in roles.
+// They are equivalent to the legacy member.Role booleans, and can be neither modified nor deleted.
+const (
+	Master          = "master"
+	MemberManager   = "member-manager"
+	ActivityManager = "activity-manager"
+	FeeManager      = "fee-manager"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrBuiltInRole       = errors.New("built-in role can not be modified")
+	ErrInvalidRoleName   = errors.New("invalid role name")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidExpiry     = errors.New("expiry must be in the future")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,31}$`)
+
+// Role represents a named set of permissions.
+type Role struct {
+	Name        string      `json:"name" bson:"_id"`
+	Description string      `json:"description" bson:"description"`
+	Permissions Permissions `json:"permissions" bson:"permissions"`
+	BuiltIn     bool        `json:"built_in" bson:"-"`
+	CreatedAt   int64       `json:"created_at,string" bson:"created_at"` // when created - Unix timestamp
+	UpdatedAt   int64       `json:"updated_at,string" bson:"updated_at"` // last updated - Unix timestamp
+}
+
+type Roles []Role
+
+// Grant represents a role assigned to a member.
+type Grant struct {
+	ID        string `json:"-" bson:"_id"` // role name and member ID
+	Role      string `json:"role" bson:"role"`
+	MemberID  string `json:"member_id" bson:"member_id"`
+	GrantedBy string `json:"granted_by" bson:"granted_by"`        // member ID of the granter
+	CreatedAt int64  `json:"created_at,string" bson:"created_at"` // when granted - Unix timestamp
+	ExpiredAt int64  `json:"expired_at,string" bson:"expired_at"` // when expires - Unix timestamp (0 for never)
+}
+
+type Grants []Grant
+
+var builtIns = Roles{
+	{
+		Name:        Master,
+		Description: "모든 권한",
+		Permissions: All,
+		BuiltIn:     true,
+	},
+	{
+		Name:        MemberManager,
+		Description: "회원 관리",
+		Permissions: Permissions{MemberRead, MemberApprove, MemberDelete, MemberUpdate, MemberActivate, MemberSessionsRevoke, ActivityPrivateRead, AuditRead},
+		BuiltIn:     true,
+	},
+	{
+		Name:        ActivityManager,
+		Description: "활동 관리",
+		Permissions: Permissions{ActivityCreate, ActivityUpdate, ActivityDelete, ActivityPrivateRead, ActivityFilesUpload, ActivityFilesDelete, ActivityCheckIn, AuditRead},
+		BuiltIn:     true,
+	},
+	{
+		Name:        FeeManager,
+		Description: "회비 관리",
+		Permissions: Permissions{FeeCreate, FeeRead, FeePay, FeeDeposit, FeeExempt, FeeExpend, FeeCheck, FeeClose, FeeReverse, ActivityPrivateRead, AuditRead},
+		BuiltIn:     true,
+	},
+}
+
+// New returns a new custom role.
+func New(name, description string, permissions Permissions) *Role {
+	now := time.Now().Unix()
+	return &Role{
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// active reports whether g is not expired at now.
+func (g Grant) active(now int64) bool {
+	return g.ExpiredAt == 0 || now < g.ExpiredAt
+}
+
+// first returns the first grant of gs, or nil if gs is empty.
+func (gs Grants) first() *Grant {
+	if len(gs) == 0 {
+		return nil
+	}
+	return &gs[0]
+}
+
+// target returns the audit target of the role of name.
+func target(name string) string { return audit.Target("role", name) }
+
+// builtIn returns the built-in role of name, or nil if not present.
+func builtIn(name string) *Role {
+	for _, role := range builtIns {
+		if role.Name == name {
+			role.Permissions = append(Permissions{}, role.Permissions...)
+			return &role
+		}
+	}
+	return nil
+}
+
+// validate validates the permissions of r, and removes the duplicates.
+func (r *Role) validate() error {
+	permissions := Permissions{}
+	for _, p := range r.Permissions {
+		if !p.Valid() {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+		if !permissions.Has(p) {
+			permissions = append(permissions, p)
+		}
+	}
+	r.Permissions = permissions
+	return nil
+}
+
+// Create creates a new custom role r.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func (r Role) Create(ctx context.Context) error {
+	if !namePattern.MatchString(r.Name) {
+		return fmt.Errorf("%w: %s", ErrInvalidRoleName, r.Name)
+	}
+	if builtIn(r.Name) != nil {
+		return ErrRoleExists
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.BuiltIn = false
+	if err := roleStore.Insert(ctx, r); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.RoleCreate, target(r.Name), nil, r)
+}
+
+// Get returns the role of name.
+func Get(ctx context.Context, name string) (*Role, error) {
+	if role := builtIn(name); role != nil {
+		return role, nil
+	}
+	return roleStore.Get(ctx, name)
+}
+
+// List returns the built-in roles followed by the custom roles.
+func List(ctx context.Context) (Roles, error) {
+	roles, err := roleStore.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(Roles, 0, len(builtIns)+len(roles))
+	for _, role := range builtIns {
+		all = append(all, *builtIn(role.Name))
+	}
+	return append(all, roles...), nil
+}
+
+// Update updates the description and the permissions of the custom role of name.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func Update(ctx context.Context, name, description string, permissions Permissions) error {
+	if builtIn(name) != nil {
+		return ErrBuiltInRole
+	}
+	before, err := roleStore.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	role := Role{Permissions: permissions}
+	if err = role.validate(); err != nil {
+		return err
+	}
+
+	if err = roleStore.Update(ctx, name, map[string]interface{}{
+		"description": description,
+		"permissions": role.Permissions,
+		"updated_at":  time.Now().Unix(),
+	}); err != nil {
+		return err
+	}
+
+	after, err := roleStore.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.RoleUpdate, target(name), before, after)
+}
+
+// Delete deletes the custom role of name and its grants.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func Delete(ctx context.Context, name string) error {
+	if builtIn(name) != nil {
+		return ErrBuiltInRole
+	}
+	before, err := roleStore.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err = grantStore.Delete(ctx, GrantFilter{Roles: []string{name}}); err != nil {
+		return err
+	}
+	if err = roleStore.Delete(ctx, name); err != nil {
+		return err
+	}
+	return audit.Record(ctx, audit.RoleDelete, target(name), before, nil)
+}
+
+// Assign grants the role of name to the members of ids by the member of granter.
+// The grants never expire if expiredAt is zero.
+// Granting a role again replaces its expiry.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func Assign(ctx context.Context, name string, ids []string, expiredAt int64, granter string) error {
+	now := time.Now().Unix()
+	if expiredAt != 0 && expiredAt <= now {
+		return ErrInvalidExpiry
+	}
+	if _, err := Get(ctx, name); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		before, err := grantStore.Find(ctx, GrantFilter{Roles: []string{name}, MemberIDs: []string{id}})
+		if err != nil {
+			return err
+		}
+
+		grant := Grant{
+			ID:        name + "/" + id,
+			Role:      name,
+			MemberID:  id,
+			GrantedBy: granter,
+			CreatedAt: now,
+			ExpiredAt: expiredAt,
+		}
+		if err = grantStore.Upsert(ctx, grant); err != nil {
+			return err
+		}
+		if err = audit.Record(ctx, audit.RoleAssign, audit.Target("member", id), before.first(), grant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unassign revokes the role of name from the members of ids.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func Unassign(ctx context.Context, name string, ids []string) error {
+	if ids == nil {
+		ids = []string{}
+	}
+	filter := GrantFilter{Roles: []string{name}, MemberIDs: ids}
+
+	grants, err := grantStore.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if err = grantStore.Delete(ctx, filter); err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		if err = audit.Record(ctx, audit.RoleUnassign, audit.Target("member", grant.MemberID), grant, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the grants matching filter, including the expired ones.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//
+//	Only the members who have RoleManage can access to this operation.
+func Find(ctx context.Context, filter GrantFilter) (Grants, error) {
+	grants, err := grantStore.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if grants == nil {
+		grants = Grants{}
+	}
+	return grants, nil
+}
+
+// RolesOf returns the names of the active roles of the members of ids.
+func RolesOf(ctx context.Context, ids []string) (map[string][]string, error) {
+	if ids == nil {
+		ids = []string{}
+	}
+	grants, err := grantStore.Find(ctx, GrantFilter{MemberIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	roles := make(map[string][]string, len(ids))
+	for _, id := range ids {
+		roles[id] = []string{}
+	}
+	for _, grant := range grants {
+		if grant.active(now) {
+			roles[grant.MemberID] = append(roles[grant.MemberID], grant.Role)
+		}
+	}
+	return roles, nil
+}
+
+// PermissionsOf returns the permissions of the active roles of the member of id.
+func PermissionsOf(ctx context.Context, id string) (Permissions, error) {
+	roles, err := RolesOf(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := Permissions{}
+	for _, name := range roles[id] {
+		role, err := Get(ctx, name)
+		if err == ErrRoleNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, p := range role.Permissions {
+			if !permissions.Has(p) {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rbac provides the role-based access control of the Buddy System.
+package rbac
+
+import (
+	"context"
+)
+
+// RoleStore is the persistence layer of the custom roles.
+// The built-in roles are not stored.
+type RoleStore interface {
+	// Get returns the role of name.
+	// It returns ErrRoleNotFound if there is no such role.
+	Get(ctx context.Context, name string) (*Role, error)
+	// Find returns every role in insertion order.
+	Find(ctx context.Context) (Roles, error)
+	// Insert inserts role.
+	// It returns ErrRoleExists if there is a role of the same name.
+	Insert(ctx context.Context, role Role) error
+	// Update applies update to the role of name.
+	Update(ctx context.Context, name string, update map[string]interface{}) error
+	// Delete deletes the role of name.
+	Delete(ctx context.Context, name string) error
+}
+
+// GrantStore is the persistence layer of the role grants.
+type GrantStore interface {
+	// Find returns the grants matching filter in insertion order.
+	Find(ctx context.Context, filter GrantFilter) (Grants, error)
+	// Upsert inserts grant, or replaces the grant of the same role and member.
+	Upsert(ctx context.Context, grant Grant) error
+	// Delete deletes the grants matching filter.
+	Delete(ctx context.Context, filter GrantFilter) error
+}
+
+// GrantFilter represents a grant search condition.
+// The zero value matches every grant.
+type GrantFilter struct {
+	Roles     []string // role names to include (nil for all)
+	MemberIDs []string // member IDs to include (nil for all)
+}
+
+// Match reports whether g matches f.
+func (f GrantFilter) Match(g Grant) bool {
+	return (f.Roles == nil || contains(f.Roles, g.Role)) &&
+		(f.MemberIDs == nil || contains(f.MemberIDs, g.MemberID))
+}
+
+var (
+	roleStore  RoleStore
+	grantStore GrantStore
+)
+
+// SetStore sets the persistence layer of the roles and the grants to rs and gs.
+func SetStore(rs RoleStore, gs GrantStore) { roleStore, grantStore = rs, gs }
+
+func contains(strs []string, str string) bool {
+	for _, elem := range strs {
+		if elem == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reminder provides the payment reminders of the club fee of the Buddy System.
+package reminder
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryDeliveryStore is a DeliveryStore which keeps the deliveries in memory.
+// It is safe for concurrent use.
+type MemoryDeliveryStore struct {
+	mu         sync.RWMutex
+	deliveries Deliveries
+}
+
+// NewMemoryDeliveryStore returns a new empty DeliveryStore.
+func NewMemoryDeliveryStore() *MemoryDeliveryStore { return &MemoryDeliveryStore{} }
+
+// Find implements DeliveryStore.
+func (s *MemoryDeliveryStore) Find(_ context.Context, filter Filter) (Deliveries, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := Deliveries{}
+	for _, delivery := range s.deliveries {
+		if filter.Match(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// Insert implements DeliveryStore.
+func (s *MemoryDeliveryStore) Insert(_ context.Context, deliveries ...Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries = append(s.deliveries, deliveries...)
+	return nil
+}
+
+// MemoryPreferenceStore is a PreferenceStore which keeps the preferences in memory.
+// It is safe for concurrent use.
+type MemoryPreferenceStore struct {
+	mu          sync.RWMutex
+	preferences map[string]Preference
+}
+
+// NewMemoryPreferenceStore returns a new empty PreferenceStore.
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{preferences: make(map[string]Preference)}
+}
+
+// Find implements PreferenceStore.
+func (s *MemoryPreferenceStore) Find(context.Context) (Preferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preferences := Preferences{}
+	for _, preference := range s.preferences {
+		preferences = append(preferences, preference)
+	}
+	return preferences, nil
+}
+
+// Upsert implements PreferenceStore.
+func (s *MemoryPreferenceStore) Upsert(_ context.Context, preference Preference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preferences[preference.MemberID] = preference
+	return nil
+}
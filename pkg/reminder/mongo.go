@@ -0,0 +1,161 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reminder provides the payment reminders of the club fee of the Buddy System.
+package reminder
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDB is the common part of the MongoDB stores of the reminders.
+type mongoDB struct {
+	db      *mongo.Database
+	timeout time.Duration
+}
+
+// do runs fn against the club database within the operation timeout.
+func (m mongoDB) do(ctx context.Context, fn func(ctx context.Context, db *mongo.Database) error) error {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	return fn(ctx, m.db)
+}
+
+// MongoDeliveryStore is a DeliveryStore backed by MongoDB.
+type MongoDeliveryStore struct{ mongoDB }
+
+// NewMongoDeliveryStore returns a new DeliveryStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoDeliveryStore(db *mongo.Database, timeout time.Duration) *MongoDeliveryStore {
+	return &MongoDeliveryStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements DeliveryStore.
+func (s *MongoDeliveryStore) Find(ctx context.Context, filter Filter) (deliveries Deliveries, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("reminders").Find(ctx, filter.document())
+		if err != nil {
+			return err
+		}
+
+		deliveries = Deliveries{}
+		delivery := new(Delivery)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(delivery); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, *delivery)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Insert implements DeliveryStore.
+func (s *MongoDeliveryStore) Insert(ctx context.Context, deliveries ...Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		docs := make([]interface{}, len(deliveries))
+		for idx, delivery := range deliveries {
+			docs[idx] = delivery
+		}
+		_, err := db.Collection("reminders").InsertMany(ctx, docs)
+		return err
+	})
+}
+
+// MongoPreferenceStore is a PreferenceStore backed by MongoDB.
+type MongoPreferenceStore struct{ mongoDB }
+
+// NewMongoPreferenceStore returns a new PreferenceStore on db.
+// Each operation is bounded by timeout, unless it is zero.
+func NewMongoPreferenceStore(db *mongo.Database, timeout time.Duration) *MongoPreferenceStore {
+	return &MongoPreferenceStore{mongoDB{db: db, timeout: timeout}}
+}
+
+// Find implements PreferenceStore.
+func (s *MongoPreferenceStore) Find(ctx context.Context) (preferences Preferences, err error) {
+	err = s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		cur, err := db.Collection("reminder_preferences").Find(ctx, bson.D{})
+		if err != nil {
+			return err
+		}
+
+		preferences = Preferences{}
+		preference := new(Preference)
+
+		for cur.Next(ctx) {
+			if err = cur.Decode(preference); err != nil {
+				return err
+			}
+			preferences = append(preferences, *preference)
+		}
+
+		return cur.Close(ctx)
+	})
+	return
+}
+
+// Upsert implements PreferenceStore.
+func (s *MongoPreferenceStore) Upsert(ctx context.Context, preference Preference) error {
+	return s.do(ctx, func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("reminder_preferences").ReplaceOne(ctx, bson.D{bson.E{Key: "_id", Value: preference.MemberID}}, preference, options.Replace().SetUpsert(true))
+		return err
+	})
+}
+
+// document returns the MongoDB query document of f.
+func (f Filter) document() bson.D {
+	filter := bson.D{}
+
+	if f.MemberID != "" {
+		filter = append(filter, bson.E{Key: "member_id", Value: f.MemberID})
+	}
+	if f.Statuses != nil {
+		arr := make(bson.A, len(f.Statuses))
+		for idx, status := range f.Statuses {
+			arr[idx] = status
+		}
+		filter = append(filter, bson.E{Key: "status", Value: bson.D{bson.E{Key: "$in", Value: arr}}})
+	}
+	if f.Year != 0 {
+		filter = append(filter, bson.E{Key: "year", Value: f.Year})
+	}
+	if f.Semester != 0 {
+		filter = append(filter, bson.E{Key: "semester", Value: f.Semester})
+	}
+	if f.Since != 0 || f.Until != 0 {
+		cond := bson.D{}
+		if f.Since != 0 {
+			cond = append(cond, bson.E{Key: "$gte", Value: f.Since})
+		}
+		if f.Until != 0 {
+			cond = append(cond, bson.E{Key: "$lt", Value: f.Until})
+		}
+		filter = append(filter, bson.E{Key: "created_at", Value: cond})
+	}
+	return filter
+}
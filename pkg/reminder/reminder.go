@@ -0,0 +1,296 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reminder provides the payment reminders of the club fee of the Buddy System.
+package reminder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/fee"
+	"github.com/kmu-kcc/buddy-backend/pkg/mail"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The statuses of the deliveries.
+const (
+	Sent    = "sent"
+	Failed  = "failed"  // retried on the next run
+	Skipped = "skipped" // never retried, e.g. for the members without e-mail addresses
+)
+
+var ErrNoSender = errors.New("no mail sender")
+
+// kst is the time zone of the due dates in the reminders.
+var kst = time.FixedZone("KST", 9*60*60)
+
+// Delivery represents a reminder of a debt sent to a member.
+// The debts of a member reminded at once share the same e-mail.
+type Delivery struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	MemberID  string             `json:"member_id" bson:"member_id"`
+	Email     string             `json:"email" bson:"email"`
+	Year      int                `json:"year" bson:"year"`
+	Semester  int                `json:"semester" bson:"semester"`
+	Item      string             `json:"item" bson:"item"` // hexadecimal ID of the fee item (empty for the semester dues)
+	Name      string             `json:"name" bson:"name"` // name of the fee item, or "회비" for the semester dues
+	DueDate   int64              `json:"due_date,string" bson:"due_date"`
+	Day       int                `json:"day" bson:"day"` // day of the schedule relative to the due date
+	Amount    int                `json:"amount" bson:"amount"`
+	Status    string             `json:"status" bson:"status"`
+	Error     string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt int64              `json:"created_at,string" bson:"created_at"`
+}
+
+type Deliveries []Delivery
+
+// Preference represents the reminder preference of a member.
+type Preference struct {
+	MemberID  string `json:"member_id" bson:"_id"`
+	OptOut    bool   `json:"opt_out" bson:"opt_out"`
+	UpdatedAt int64  `json:"updated_at,string" bson:"updated_at"`
+}
+
+type Preferences []Preference
+
+// Schedule represents when the reminders are sent.
+type Schedule struct {
+	Days     []int         // days relative to the due dates to remind at, negative before the due dates
+	Throttle time.Duration // minimum interval between the e-mails to a member
+}
+
+// stage returns the last day of s which is reached at now for the due date,
+// or false if none is reached.
+func (s Schedule) stage(dueDate int64, now time.Time) (day int, ok bool) {
+	due := time.Unix(dueDate, 0)
+	for _, d := range s.Days {
+		if !due.AddDate(0, 0, d).After(now) && (!ok || day < d) {
+			day, ok = d, true
+		}
+	}
+	return
+}
+
+// ParseDays parses the comma-separated days of a schedule like "-3,-1,1,7".
+func ParseDays(str string) ([]int, error) {
+	days := []int{}
+	for _, field := range strings.Split(str, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		day, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid day: %s", field)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+var sender mail.Sender
+
+// SetSender sets the sender of the reminders to s.
+func SetSender(s mail.Sender) { sender = s }
+
+// key identifies the reminder of a debt at a day of the schedule.
+type key struct {
+	memberID       string
+	year, semester int
+	item           string
+	day            int
+}
+
+// Run reminds the members of their debts by e-mail at now, following schedule.
+// A debt is reminded once at the last day of the schedule reached,
+// unless the member opted out, or was reminded within the throttle of schedule.
+// It returns the deliveries made.
+func Run(ctx context.Context, now time.Time, schedule Schedule) (Deliveries, error) {
+	if sender == nil {
+		return nil, ErrNoSender
+	}
+
+	debts, err := fee.FindDebts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences, err := preferenceStore.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	optOut := make(map[string]bool)
+	for _, preference := range preferences {
+		optOut[preference.MemberID] = preference.OptOut
+	}
+
+	delivered, err := deliveryStore.Find(ctx, Filter{Statuses: []string{Sent, Skipped}})
+	if err != nil {
+		return nil, err
+	}
+	done, last := make(map[key]bool), make(map[string]int64)
+	for _, delivery := range delivered {
+		done[key{delivery.MemberID, delivery.Year, delivery.Semester, delivery.Item, delivery.Day}] = true
+		if delivery.Status == Sent && last[delivery.MemberID] < delivery.CreatedAt {
+			last[delivery.MemberID] = delivery.CreatedAt
+		}
+	}
+
+	pending := make(map[string]Deliveries)
+	ids := []string{}
+	for _, debt := range debts {
+		if optOut[debt.MemberID] {
+			continue
+		}
+		day, ok := schedule.stage(debt.DueDate, now)
+		if !ok || done[key{debt.MemberID, debt.Year, debt.Semester, debt.Item, day}] {
+			continue
+		}
+		if last[debt.MemberID] != 0 && now.Before(time.Unix(last[debt.MemberID], 0).Add(schedule.Throttle)) {
+			continue
+		}
+
+		if _, ok := pending[debt.MemberID]; !ok {
+			ids = append(ids, debt.MemberID)
+		}
+		pending[debt.MemberID] = append(pending[debt.MemberID], Delivery{
+			MemberID: debt.MemberID,
+			Year:     debt.Year,
+			Semester: debt.Semester,
+			Item:     debt.Item,
+			Name:     debt.Name,
+			DueDate:  debt.DueDate,
+			Day:      day,
+			Amount:   debt.Amount,
+		})
+	}
+	if len(ids) == 0 {
+		return Deliveries{}, nil
+	}
+
+	members, err := member.Find(ctx, member.Filter{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+
+	deliveries := Deliveries{}
+	for _, memb := range members {
+		status, reason := Sent, ""
+		if memb.Email == "" {
+			status, reason = Skipped, "no e-mail address"
+		} else if err := sender.Send(ctx, message(memb, pending[memb.ID])); err != nil {
+			status, reason = Failed, err.Error()
+		}
+
+		for _, delivery := range pending[memb.ID] {
+			delivery.ID = primitive.NewObjectID()
+			delivery.Email = memb.Email
+			delivery.Status, delivery.Error = status, reason
+			delivery.CreatedAt = now.Unix()
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	if err = deliveryStore.Insert(ctx, deliveries...); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Start runs the reminders every interval following schedule, until ctx is done.
+// The failures are logged, and retried on the next run.
+func Start(ctx context.Context, interval time.Duration, schedule Schedule) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deliveries, err := Run(ctx, now, schedule)
+			if err != nil {
+				log.Println("reminder:", err)
+				continue
+			}
+			for _, delivery := range deliveries {
+				if delivery.Status == Failed {
+					log.Printf("reminder: %s: %s", delivery.MemberID, delivery.Error)
+				}
+			}
+		}
+	}
+}
+
+// message returns the e-mail reminding memb of the debts of deliveries.
+func message(memb member.Member, deliveries Deliveries) mail.Message {
+	body := new(strings.Builder)
+
+	fmt.Fprintf(body, "%s님, 아래 회비가 아직 납부되지 않았습니다.\n\n", memb.Name)
+	for _, delivery := range deliveries {
+		fmt.Fprintf(body, "- %d년 %d학기 %s: %s원 (납부 기한 %s)\n",
+			delivery.Year, delivery.Semester, delivery.Name, fee.Comma(delivery.Amount), time.Unix(delivery.DueDate, 0).In(kst).Format("2006-01-02"))
+	}
+	body.WriteString("\n이미 납부하셨다면 이 메일은 무시해 주세요.\n")
+	body.WriteString("납부 안내 메일을 받지 않으려면 Buddy에서 수신 거부를 설정해 주세요.\n")
+
+	return mail.Message{To: []string{memb.Email}, Subject: "[KCC] 회비 납부 안내", Body: body.String()}
+}
+
+// OptOut sets whether the member of id opts out of the reminders.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to their own preferences.
+func OptOut(ctx context.Context, id string, optOut bool) error {
+	return preferenceStore.Upsert(ctx, Preference{MemberID: id, OptOut: optOut, UpdatedAt: time.Now().Unix()})
+}
+
+// PreferenceOf returns the reminder preference of the member of id.
+//
+// NOTE:
+//
+// It is a member-limited operation:
+//	Only the authenticated members can access to their own preferences.
+func PreferenceOf(ctx context.Context, id string) (*Preference, error) {
+	preferences, err := preferenceStore.Find(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, preference := range preferences {
+		if preference.MemberID == id {
+			return &preference, nil
+		}
+	}
+	return &Preference{MemberID: id}, nil
+}
+
+// Search returns the deliveries matching filter in chronological order.
+//
+// NOTE:
+//
+// It is a privileged operation:
+//	Only the club managers can access to this operation.
+func Search(ctx context.Context, filter Filter) (Deliveries, error) {
+	return deliveryStore.Find(ctx, filter)
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reminder_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/fee"
+	"github.com/kmu-kcc/buddy-backend/pkg/mail"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/reminder"
+)
+
+// fakeSender records the messages, failing for the recipients in fail.
+type fakeSender struct {
+	messages []mail.Message
+	fail     map[string]bool
+}
+
+func (s *fakeSender) Send(_ context.Context, msg mail.Message) error {
+	if s.fail[msg.To[0]] {
+		return errors.New("connection refused")
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+var (
+	ctx    = context.Background()
+	sender = &fakeSender{fail: map[string]bool{}}
+	due    = time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+)
+
+func TestMain(m *testing.M) {
+	members := member.NewMemoryStore()
+	member.SetStore(members)
+	fees, logs, journal, remittances, receipts := fee.NewMemoryFeeStore(), fee.NewMemoryLogStore(), fee.NewMemoryJournalStore(), fee.NewMemoryRemittanceStore(), fee.NewMemoryReceiptStore()
+	fee.SetStore(fees, logs, journal, remittances, receipts, fee.NewMemoryTransactor(fees, logs, journal, remittances, receipts))
+	audit.SetStore(audit.NewMemoryStore())
+	reminder.SetStore(reminder.NewMemoryDeliveryStore(), reminder.NewMemoryPreferenceStore())
+	reminder.SetSender(sender)
+
+	for _, m := range []member.Member{
+		{ID: "20210001", Name: "Test1", Email: "test1@kookmin.ac.kr", Approved: true},
+		{ID: "20210002", Name: "Test2", Email: "test2@kookmin.ac.kr", Approved: true},
+		{ID: "20210003", Name: "Test3", Approved: true},
+		{ID: "20210004", Name: "Test4", Email: "test4@kookmin.ac.kr", Approved: true},
+	} {
+		if err := members.Insert(ctx, m); err != nil {
+			panic(err)
+		}
+	}
+
+	f := fee.New(2021, 1, 0, 15000)
+	f.DueDate = due.Unix()
+	if err := f.Create(ctx); err != nil {
+		panic(err)
+	}
+	if _, err := fee.AddItem(ctx, 2021, 1, fee.Item{Name: "MT", Category: "mt", Amount: 50000, DueDate: due.Unix(), Targets: []string{"20210002"}}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	schedule := reminder.Schedule{Days: []int{-3, 1, 7}, Throttle: 5 * 24 * time.Hour}
+
+	if err := reminder.OptOut(ctx, "20210004", true); err != nil {
+		t.Fatal(err)
+	}
+	if preference, err := reminder.PreferenceOf(ctx, "20210004"); err != nil || !preference.OptOut {
+		t.Fatalf("expected to opt out, got %v, %v", preference, err)
+	}
+
+	run := func(at time.Time) reminder.Deliveries {
+		t.Helper()
+		deliveries, err := reminder.Run(ctx, at, schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deliveries
+	}
+	statuses := func(deliveries reminder.Deliveries) string {
+		strs := make([]string, len(deliveries))
+		for idx, delivery := range deliveries {
+			strs[idx] = delivery.MemberID + ":" + delivery.Name + ":" + delivery.Status
+		}
+		return strings.Join(strs, ",")
+	}
+
+	if deliveries := run(due.AddDate(0, 0, -4)); len(deliveries) != 0 {
+		t.Errorf("expected no reminder before the schedule, got %v", deliveries)
+	}
+
+	sender.fail["test2@kookmin.ac.kr"] = true
+	deliveries := run(due.AddDate(0, 0, -3))
+	if got := statuses(deliveries); got != "20210001:회비:sent,20210002:회비:failed,20210002:MT:failed,20210003:회비:skipped" {
+		t.Errorf("unexpected deliveries: %s", got)
+	}
+
+	// the failures are retried, but the others are not reminded twice on a day of the schedule
+	sender.fail["test2@kookmin.ac.kr"] = false
+	deliveries = run(due.AddDate(0, 0, -3).Add(time.Hour))
+	if got := statuses(deliveries); got != "20210002:회비:sent,20210002:MT:sent" {
+		t.Errorf("unexpected deliveries: %s", got)
+	}
+	if len(sender.messages) != 2 || !strings.Contains(sender.messages[1].Body, "MT: 50,000원") {
+		t.Errorf("expected the debts of a member in an e-mail, got %v", sender.messages)
+	}
+
+	if err := fee.Pay(ctx, 2021, 1, nil, []string{"20210001"}, []int{15000}); err != nil {
+		t.Fatal(err)
+	}
+
+	// throttled within 5 days since the last reminder
+	deliveries = run(due.AddDate(0, 0, 1))
+	if got := statuses(deliveries); got != "20210003:회비:skipped" {
+		t.Errorf("unexpected deliveries: %s", got)
+	}
+	deliveries = run(due.AddDate(0, 0, 7))
+	if got := statuses(deliveries); got != "20210002:회비:sent,20210002:MT:sent,20210003:회비:skipped" {
+		t.Errorf("unexpected deliveries: %s", got)
+	}
+
+	if deliveries, err := reminder.Search(ctx, reminder.Filter{MemberID: "20210002", Statuses: []string{reminder.Sent}}); err != nil {
+		t.Fatal(err)
+	} else if len(deliveries) != 4 {
+		t.Errorf("expected 4 deliveries, got %v", deliveries)
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	if days, err := reminder.ParseDays("-3, -1,1,7"); err != nil || len(days) != 4 || days[0] != -3 || days[3] != 7 {
+		t.Errorf("unexpected days: %v, %v", days, err)
+	}
+	if _, err := reminder.ParseDays("-3,x"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reminder provides the payment reminders of the club fee of the Buddy System.
+package reminder
+
+import (
+	"context"
+)
+
+// DeliveryStore is the persistence layer of the delivery log of the reminders.
+// It is append-only, so the deliveries are never updated nor deleted.
+type DeliveryStore interface {
+	// Find returns the deliveries matching filter in insertion order.
+	Find(ctx context.Context, filter Filter) (Deliveries, error)
+	// Insert inserts deliveries.
+	Insert(ctx context.Context, deliveries ...Delivery) error
+}
+
+// PreferenceStore is the persistence layer of the reminder preferences of the members.
+type PreferenceStore interface {
+	// Find returns every preference.
+	Find(ctx context.Context) (Preferences, error)
+	// Upsert inserts preference, or replaces the preference of its member.
+	Upsert(ctx context.Context, preference Preference) error
+}
+
+// Filter represents a delivery search condition.
+// The zero value matches every delivery.
+type Filter struct {
+	MemberID string   // student ID of the member (empty for all)
+	Statuses []string // statuses to include (nil for all)
+	Year     int      // year of the fee (zero for all)
+	Semester int      // semester of the fee (zero for all)
+	Since    int64    // inclusive lower bound of the creation time (zero for unbounded)
+	Until    int64    // exclusive upper bound of the creation time (zero for unbounded)
+}
+
+// Match reports whether d matches f.
+func (f Filter) Match(d Delivery) bool {
+	return (f.MemberID == "" || f.MemberID == d.MemberID) &&
+		(f.Statuses == nil || contains(f.Statuses, d.Status)) &&
+		(f.Year == 0 || f.Year == d.Year) &&
+		(f.Semester == 0 || f.Semester == d.Semester) &&
+		(f.Since == 0 || f.Since <= d.CreatedAt) &&
+		(f.Until == 0 || d.CreatedAt < f.Until)
+}
+
+var (
+	deliveryStore   DeliveryStore
+	preferenceStore PreferenceStore
+)
+
+// SetStore sets the persistence layers of the reminders to ds and ps.
+func SetStore(ds DeliveryStore, ps PreferenceStore) { deliveryStore, preferenceStore = ds, ps }
+
+func contains(strs []string, str string) bool {
+	for _, elem := range strs {
+		if elem == str {
+			return true
+		}
+	}
+	return false
+}
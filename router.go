@@ -0,0 +1,158 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/config"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/activity"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/audit"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/fee"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/member"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/reminder"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/role"
+)
+
+// newRouter returns the API router of the Buddy System.
+// Every route declares its authentication and authorization requirements here,
+// and the handlers trust them.
+func newRouter() *gin.Engine {
+	engine := gin.Default()
+
+	engine.Use(cors.New(config.CORSConfig), auth.Origin(config.TrustedProxies...))
+
+	authenticate := auth.Authenticate()
+
+	api := engine.Group("/api")
+	{
+		v1 := api.Group("/v1")
+		{
+			members := v1.Group("/member")
+			{
+				members.POST("/signin", member.SignIn())
+				members.POST("/refresh", member.Refresh())
+				members.PUT("/password", member.ChangePassword())
+				members.POST("/logout", authenticate, member.Logout())
+				members.GET("/sessions", authenticate, member.Sessions())
+				members.DELETE("/sessions", authenticate, member.RevokeSessions())
+				members.PUT("/forcelogout", authenticate, auth.RequirePermission(rbac.MemberSessionsRevoke), member.ForceLogout())
+				members.POST("/signup", member.SignUp())
+				members.GET("/signups", authenticate, auth.RequirePermission(rbac.MemberRead, rbac.MemberApprove), member.SignUps())
+				members.PUT("/approve", authenticate, auth.RequirePermission(rbac.MemberApprove), member.Approve())
+				members.DELETE("/delete", authenticate, auth.RequirePermission(rbac.MemberDelete), member.Delete())
+				members.PUT("/exit", authenticate, member.Exit())
+				members.GET("/exits", authenticate, auth.RequirePermission(rbac.MemberRead, rbac.MemberDelete), member.Exits())
+				members.POST("/my", authenticate, member.My())
+				members.GET("/search", authenticate, member.Search())
+				members.PUT("/update", authenticate, member.Update())
+				members.GET("/active", member.Active())
+				members.PUT("/activate", authenticate, auth.RequirePermission(rbac.MemberActivate), member.Activate())
+				members.GET("/graduates", authenticate, auth.RequirePermission(rbac.MemberRead), member.Graduates())
+			}
+			activities := v1.Group("/activity")
+			{
+				activities.POST("/create", authenticate, auth.RequirePermission(rbac.ActivityCreate), activity.Create())
+				activities.GET("/search", auth.OptionalAuthenticate(), activity.Search())
+				activities.GET("/private", authenticate, auth.RequirePermission(rbac.ActivityPrivateRead), activity.Private())
+				activities.PUT("/update", authenticate, auth.RequirePermission(rbac.ActivityUpdate), activity.Update())
+				activities.DELETE("/delete", authenticate, auth.RequirePermission(rbac.ActivityDelete), activity.Delete())
+				activities.POST("/upload", authenticate, auth.RequirePermission(rbac.ActivityFilesUpload), activity.Upload())
+				activities.POST("/download", authenticate, activity.Download())
+				activities.POST("/deletefile", authenticate, auth.RequirePermission(rbac.ActivityFilesDelete), activity.DeleteFile())
+				activities.POST("/rsvp", authenticate, activity.RSVP())
+				activities.POST("/cancel", authenticate, activity.Cancel())
+				activities.GET("/attendees", authenticate, auth.RequirePermission(rbac.ActivityUpdate), activity.Attendees())
+				activities.POST("/opencheckin", authenticate, auth.RequirePermission(rbac.ActivityCheckIn), activity.OpenCheckIn())
+				activities.POST("/closecheckin", authenticate, auth.RequirePermission(rbac.ActivityCheckIn), activity.CloseCheckIn())
+				activities.GET("/checkincode", authenticate, auth.RequirePermission(rbac.ActivityCheckIn), activity.CheckInCode())
+				activities.POST("/checkin", authenticate, activity.CheckIn())
+				activities.GET("/attendance", authenticate, auth.RequirePermission(rbac.ActivityCheckIn), activity.Attendance())
+				activities.GET("/memberattendance", authenticate, activity.MemberAttendance())
+				activities.POST("/createseries", authenticate, auth.RequirePermission(rbac.ActivityCreate), activity.CreateSeries())
+				activities.GET("/series", authenticate, auth.RequirePermission(rbac.ActivityUpdate), activity.Series())
+				activities.GET("/occurrences", auth.OptionalAuthenticate(), activity.Occurrences())
+				activities.PUT("/updateseries", authenticate, auth.RequirePermission(rbac.ActivityUpdate), activity.UpdateSeries())
+				activities.DELETE("/deleteseries", authenticate, auth.RequirePermission(rbac.ActivityDelete), activity.DeleteSeries())
+				activities.GET("/calendar.ics", activity.Calendar())
+				activities.POST("/feed", authenticate, activity.IssueFeed())
+				activities.DELETE("/feed", authenticate, activity.RevokeFeed())
+			}
+			roles := v1.Group("/role", authenticate, auth.RequirePermission(rbac.RoleManage))
+			{
+				roles.GET("/list", role.List())
+				roles.GET("/permissions", role.Permissions())
+				roles.POST("/create", role.Create())
+				roles.PUT("/update", role.Update())
+				roles.DELETE("/delete", role.Delete())
+				roles.PUT("/assign", role.Assign())
+				roles.PUT("/unassign", role.Unassign())
+				roles.GET("/grants", role.Grants())
+			}
+			fees := v1.Group("/fee")
+			{
+				fees.POST("/create", authenticate, auth.RequirePermission(rbac.FeeCreate), fee.Create())
+				fees.POST("/setpolicy", authenticate, auth.RequirePermission(rbac.FeeCreate), fee.SetPolicy())
+				fees.POST("/policy", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Policy())
+				fees.POST("/additem", authenticate, auth.RequirePermission(rbac.FeeCreate), fee.AddItem())
+				fees.POST("/items", authenticate, fee.Items())
+				fees.POST("/itempayers", authenticate, auth.RequirePermission(rbac.FeeRead), fee.ItemPayers())
+				fees.POST("/itemdeptors", authenticate, auth.RequirePermission(rbac.FeeRead), fee.ItemDeptors())
+				fees.POST("/amount", authenticate, fee.Amount())
+				fees.POST("/payers", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Payers())
+				fees.POST("/deptors", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Deptors())
+				fees.POST("/search", authenticate, fee.Search())
+				fees.POST("/statement", authenticate, fee.Statement())
+				fees.POST("/memberstatement", authenticate, auth.RequirePermission(rbac.FeeRead), fee.MemberStatement())
+				fees.POST("/pay", authenticate, auth.RequirePermission(rbac.FeePay), fee.Pay())
+				fees.POST("/deposit", authenticate, auth.RequirePermission(rbac.FeeDeposit), fee.Deposit())
+				fees.POST("/exempt", authenticate, auth.RequirePermission(rbac.FeeExempt), fee.Exempt())
+				fees.POST("/revoke", authenticate, auth.RequirePermission(rbac.FeeExempt), fee.Revoke())
+				fees.POST("/reverse", authenticate, auth.RequirePermission(rbac.FeeReverse), fee.Reverse())
+				fees.POST("/import", authenticate, auth.RequirePermission(rbac.FeePay), fee.Import())
+				fees.POST("/remittances", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Remittances())
+				fees.POST("/resolve", authenticate, auth.RequirePermission(rbac.FeePay), fee.Resolve())
+				fees.POST("/dismiss", authenticate, auth.RequirePermission(rbac.FeePay), fee.Dismiss())
+				fees.POST("/expend", authenticate, auth.RequirePermission(rbac.FeeExpend), fee.Expend())
+				fees.POST("/attach", authenticate, auth.RequirePermission(rbac.FeeDeposit, rbac.FeeExpend), fee.Attach())
+				fees.POST("/attachment", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Attachment())
+				fees.POST("/receipt", authenticate, fee.Receipt())
+				fees.POST("/memberreceipt", authenticate, auth.RequirePermission(rbac.FeeRead), fee.MemberReceipt())
+				fees.POST("/receipts", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Receipts())
+				fees.POST("/expenses", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Expenses())
+				fees.POST("/check", authenticate, auth.RequirePermission(rbac.FeeCheck), fee.Check())
+				fees.POST("/trialbalance", authenticate, auth.RequirePermission(rbac.FeeRead), fee.TrialBalance())
+				fees.POST("/accountstatement", authenticate, auth.RequirePermission(rbac.FeeRead), fee.AccountStatement())
+				fees.POST("/close", authenticate, auth.RequirePermission(rbac.FeeClose), fee.Close())
+				fees.POST("/reopen", authenticate, auth.RequirePermission(rbac.FeeClose), fee.Reopen())
+				fees.POST("/recompute", authenticate, auth.RequirePermission(rbac.FeeClose), fee.Recompute())
+				fees.POST("/chain", authenticate, auth.RequirePermission(rbac.FeeRead), fee.Chain())
+			}
+			reminders := v1.Group("/reminder", authenticate)
+			{
+				reminders.GET("/preference", reminder.Preference())
+				reminders.PUT("/optout", reminder.OptOut())
+				reminders.GET("/deliveries", auth.RequirePermission(rbac.FeeRead), reminder.Deliveries())
+			}
+			audits := v1.Group("/audit", authenticate, auth.RequirePermission(rbac.AuditRead))
+			{
+				audits.GET("/search", audit.Search())
+			}
+		}
+	}
+	return engine
+}
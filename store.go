@@ -0,0 +1,105 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kmu-kcc/buddy-backend/config"
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/fee"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/pkg/reminder"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// setupStore injects the storage backend of name into the domain packages.
+// The returned function releases the resources of the backend.
+func setupStore(name string) (func(), error) {
+	switch name {
+	case "mongo":
+		ctx, cancel := context.WithTimeout(context.Background(), config.MongoConnectTimeout)
+		defer cancel()
+
+		// a single client is shared by every store,
+		// as it maintains its own connection pool.
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
+		if err != nil {
+			return nil, err
+		}
+		if err = client.Ping(ctx, nil); err != nil {
+			client.Disconnect(context.Background())
+			return nil, err
+		}
+
+		db, timeout := client.Database("club"), config.MongoOperationTimeout
+		member.SetStore(member.NewMongoStore(db, timeout))
+		activity.SetStore(activity.NewMongoStore(db, timeout), activity.NewMongoSeriesStore(db, timeout), activity.NewMongoCheckInStore(db, timeout), activity.NewMongoFeedStore(db, timeout), activity.NewMongoTransactor(db, timeout))
+		fee.SetStore(fee.NewMongoFeeStore(db, timeout), fee.NewMongoLogStore(db, timeout), fee.NewMongoJournalStore(db, timeout), fee.NewMongoRemittanceStore(db, timeout), fee.NewMongoReceiptStore(db, timeout), fee.NewMongoTransactor(db, timeout))
+		oauth2.SetStore(oauth2.NewMongoStore(db, timeout))
+		rbac.SetStore(rbac.NewMongoRoleStore(db, timeout), rbac.NewMongoGrantStore(db, timeout))
+		audit.SetStore(audit.NewMongoStore(db, timeout))
+		reminder.SetStore(reminder.NewMongoDeliveryStore(db, timeout), reminder.NewMongoPreferenceStore(db, timeout))
+
+		if err = rbac.Migrate(ctx); err != nil {
+			client.Disconnect(context.Background())
+			return nil, err
+		}
+		if err = fee.Migrate(ctx); err != nil {
+			client.Disconnect(context.Background())
+			return nil, err
+		}
+		return func() { client.Disconnect(context.Background()) }, nil
+	case "memory":
+		members := member.NewMemoryStore()
+		member.SetStore(members)
+		activities, series := activity.NewMemoryStore(), activity.NewMemorySeriesStore()
+		activity.SetStore(activities, series, activity.NewMemoryCheckInStore(), activity.NewMemoryFeedStore(), activity.NewMemoryTransactor(activities, series))
+		fees, logs, journal, remittances, receipts := fee.NewMemoryFeeStore(), fee.NewMemoryLogStore(), fee.NewMemoryJournalStore(), fee.NewMemoryRemittanceStore(), fee.NewMemoryReceiptStore()
+		fee.SetStore(fees, logs, journal, remittances, receipts, fee.NewMemoryTransactor(fees, logs, journal, remittances, receipts))
+		oauth2.SetStore(oauth2.NewMemoryStore())
+		rbac.SetStore(rbac.NewMemoryRoleStore(), rbac.NewMemoryGrantStore())
+		audit.SetStore(audit.NewMemoryStore())
+		reminder.SetStore(reminder.NewMemoryDeliveryStore(), reminder.NewMemoryPreferenceStore())
+
+		// the in-memory backend starts empty, so seed the master account
+		// which is provisioned by hand on the MongoDB backend.
+		// Its plaintext password is hashed on the first signin like the legacy records.
+		if config.MasterPassword == "" {
+			return nil, errors.New("MASTER_PASSWORD is required for the memory store")
+		}
+		now := time.Now().Unix()
+		if err := members.Insert(context.Background(), member.Member{
+			ID:        member.MASTER,
+			Password:  config.MasterPassword,
+			Name:      member.MASTER,
+			Approved:  true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}); err != nil {
+			return nil, err
+		}
+		return func() {}, rbac.Assign(context.Background(), rbac.Master, []string{member.MASTER}, 0, member.MASTER)
+	default:
+		return nil, fmt.Errorf("unknown store: %s", name)
+	}
+}
@@ -16,21 +16,26 @@
 package activity
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kmu-kcc/buddy-backend/pkg/activity"
 	"github.com/kmu-kcc/buddy-backend/pkg/member"
-	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Create handles the activity creation request.
 func Create() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(activity.Activity)
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -42,33 +47,21 @@ func Create() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.ActivityManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
+		act := activity.New(body.Title, body.Start, body.End, body.Place, body.Description, body.Type, body.Participants, body.Private)
+		act.Visibility = body.Visibility
+		act.Capacity, act.RSVPDeadline = body.Capacity, body.RSVPDeadline
 
-		if err := activity.New(body.Title, body.Start, body.End, body.Place, body.Description, body.Type, body.Participants, body.Private).
-			Create(); err != nil {
+		if err := act.Create(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(status(err), resp)
 			return
 		}
 		c.JSON(http.StatusOK, resp)
 	}
 }
 
-// Search handles the public activity search request.
+// Search handles the activity search request.
+// The anonymous callers get the public activities only.
 func Search() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		query := c.Query("query")
@@ -80,7 +73,7 @@ func Search() gin.HandlerFunc {
 		})
 		var err error
 
-		resp.Data.Activities, err = activity.Search(query, false)
+		resp.Data.Activities, err = activity.Search(c.Request.Context(), query, viewer(c))
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -93,7 +86,6 @@ func Search() gin.HandlerFunc {
 // Private handles the private activity search request.
 func Private() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		query := c.Query("query")
 		resp := new(struct {
 			Data struct {
@@ -103,23 +95,7 @@ func Private() gin.HandlerFunc {
 		})
 		var err error
 
-		if err = token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !(role.MemberManagement || role.ActivityManagement || role.FeeManagement) {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		resp.Data.Activities, err = activity.Search(query, true)
+		resp.Data.Activities, err = activity.Search(c.Request.Context(), query, viewer(c))
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -132,7 +108,6 @@ func Private() gin.HandlerFunc {
 // Update handles the activity update request.
 func Update() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			ID     string            `json:"id"`
 			Update activity.Activity `json:"update"`
@@ -148,44 +123,90 @@ func Update() gin.HandlerFunc {
 			return
 		}
 
-		if err = token.Valid(); err != nil {
+		body.Update.ID, err = primitive.ObjectIDFromHex(body.ID)
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		if err = body.Update.Update(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(status(err), resp)
 			return
-		} else if !role.ActivityManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Delete handles the activity deletion request.
+func Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID string `json:"id"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		body.Update.ID, err = primitive.ObjectIDFromHex(body.ID)
+		if objectID, err := primitive.ObjectIDFromHex(body.ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+		} else if err = activity.Delete(c.Request.Context(), objectID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+		} else {
+			c.JSON(http.StatusOK, resp)
+		}
+	}
+}
+
+// Upload handles the file upload request.
+func Upload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("id")
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		file, err := c.FormFile("file")
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		if err = body.Update.Update(); err != nil {
+		filename := filepath.Base(file.Filename)
+
+		if err = c.SaveUploadedFile(file, activity.NewFile(filename).Absolute()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
-		c.JSON(http.StatusOK, resp)
+
+		if objectID, err := primitive.ObjectIDFromHex(id); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+		} else if err = (activity.Activity{ID: objectID}).Upload(c.Request.Context(), filename); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+		} else {
+			c.JSON(http.StatusOK, resp)
+		}
 	}
 }
 
-// Delete handles the activity deletion request.
-func Delete() gin.HandlerFunc {
+// Download handles the file download request.
+func Download() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
-			ID string `json:"id"`
+			FileName string `json:"filename"`
 		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -197,26 +218,37 @@ func Delete() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		file, err := activity.Download(c.Request.Context(), body.FileName, viewer(c))
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(status(err), resp)
 			return
 		}
+		c.File(file.Absolute())
+	}
+}
+
+// DeleteFile handles the file deletion request.
+func DeleteFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID       string `json:"id"`
+			FileName string `json:"filename"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
 
-		if role, err := token.Role(); err != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.ActivityManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
 		if objectID, err := primitive.ObjectIDFromHex(body.ID); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
-		} else if err = activity.Delete(objectID); err != nil {
+		} else if err = (activity.Activity{ID: objectID}).DeleteFile(c.Request.Context(), body.FileName); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 		} else {
@@ -225,63 +257,390 @@ func Delete() gin.HandlerFunc {
 	}
 }
 
-// Upload handles the file upload request.
-func Upload() gin.HandlerFunc {
+// RSVP handles the RSVP request of the authenticated member.
+func RSVP() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
-		id := c.Query("id")
+		body := new(struct {
+			ID primitive.ObjectID `json:"id"`
+		})
 		resp := new(struct {
+			Data struct {
+				Status string `json:"status"`
+			} `json:"data"`
 			Error string `json:"error,omitempty"`
 		})
 
-		if err := token.Valid(); err != nil {
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		if resp.Data.Status, err = activity.RSVP(c.Request.Context(), body.ID, viewer(c)); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Cancel handles the RSVP cancellation request of the authenticated member.
+func Cancel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID primitive.ObjectID `json:"id"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := activity.Cancel(c.Request.Context(), body.ID, auth.Member(c).ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Attendees handles the attendee list request.
+// The list is exported in CSV if the format query is "csv".
+func Attendees() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Attendees activity.Attendees `json:"attendees"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Attendees = activity.Attendees{}
+
+		id, err := primitive.ObjectIDFromHex(c.Query("id"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			resp.Error = fmt.Sprintf("unknown format: %s", format)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		attendees, err := activity.AttendeesOf(c.Request.Context(), id)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+
+		if format == "csv" {
+			buf := new(bytes.Buffer)
+			if err = attendees.WriteCSV(buf); err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="attendees-%s.csv"`, id.Hex()))
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+			return
+		}
+
+		resp.Data.Attendees = attendees
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// OpenCheckIn handles the check-in window opening request.
+func OpenCheckIn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID       primitive.ObjectID `json:"id"`
+			Duration int64              `json:"duration"` // in seconds
+		})
+		resp := new(struct {
+			Data struct {
+				Window *activity.Window `json:"window"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Window, err = activity.OpenCheckIn(c.Request.Context(), body.ID, time.Duration(body.Duration)*time.Second); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// CloseCheckIn handles the check-in window closing request.
+func CloseCheckIn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID primitive.ObjectID `json:"id"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := activity.CloseCheckIn(c.Request.Context(), body.ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// CheckInCode handles the current check-in code request.
+func CheckInCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Code *activity.Code `json:"code"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		id, err := primitive.ObjectIDFromHex(c.Query("id"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Code, err = activity.CurrentCode(c.Request.Context(), id); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// CheckIn handles the check-in request of the authenticated member.
+func CheckIn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID   primitive.ObjectID `json:"id"`
+			Code string             `json:"code"`
+		})
+		resp := new(struct {
+			Data struct {
+				Attendance *activity.Attendance `json:"attendance"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Attendance, err = activity.CheckIn(c.Request.Context(), body.ID, body.Code, viewer(c)); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Attendance handles the attendance list request of an activity.
+func Attendance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Attendances activity.Attendances `json:"attendances"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Attendances = activity.Attendances{}
+
+		id, err := primitive.ObjectIDFromHex(c.Query("id"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
 			return
-		} else if !role.ActivityManagement {
+		}
+
+		attendances, err := activity.AttendanceOf(c.Request.Context(), id)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+
+		resp.Data.Attendances = attendances
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// MemberAttendance handles the attendance list request of a member.
+func MemberAttendance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Attendances activity.Attendances `json:"attendances"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Attendances = activity.Attendances{}
+
+		id := c.Query("member_id")
+		if !auth.Self(c, id, rbac.ActivityCheckIn) {
 			resp.Error = member.ErrPermissionDenied.Error()
 			c.JSON(http.StatusForbidden, resp)
 			return
 		}
 
-		file, err := c.FormFile("file")
+		attendances, err := activity.MemberAttendance(c.Request.Context(), id)
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		filename := filepath.Base(file.Filename)
+		resp.Data.Attendances = attendances
+		c.JSON(http.StatusOK, resp)
+	}
+}
 
-		if err = c.SaveUploadedFile(file, activity.NewFile(filename).Absolute()); err != nil {
+// CreateSeries handles the recurring activity series creation request.
+func CreateSeries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Template activity.Activity `json:"template"`
+			RRule    string            `json:"rrule"`
+		})
+		resp := new(struct {
+			Data struct {
+				Series *activity.Series `json:"series"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if objectID, err := primitive.ObjectIDFromHex(id); err != nil {
+		series := activity.NewSeries(body.Template, body.RRule)
+		if err := series.Create(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-		} else if err = (activity.Activity{ID: objectID}).Upload(filename); err != nil {
+			c.JSON(status(err), resp)
+			return
+		}
+
+		resp.Data.Series = series
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Series handles the recurring activity series request.
+func Series() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Series *activity.Series `json:"series"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		id, err := primitive.ObjectIDFromHex(c.Query("id"))
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-		} else {
-			c.JSON(http.StatusOK, resp)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Series, err = activity.GetSeries(c.Request.Context(), id); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
 		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
-// Download handles the file download request.
-func Download() gin.HandlerFunc {
+// Occurrences handles the activity request in a range, with the occurrences of the series expanded.
+// The range is the next 31 days by default. The anonymous callers get the public activities only.
+func Occurrences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Activities activity.Activities `json:"activities"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Activities = activity.Activities{}
+
+		from, err := integer(c, "from")
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		to, err := integer(c, "to")
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if from == 0 {
+			from = time.Now().Unix()
+		}
+		if to == 0 {
+			to = time.Unix(from, 0).AddDate(0, 0, 31).Unix()
+		}
+
+		activities, err := activity.Occurrences(c.Request.Context(), from, to, viewer(c))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+
+		resp.Data.Activities = activities
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// UpdateSeries handles the occurrence update request, with the other occurrences of its series in the scope.
+func UpdateSeries() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		body := new(struct {
-			FileName string `json:"filename"`
+			ID     primitive.ObjectID `json:"id"`
+			Scope  string             `json:"scope"`
+			RRule  string             `json:"rrule"`
+			Update activity.Activity  `json:"update"`
 		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -292,17 +651,21 @@ func Download() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
-		c.File(activity.NewFile(body.FileName).Absolute())
+
+		if err := activity.UpdateSeries(c.Request.Context(), body.ID, body.Scope, body.Update, body.RRule); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
-// DeleteFile handles the file deletion request.
-func DeleteFile() gin.HandlerFunc {
+// DeleteSeries handles the recurring activity series deletion request.
+func DeleteSeries() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
-			ID       string `json:"id"`
-			FileName string `json:"filename"`
+			ID primitive.ObjectID `json:"id"`
 		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -314,30 +677,153 @@ func DeleteFile() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := activity.DeleteSeries(c.Request.Context(), body.ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Calendar handles the iCalendar feed request of the activities.
+// The callers with a feed token get the activities its member can read, and the others get the public activities only.
+func Calendar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+		ctx := c.Request.Context()
+		v := activity.Viewer{}
+
+		if token := c.Query("token"); token != "" {
+			id, err := activity.FeedMember(ctx, token)
+			if err == activity.ErrFeedNotFound {
+				resp.Error = err.Error()
+				c.JSON(http.StatusUnauthorized, resp)
+				return
+			}
+			if err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+
+			memb, err := member.Get(ctx, id)
+			if err == member.ErrNotFound {
+				resp.Error = activity.ErrFeedNotFound.Error()
+				c.JSON(http.StatusUnauthorized, resp)
+				return
+			}
+			if err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+
+			permissions, err := rbac.PermissionsOf(ctx, memb.ID)
+			if err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+			v = activity.Viewer{MemberID: memb.ID, Manager: permissions.Has(rbac.ActivityPrivateRead)}
+		}
+
+		activities, err := activity.Calendar(ctx, v)
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(status(err), resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		buf := new(bytes.Buffer)
+		if err = activities.WriteICS(buf); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
-		} else if !role.ActivityManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
 		}
+		c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+	}
+}
 
-		if objectID, err := primitive.ObjectIDFromHex(body.ID); err != nil {
+// IssueFeed handles the calendar feed issuance request of the caller.
+// The feed issued before is revoked.
+func IssueFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Token string `json:"token"`
+				URL   string `json:"url"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		token, err := activity.IssueFeed(c.Request.Context(), auth.Member(c).ID)
+		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
-		} else if err = (activity.Activity{ID: objectID}).DeleteFile(body.FileName); err != nil {
+			return
+		}
+
+		resp.Data.Token = token
+		resp.Data.URL = "/api/v1/activity/calendar.ics?token=" + token
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// RevokeFeed handles the calendar feed revocation request of the caller.
+func RevokeFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := activity.RevokeFeed(c.Request.Context(), auth.Member(c).ID); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
-		} else {
-			c.JSON(http.StatusOK, resp)
+			return
 		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// integer returns the query value of key as an integer, or zero if it is empty.
+func integer(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return n, nil
+}
+
+// viewer returns the viewer of the activities of the request.
+func viewer(c *gin.Context) activity.Viewer {
+	if !auth.Authenticated(c) {
+		return activity.Viewer{}
+	}
+	return activity.Viewer{MemberID: auth.Member(c).ID, Manager: auth.Can(c, rbac.ActivityPrivateRead)}
+}
+
+// status returns the HTTP status code of err from the activity operations.
+func status(err error) int {
+	switch {
+	case errors.Is(err, activity.ErrInvalidVisibility), errors.Is(err, activity.ErrInvalidCapacity),
+		errors.Is(err, activity.ErrInvalidDuration), err == activity.ErrInvalidCode,
+		errors.Is(err, activity.ErrInvalidRRule), errors.Is(err, activity.ErrInvalidSeries),
+		errors.Is(err, activity.ErrInvalidScope), errors.Is(err, activity.ErrInvalidRange), err == activity.ErrNotOccurrence:
+		return http.StatusBadRequest
+	case err == activity.ErrNotFound, err == activity.ErrFileNotFound, err == activity.ErrNotRSVPed, err == activity.ErrSeriesNotFound:
+		return http.StatusNotFound
+	case err == activity.ErrRSVPClosed, err == activity.ErrAlreadyRSVPed,
+		err == activity.ErrCheckInClosed, err == activity.ErrAlreadyCheckedIn:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
 	}
 }
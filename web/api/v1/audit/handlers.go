@@ -0,0 +1,103 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit defines the router layer of the audit log of the Buddy System.
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+)
+
+// Search handles the audit log search request.
+// The result is exported in CSV if the format query is "csv".
+func Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Entries audit.Entries `json:"entries"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Entries = audit.Entries{}
+
+		filter := audit.Filter{
+			ActorID: c.Query("actor_id"),
+			Actions: c.QueryArray("action"),
+			Target:  c.Query("target"),
+		}
+		if len(filter.Actions) == 0 {
+			filter.Actions = nil
+		}
+
+		var err error
+		if filter.Since, err = timestamp(c, "since"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if filter.Until, err = timestamp(c, "until"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" {
+			resp.Error = fmt.Sprintf("unknown format: %s", format)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		entries, err := audit.Search(c.Request.Context(), filter)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+
+		if format == "csv" {
+			buf := new(bytes.Buffer)
+			if err = entries.WriteCSV(buf); err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+			c.Header("Content-Disposition", `attachment; filename="audit.csv"`)
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+			return
+		}
+
+		resp.Data.Entries = entries
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// timestamp returns the Unix timestamp of the query key, or zero if it is absent.
+func timestamp(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return ts, nil
+}
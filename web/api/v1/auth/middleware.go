@@ -0,0 +1,204 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth defines the authentication and authorization middleware of the Buddy System.
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/pkg/audit"
+	"github.com/kmu-kcc/buddy-backend/pkg/member"
+	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+)
+
+const (
+	tokenKey       = "auth.token"
+	memberKey      = "auth.member"
+	permissionsKey = "auth.permissions"
+	ipKey          = "auth.ip"
+)
+
+// Origin records the client IP address in the context and in the request context for the audit log.
+// The address is the remote address of the connection, unless it is one of proxies (IP addresses or CIDRs).
+// Then X-Forwarded-For is followed back from the nearest hop while the hops are proxies,
+// since the rest of it is given by the client. The malformed proxies are ignored.
+func Origin(proxies ...string) gin.HandlerFunc {
+	trusted := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		} else if _, cidr, err := net.ParseCIDR(proxy); err == nil {
+			trusted = append(trusted, cidr)
+		}
+	}
+
+	return func(c *gin.Context) {
+		ip := clientIP(c.Request, trusted)
+		c.Set(ipKey, ip)
+		c.Request = c.Request.WithContext(audit.WithIP(c.Request.Context(), ip))
+		c.Next()
+	}
+}
+
+// Authenticate verifies the access token of the Authorization header,
+// and loads the token, its member and the member permissions into the context.
+// The member is also recorded in the request context as the actor of the audit log.
+// It aborts with 401 Unauthorized if the token is not valid.
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := oauth2.Token(c.Request.Header.Get("Authorization"))
+
+		if err := token.Valid(c.Request.Context()); err != nil {
+			abort(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		memb, err := member.Get(c.Request.Context(), token.ID())
+		if err == member.ErrNotFound {
+			abort(c, http.StatusUnauthorized, oauth2.ErrInvalidToken)
+			return
+		} else if err != nil {
+			abort(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		permissions, err := rbac.PermissionsOf(c.Request.Context(), memb.ID)
+		if err != nil {
+			abort(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Set(tokenKey, token)
+		c.Set(memberKey, memb)
+		c.Set(permissionsKey, permissions)
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), memb.ID))
+		c.Next()
+	}
+}
+
+// OptionalAuthenticate authenticates the request like Authenticate if it has the Authorization header,
+// and lets the anonymous request through otherwise.
+// The handlers following it tell them apart with Authenticated.
+func OptionalAuthenticate() gin.HandlerFunc {
+	authenticate := Authenticate()
+	return func(c *gin.Context) {
+		if c.Request.Header.Get("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// RequirePermission allows the members who have any of permissions.
+// It aborts with 403 Forbidden otherwise.
+//
+// NOTE:
+//
+// It must be preceded by Authenticate.
+func RequirePermission(permissions ...rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Permissions(c).HasAny(permissions...) {
+			abort(c, http.StatusForbidden, member.ErrPermissionDenied)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClientIP returns the client IP address of the request recorded by Origin.
+func ClientIP(c *gin.Context) string {
+	return c.GetString(ipKey)
+}
+
+// Authenticated reports whether the request is authenticated.
+func Authenticated(c *gin.Context) bool {
+	_, ok := c.Get(memberKey)
+	return ok
+}
+
+// Token returns the access token of the authenticated request.
+func Token(c *gin.Context) oauth2.Token {
+	return c.MustGet(tokenKey).(oauth2.Token)
+}
+
+// Member returns the member of the authenticated request.
+func Member(c *gin.Context) *member.Member {
+	return c.MustGet(memberKey).(*member.Member)
+}
+
+// Permissions returns the permissions of the member of the authenticated request.
+func Permissions(c *gin.Context) rbac.Permissions {
+	return c.MustGet(permissionsKey).(rbac.Permissions)
+}
+
+// Can reports whether the member of the authenticated request has permission.
+func Can(c *gin.Context, permission rbac.Permission) bool {
+	return Permissions(c).Has(permission)
+}
+
+// Self reports whether id is the ID of the member of the authenticated request,
+// or the member has any of permissions.
+// The handlers must check it with id decoded from the same request they serve.
+func Self(c *gin.Context, id string, permissions ...rbac.Permission) bool {
+	return id == Member(c).ID || Permissions(c).HasAny(permissions...)
+}
+
+// clientIP returns the client IP address of req, which trusts X-Forwarded-For from proxies only.
+func clientIP(req *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for idx := len(hops) - 1; idx >= 0 && trusts(proxies, ip); idx-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[idx]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip.String()
+}
+
+// trusts reports whether ip is one of proxies.
+func trusts(proxies []*net.IPNet, ip net.IP) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// abort aborts c with status and err in the common response format.
+func abort(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, struct {
+		Error string `json:"error,omitempty"`
+	}{Error: err.Error()})
+}
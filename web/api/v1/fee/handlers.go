@@ -16,19 +16,29 @@
 package fee
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/pkg/activity"
+	"github.com/kmu-kcc/buddy-backend/pkg/bank"
 	"github.com/kmu-kcc/buddy-backend/pkg/fee"
 	"github.com/kmu-kcc/buddy-backend/pkg/member"
-	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // // Create handles the fee creation request.
 func Create() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(fee.Fee)
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -40,25 +50,9 @@ func Create() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := body.Create(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		if err := body.Create(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(status(err), resp)
 			return
 		}
 		c.JSON(http.StatusOK, resp)
@@ -68,7 +62,6 @@ func Create() gin.HandlerFunc {
 // // Amount handles the submission amount request.
 func Amount() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			MemberID string `json:"member_id"`
 			Year     int    `json:"year"`
@@ -87,13 +80,13 @@ func Amount() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+		if !auth.Self(c, body.MemberID, rbac.FeeRead) {
+			resp.Error = member.ErrPermissionDenied.Error()
+			c.JSON(http.StatusForbidden, resp)
 			return
 		}
 
-		sum, err := fee.Amount(body.Year, body.Semester, body.MemberID)
+		sum, err := fee.Amount(c.Request.Context(), body.Year, body.Semester, body.MemberID)
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -108,7 +101,6 @@ func Amount() gin.HandlerFunc {
 // Payers handles the payer list request.
 func Payers() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(fee.Fee)
 		resp := new(struct {
 			Data struct {
@@ -124,23 +116,7 @@ func Payers() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		if resp.Data.Payers, err = body.Payers(); err != nil {
+		if resp.Data.Payers, err = body.Payers(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -153,7 +129,6 @@ func Payers() gin.HandlerFunc {
 // Deptors handles deptor list request.
 func Deptors() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(fee.Fee)
 		resp := new(struct {
 			Data struct {
@@ -171,23 +146,7 @@ func Deptors() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		deptors, depts, err := body.Deptors()
+		deptors, depts, err := body.Deptors(c.Request.Context())
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -211,7 +170,6 @@ func Deptors() gin.HandlerFunc {
 // Search handles the fee search request.
 func Search() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(fee.Fee)
 		resp := new(struct {
 			Data struct {
@@ -229,13 +187,7 @@ func Search() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if resp.Data.CarryOver, resp.Data.Logs, resp.Data.Total, err = body.Search(); err != nil {
+		if resp.Data.CarryOver, resp.Data.Logs, resp.Data.Total, err = body.Search(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -247,10 +199,10 @@ func Search() gin.HandlerFunc {
 // Pay handles the payment request.
 func Pay() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
-			Year     int `json:"year"`
-			Semester int `json:"semester"`
+			Year     int                 `json:"year"`
+			Semester int                 `json:"semester"`
+			Item     *primitive.ObjectID `json:"item"`
 			Payments []struct {
 				ID     string `json:"id"`
 				Amount int    `json:"amount"`
@@ -266,22 +218,6 @@ func Pay() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
 		ids := make([]string, len(body.Payments))
 		amounts := make([]int, len(body.Payments))
 
@@ -289,9 +225,9 @@ func Pay() gin.HandlerFunc {
 			ids[idx], amounts[idx] = payment.ID, payment.Amount
 		}
 
-		if err := fee.Pay(body.Year, body.Semester, ids, amounts); err != nil {
+		if err := fee.Pay(c.Request.Context(), body.Year, body.Semester, body.Item, ids, amounts); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			c.JSON(status(err), resp)
 			return
 		}
 		c.JSON(http.StatusOK, resp)
@@ -301,7 +237,6 @@ func Pay() gin.HandlerFunc {
 // Deposit handles the deposit request.
 func Deposit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			Year        int    `json:"year"`
 			Semester    int    `json:"semester"`
@@ -318,23 +253,75 @@ func Deposit() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := fee.Deposit(c.Request.Context(), body.Year, body.Semester, body.Amount, body.Description); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Expend handles the expense request.
+func Expend() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year        int    `json:"year"`
+			Semester    int    `json:"semester"`
+			Amount      int    `json:"amount"`
+			Description string `json:"description"`
+			Category    string `json:"category"`
+			Payee       string `json:"payee"`
+			Receipt     string `json:"receipt"`
+			ApprovedBy  string `json:"approved_by"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		expense := fee.NewExpense(body.Description, body.Category, body.Payee, body.Receipt, body.ApprovedBy, body.Amount)
+
+		if err := fee.Expend(c.Request.Context(), body.Year, body.Semester, *expense); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			if errors.Is(err, fee.ErrInvalidExpense) {
+				c.JSON(http.StatusBadRequest, resp)
+			} else {
+				c.JSON(status(err), resp)
+			}
 			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Expenses handles the expense list request.
+func Expenses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Data struct {
+				Expenses fee.Logs `json:"expenses"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if err := fee.Deposit(body.Year, body.Semester, body.Amount, body.Description); err != nil {
+		if resp.Data.Expenses, err = fee.Expenses(c.Request.Context(), body.Year, body.Semester); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -346,7 +333,6 @@ func Deposit() gin.HandlerFunc {
 // Exempt handles the exemption request.
 func Exempt() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			fee.Fee
 			ID string `json:"id"`
@@ -362,23 +348,110 @@ func Exempt() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := body.Exempt(c.Request.Context(), body.ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Check handles the orphaned log check request.
+func Check() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Repair bool `json:"repair"`
+		})
+		resp := new(struct {
+			Data struct {
+				Orphans fee.Logs `json:"orphans"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		if resp.Data.Orphans, err = fee.Check(c.Request.Context(), body.Repair); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
-		} else if !role.FeeManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// TrialBalance handles the trial balance request.
+func TrialBalance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Data struct {
+				Balances fee.Balances `json:"balances"`
+				Debit    int          `json:"debit"`
+				Credit   int          `json:"credit"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Balances, err = fee.TrialBalance(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+
+		for _, balance := range resp.Data.Balances {
+			resp.Data.Debit += balance.Debit
+			resp.Data.Credit += balance.Credit
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// AccountStatement handles the account statement request.
+func AccountStatement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Account  fee.Account `json:"account"`
+			Year     int         `json:"year"`
+			Semester int         `json:"semester"`
+		})
+		resp := new(struct {
+			Data struct {
+				Lines fee.Lines `json:"lines"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if body.Account == "" {
+			resp.Error = "account is required"
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if err := body.Exempt(body.ID); err != nil {
+		if resp.Data.Lines, err = fee.Statement(c.Request.Context(), body.Account, body.Year, body.Semester); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -386,3 +459,833 @@ func Exempt() gin.HandlerFunc {
 		c.JSON(http.StatusOK, resp)
 	}
 }
+
+// Reverse handles the fee log reversal request.
+func Reverse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			ID       primitive.ObjectID `json:"id"`
+			Reason   string             `json:"reason"`
+		})
+		resp := new(struct {
+			Data struct {
+				Reversal *fee.Log `json:"reversal"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Reversal, err = fee.Reverse(c.Request.Context(), body.Year, body.Semester, body.ID, body.Reason); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Revoke handles the exemption revocation request.
+func Revoke() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			fee.Fee
+			ID     string `json:"id"`
+			Reason string `json:"reason"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := body.Revoke(c.Request.Context(), body.ID, body.Reason); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Import handles the bank statement import request.
+// The statement is uploaded as a multipart form with its fee, the bank and the column mapping.
+func Import() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Remittances fee.Remittances `json:"remittances"`
+				Skipped     int             `json:"skipped"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		year, err := strconv.Atoi(c.PostForm("year"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		semester, err := strconv.Atoi(c.PostForm("semester"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		mapping, err := bank.Lookup(c.PostForm("bank"), bank.Mapping{
+			Date:    c.PostForm("date"),
+			Name:    c.PostForm("name"),
+			Memo:    c.PostForm("memo"),
+			Deposit: c.PostForm("deposit"),
+		})
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		format := c.DefaultPostForm("format", strings.TrimPrefix(filepath.Ext(header.Filename), "."))
+
+		file, err := header.Open()
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		defer file.Close()
+
+		records, err := bank.Parse(file, format, mapping)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Remittances, err = fee.Import(c.Request.Context(), year, semester, records); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		resp.Data.Skipped = len(records) - len(resp.Data.Remittances)
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Remittances handles the remittance list request.
+func Remittances() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int      `json:"year"`
+			Semester int      `json:"semester"`
+			Statuses []string `json:"statuses"`
+		})
+		resp := new(struct {
+			Data struct {
+				Remittances fee.Remittances `json:"remittances"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Remittances, err = fee.FindRemittances(c.Request.Context(), body.Year, body.Semester, body.Statuses); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Resolve handles the remittance resolution request.
+func Resolve() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID       string `json:"id"`
+			MemberID string `json:"member_id"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.Resolve(c.Request.Context(), body.ID, body.MemberID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Dismiss handles the remittance dismissal request.
+func Dismiss() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID   string `json:"id"`
+			Note string `json:"note"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.Dismiss(c.Request.Context(), body.ID, body.Note); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Close handles the semester closing request.
+func Close() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.Close(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Reopen handles the semester reopening request.
+func Reopen() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.Reopen(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Recompute handles the carry-over recomputation request.
+func Recompute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.Recompute(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Chain handles the balance chain request.
+func Chain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Chain fee.Chain `json:"chain"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		var err error
+		if resp.Data.Chain, err = fee.BalanceChain(c.Request.Context()); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// SetPolicy handles the fee policy setting request.
+func SetPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int        `json:"year"`
+			Semester int        `json:"semester"`
+			Policy   fee.Policy `json:"policy"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := fee.SetPolicy(c.Request.Context(), body.Year, body.Semester, body.Policy); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Policy handles the fee policy request, with the liabilities of the members by the policy.
+func Policy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Data struct {
+				Policy      *fee.Policy     `json:"policy"`
+				Liabilities fee.Liabilities `json:"liabilities"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		var err error
+		if resp.Data.Policy, resp.Data.Liabilities, err = fee.Assess(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// AddItem handles the fee item addition request.
+func AddItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+			fee.Item
+		})
+		resp := new(struct {
+			Data struct {
+				Item *fee.Item `json:"item"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Item, err = fee.AddItem(c.Request.Context(), body.Year, body.Semester, body.Item); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Items handles the fee item list request.
+func Items() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int `json:"year"`
+			Semester int `json:"semester"`
+		})
+		resp := new(struct {
+			Data struct {
+				Items fee.Items `json:"items"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Items, err = fee.FindItems(c.Request.Context(), body.Year, body.Semester); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ItemPayers handles the payer list request of a fee item.
+func ItemPayers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			Item     primitive.ObjectID `json:"item"`
+		})
+		resp := new(struct {
+			Data struct {
+				Payers member.Members `json:"payers"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		err := json.NewDecoder(c.Request.Body).Decode(body)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if resp.Data.Payers, err = fee.ItemPayers(c.Request.Context(), body.Year, body.Semester, body.Item); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ItemDeptors handles the deptor list request of a fee item.
+func ItemDeptors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			Item     primitive.ObjectID `json:"item"`
+		})
+		resp := new(struct {
+			Data struct {
+				Deptors []struct {
+					member.Member
+					Dept int `json:"dept"`
+				} `json:"deptors"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		deptors, depts, err := fee.ItemDeptors(c.Request.Context(), body.Year, body.Semester, body.Item)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+
+		resp.Data.Deptors = make([]struct {
+			member.Member
+			Dept int `json:"dept"`
+		}, len(deptors))
+
+		for idx, deptor := range deptors {
+			resp.Data.Deptors[idx].Member = deptor
+			resp.Data.Deptors[idx].Dept = depts[idx]
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Statement handles the fee statement request of the authenticated member.
+// The statement is exported in CSV or PDF if the format is "csv" or "pdf".
+func Statement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Format string `json:"format"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		// the body is optional
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil && err != io.EOF {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		statement(c, auth.Member(c), body.Format)
+	}
+}
+
+// MemberStatement handles the fee statement request of any member.
+// The statement is exported in CSV or PDF if the format is "csv" or "pdf".
+func MemberStatement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			MemberID string `json:"member_id"`
+			Format   string `json:"format"`
+		})
+
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		memb, err := member.Get(c.Request.Context(), body.MemberID)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		statement(c, memb, body.Format)
+	}
+}
+
+// statement responds the fee statement of m in format.
+func statement(c *gin.Context, m *member.Member, format string) {
+	resp := new(struct {
+		Data struct {
+			Dues fee.Dues `json:"dues"`
+		} `json:"data"`
+		Error string `json:"error,omitempty"`
+	})
+
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "pdf" {
+		resp.Error = fmt.Sprintf("unknown format: %s", format)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	dues, err := fee.MemberStatement(c.Request.Context(), m.ID)
+	if err != nil {
+		resp.Error = err.Error()
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	switch format {
+	case "csv":
+		err = dues.WriteCSV(buf)
+	case "pdf":
+		err = dues.WritePDF(buf, m.ID, m.Name)
+	default:
+		resp.Data.Dues = dues
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+
+	contentType := map[string]string{"csv": "text/csv; charset=utf-8", "pdf": "application/pdf"}[format]
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.%s"`, m.ID, format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// Attach handles the receipt attachment request of a deposit or an expense log.
+func Attach() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				File activity.File `json:"file"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		// the form has the other fields along the file, within a megabyte.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, fee.MaxAttachmentSize+1<<20)
+
+		year, err := strconv.Atoi(c.PostForm("year"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		semester, err := strconv.Atoi(c.PostForm("semester"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		id, err := primitive.ObjectIDFromHex(c.PostForm("id"))
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if header.Size > fee.MaxAttachmentSize {
+			resp.Error = fmt.Sprintf("%v: the size must be %d bytes at most", fee.ErrInvalidAttachment, fee.MaxAttachmentSize)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		src, err := header.Open()
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		defer src.Close()
+
+		if resp.Data.File, err = fee.Attach(c.Request.Context(), year, semester, id, header.Filename, src); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Attachment handles the attachment download request.
+func Attachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			ID       primitive.ObjectID `json:"id"`
+			FileName string             `json:"filename"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		file, err := fee.Attachment(c.Request.Context(), body.Year, body.Semester, body.ID, body.FileName)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.File(file.Absolute())
+	}
+}
+
+// Receipt handles the receipt request of a payment of the authenticated member.
+// The receipt is exported in PDF if the format is "pdf".
+func Receipt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			ID       primitive.ObjectID `json:"id"`
+			Format   string             `json:"format"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		receipt(c, body.Year, body.Semester, body.ID, auth.Member(c).ID, body.Format)
+	}
+}
+
+// MemberReceipt handles the receipt request of a payment of any member.
+// The receipt is exported in PDF if the format is "pdf".
+func MemberReceipt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Year     int                `json:"year"`
+			Semester int                `json:"semester"`
+			ID       primitive.ObjectID `json:"id"`
+			Format   string             `json:"format"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		receipt(c, body.Year, body.Semester, body.ID, "", body.Format)
+	}
+}
+
+// receipt responds the receipt of the payment log of id in format,
+// issuing it if it is not issued yet.
+func receipt(c *gin.Context, year, semester int, id primitive.ObjectID, memberID, format string) {
+	resp := new(struct {
+		Data struct {
+			Receipt *fee.Receipt `json:"receipt"`
+		} `json:"data"`
+		Error string `json:"error,omitempty"`
+	})
+
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "pdf" {
+		resp.Error = fmt.Sprintf("unknown format: %s", format)
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	r, err := fee.IssueReceipt(c.Request.Context(), year, semester, id, memberID)
+	if err != nil {
+		resp.Error = err.Error()
+		c.JSON(status(err), resp)
+		return
+	}
+
+	if format == "json" {
+		resp.Data.Receipt = r
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err = r.WritePDF(buf); err != nil {
+		resp.Error = err.Error()
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="receipt-%06d.pdf"`, r.Number))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// Receipts handles the issued receipt list request.
+func Receipts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			MemberID string `json:"member_id"`
+		})
+		resp := new(struct {
+			Data struct {
+				Receipts fee.Receipts `json:"receipts"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		// the body is optional
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil && err != io.EOF {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		var err error
+		if resp.Data.Receipts, err = fee.FindReceipts(c.Request.Context(), fee.ReceiptFilter{MemberID: body.MemberID}); err != nil {
+			resp.Error = err.Error()
+			resp.Data.Receipts = fee.Receipts{}
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// status returns the HTTP status code of err from the fee operations.
+func status(err error) int {
+	switch err {
+	case fee.ErrNotFound, fee.ErrLogNotFound, fee.ErrRemittanceNotFound, fee.ErrItemNotFound, fee.ErrAttachmentNotFound, member.ErrNotFound:
+		return http.StatusNotFound
+	case fee.ErrClosedFee, fee.ErrOpenFee, fee.ErrAlreadyExempted, fee.ErrAlreadyReversed, fee.ErrNotExempted, fee.ErrReviewed:
+		return http.StatusConflict
+	default:
+		if errors.Is(err, fee.ErrClosedFee) {
+			return http.StatusConflict
+		}
+		if errors.Is(err, fee.ErrInvalidReversal) || errors.Is(err, fee.ErrInvalidPolicy) || errors.Is(err, fee.ErrInvalidItem) ||
+			errors.Is(err, fee.ErrInvalidAttachment) || errors.Is(err, fee.ErrInvalidReceipt) {
+			return http.StatusBadRequest
+		}
+		return http.StatusInternalServerError
+	}
+}
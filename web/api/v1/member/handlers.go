@@ -17,23 +17,27 @@ package member
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kmu-kcc/buddy-backend/pkg/member"
 	"github.com/kmu-kcc/buddy-backend/pkg/oauth2"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
 )
 
 // SignIn handles the signin request.
 func SignIn() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		body := new(member.Member)
+		body := new(struct {
+			ID       string `json:"id"`
+			Password string `json:"password"`
+			Device   string `json:"device"`
+		})
 		resp := new(struct {
-			Data struct {
-				AccessToken oauth2.Token `json:"access_token"`
-				ExpiredAt   int64        `json:"expired_at,string"`
-			} `json:"data"`
-			Error string `json:"error,omitempty"`
+			Data  oauth2.Pair `json:"data"`
+			Error string      `json:"error,omitempty"`
 		})
 
 		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
@@ -42,32 +46,77 @@ func SignIn() gin.HandlerFunc {
 			return
 		}
 
-		err := body.SingIn()
+		err := (member.Member{ID: body.ID, Password: body.Password}).SingIn(c.Request.Context())
 		if err != nil {
 			resp.Error = err.Error()
 			if err == member.ErrIdentityMismatch {
 				c.JSON(http.StatusConflict, resp)
+			} else if err == member.ErrPasswordChangeRequired {
+				c.JSON(http.StatusForbidden, resp)
 			} else {
 				c.JSON(http.StatusInternalServerError, resp)
 			}
 			return
 		}
 
-		resp.Data.AccessToken, resp.Data.ExpiredAt, err = oauth2.NewToken(body.ID)
+		pair, err := oauth2.Issue(c.Request.Context(), body.ID, oauth2.Device{
+			Name:      body.Device,
+			UserAgent: c.Request.UserAgent(),
+			IP:        auth.ClientIP(c),
+		})
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusUnprocessableEntity, resp)
 			return
 		}
 
+		resp.Data = *pair
+
 		c.JSON(http.StatusOK, resp)
 	}
 }
 
-// SignUp handles the signup request.
-func SignUp() gin.HandlerFunc {
+// Refresh handles the access token refresh request.
+func Refresh() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		body := new(member.Member)
+		body := new(struct {
+			RefreshToken string `json:"refresh_token"`
+		})
+		resp := new(struct {
+			Data  oauth2.Pair `json:"data"`
+			Error string      `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		pair, err := oauth2.Refresh(c.Request.Context(), body.RefreshToken)
+		if err != nil {
+			resp.Error = err.Error()
+			if err == oauth2.ErrInvalidToken || err == oauth2.ErrTokenReused {
+				c.JSON(http.StatusUnauthorized, resp)
+			} else {
+				c.JSON(http.StatusInternalServerError, resp)
+			}
+			return
+		}
+
+		resp.Data = *pair
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// ChangePassword handles the password change request.
+func ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			ID          string `json:"id"`
+			Password    string `json:"password"`
+			NewPassword string `json:"new_password"`
+		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
 		})
@@ -78,8 +127,29 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
-		if err := member.New(body.ID, body.Name, body.Department, body.Phone, body.Email, body.Grade, body.Attendance).
-			SignUp(); err != nil {
+		if err := (member.Member{ID: body.ID, Password: body.Password}).ChangePassword(c.Request.Context(), body.NewPassword); err != nil {
+			resp.Error = err.Error()
+			if err == member.ErrIdentityMismatch {
+				c.JSON(http.StatusConflict, resp)
+			} else if errors.Is(err, member.ErrWeakPassword) {
+				c.JSON(http.StatusBadRequest, resp)
+			} else {
+				c.JSON(http.StatusInternalServerError, resp)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Logout handles the logout request.
+func Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := auth.Token(c).Revoke(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -88,39 +158,54 @@ func SignUp() gin.HandlerFunc {
 	}
 }
 
-// SignUps handles the signup list request.
-func SignUps() gin.HandlerFunc {
+// Sessions handles the active session list request.
+func Sessions() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		resp := new(struct {
 			Data struct {
-				SignUps member.Members `json:"signups"`
+				Current  string          `json:"current"`
+				Sessions oauth2.Sessions `json:"sessions"`
 			} `json:"data"`
 			Error string `json:"error,omitempty"`
 		})
 
-		err := token.Valid()
-		if err != nil {
+		var err error
+		resp.Data.Current = auth.Token(c).Session()
+		if resp.Data.Sessions, err = oauth2.ActiveSessions(c.Request.Context(), auth.Member(c).ID); err != nil {
 			resp.Error = err.Error()
-			resp.Data.SignUps = member.Members{}
-			c.JSON(http.StatusUnauthorized, resp)
+			resp.Data.Sessions = oauth2.Sessions{}
+			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// RevokeSessions handles the session revocation request.
+func RevokeSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			IDs []string `json:"ids"`
+			All bool     `json:"all"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
 
-		if role, err := token.Role(); err != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			resp.Data.SignUps = member.Members{}
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			resp.Data.SignUps = member.Members{}
-			c.JSON(http.StatusForbidden, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		resp.Data.SignUps, err = member.SignUps()
-		if err != nil {
+		ids := body.IDs
+		if body.All {
+			ids = nil
+		} else if ids == nil {
+			ids = []string{}
+		}
+
+		if err := oauth2.Revoke(c.Request.Context(), auth.Member(c).ID, ids); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -129,12 +214,11 @@ func SignUps() gin.HandlerFunc {
 	}
 }
 
-// Approve handles the signup approvement request.
-func Approve() gin.HandlerFunc {
+// ForceLogout handles the forced logout request.
+func ForceLogout() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
-			IDs []string `json:"ids"`
+			ID string `json:"id"`
 		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -146,23 +230,52 @@ func Approve() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := oauth2.Revoke(c.Request.Context(), body.ID, nil); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// SignUp handles the signup request.
+func SignUp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(member.Member)
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if role, err := token.Role(); err != nil {
+		if err := member.New(body.ID, body.Name, body.Department, body.Phone, body.Email, body.Grade, body.Attendance).
+			SignUp(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
 		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
 
-		if err := member.Approve(body.IDs); err != nil {
+// SignUps handles the signup list request.
+func SignUps() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				SignUps member.Members `json:"signups"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		var err error
+		resp.Data.SignUps, err = member.SignUps(c.Request.Context())
+		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -171,10 +284,9 @@ func Approve() gin.HandlerFunc {
 	}
 }
 
-// Delete handles the refusal and deletion request.
-func Delete() gin.HandlerFunc {
+// Approve handles the signup approvement request.
+func Approve() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			IDs []string `json:"ids"`
 		})
@@ -188,27 +300,44 @@ func Delete() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if err := member.Approve(c.Request.Context(), body.IDs); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
 
-		if role, err := token.Role(); err != nil {
+// Delete handles the refusal and deletion request.
+func Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			IDs []string `json:"ids"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
 
-		if err := member.Delete(body.IDs); err != nil {
+		if err := member.Delete(c.Request.Context(), body.IDs); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
+
+		for _, id := range body.IDs {
+			if err := oauth2.Revoke(c.Request.Context(), id, nil); err != nil {
+				resp.Error = err.Error()
+				c.JSON(http.StatusInternalServerError, resp)
+				return
+			}
+		}
 		c.JSON(http.StatusOK, resp)
 	}
 }
@@ -216,7 +345,6 @@ func Delete() gin.HandlerFunc {
 // Exit handles the exit request.
 func Exit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(member.Member)
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -228,13 +356,13 @@ func Exit() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+		if !auth.Self(c, body.ID) {
+			resp.Error = member.ErrPermissionDenied.Error()
+			c.JSON(http.StatusForbidden, resp)
 			return
 		}
 
-		if err := body.Exit(); err != nil {
+		if err := body.Exit(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -246,7 +374,6 @@ func Exit() gin.HandlerFunc {
 // Exits handles the exit list request.
 func Exits() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		resp := new(struct {
 			Data struct {
 				Exits member.Members `json:"exits"`
@@ -254,27 +381,8 @@ func Exits() gin.HandlerFunc {
 			Error string `json:"error,omitempty"`
 		})
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			resp.Data.Exits = member.Members{}
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			resp.Data.Exits = member.Members{}
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			resp.Data.Exits = member.Members{}
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
 		var err error
-		resp.Data.Exits, err = member.Exits()
+		resp.Data.Exits, err = member.Exits(c.Request.Context())
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -287,7 +395,6 @@ func Exits() gin.HandlerFunc {
 // My handles the personal information request.
 func My() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			ID       string `json:"id"`
 			Password string `json:"password"`
@@ -306,17 +413,27 @@ func My() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
+		if !auth.Self(c, body.ID) {
+			resp.Error = member.ErrPermissionDenied.Error()
+			c.JSON(http.StatusForbidden, resp)
+			return
+		}
+
+		if resp.Data.Data, err = (&member.Member{ID: body.ID, Password: body.Password}).My(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		if resp.Data.Data, err = (&member.Member{ID: body.ID, Password: body.Password}).My(); err != nil {
+		roles, err := rbac.RolesOf(c.Request.Context(), []string{body.ID})
+		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
+
+		resp.Data.Data["roles"] = roles[body.ID]
+		resp.Data.Data["permissions"] = auth.Permissions(c)
 		c.JSON(http.StatusOK, resp)
 	}
 }
@@ -324,7 +441,6 @@ func My() gin.HandlerFunc {
 // Search handles the member search request.
 func Search() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		query := c.Query("query")
 		resp := new(struct {
 			Data struct {
@@ -333,39 +449,52 @@ func Search() gin.HandlerFunc {
 			Error string `json:"error,omitempty"`
 		})
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		role, err := token.Role()
+		members, err := member.Search(c.Request.Context(), query)
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		members, err := member.Search(query)
+		ids := make([]string, len(members))
+		for idx, memb := range members {
+			ids[idx] = memb.ID
+		}
+
+		roles, err := rbac.RolesOf(c.Request.Context(), ids)
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
 		}
 
-		if role.MemberManagement {
+		if auth.Can(c, rbac.MemberRead) {
 			resp := new(struct {
 				Data struct {
-					Members member.Members `json:"members"`
+					Members []struct {
+						member.Member
+						Roles []string `json:"roles"`
+					} `json:"members"`
 				} `json:"data"`
 				Error string `json:"error,omitempty"`
 			})
-			resp.Data.Members = members
+			resp.Data.Members = make([]struct {
+				member.Member
+				Roles []string `json:"roles"`
+			}, len(members))
+
+			for idx, memb := range members {
+				resp.Data.Members[idx].Member = memb
+				resp.Data.Members[idx].Roles = roles[memb.ID]
+			}
 			c.JSON(http.StatusOK, resp)
 			return
 		}
 
 		resp.Data.Members = members.Public()
+		for _, pub := range resp.Data.Members {
+			pub["roles"] = roles[pub["id"].(string)]
+		}
 		c.JSON(http.StatusOK, resp)
 	}
 }
@@ -373,10 +502,9 @@ func Search() gin.HandlerFunc {
 // Update handles the member update request.
 func Update() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
-			ID     string                 `json:"id"`
-			Update map[string]interface{} `json:"update"`
+			ID     string        `json:"id"`
+			Update member.Update `json:"update"`
 		})
 		resp := new(struct {
 			Error string `json:"error,omitempty"`
@@ -388,15 +516,26 @@ func Update() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
+		if !auth.Self(c, body.ID, rbac.MemberUpdate) {
+			resp.Error = member.ErrPermissionDenied.Error()
+			c.JSON(http.StatusForbidden, resp)
 			return
 		}
 
-		if err := (member.Member{ID: body.ID}).Update(body.Update); err != nil {
+		privileged := auth.Can(c, rbac.MemberUpdate)
+
+		if err := (member.Member{ID: body.ID}).Update(c.Request.Context(), body.Update, privileged); err != nil {
 			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
+			if errors.Is(err, member.ErrPermissionDenied) {
+				c.JSON(http.StatusForbidden, resp)
+			} else if err == member.ErrNotFound {
+				c.JSON(http.StatusNotFound, resp)
+			} else if errors.Is(err, member.ErrInvalidField) || errors.Is(err, member.ErrEmptyUpdate) {
+				c.JSON(http.StatusBadRequest, resp)
+			} else {
+				c.JSON(http.StatusInternalServerError, resp)
+			}
+			return
 		}
 		c.JSON(http.StatusOK, resp)
 	}
@@ -413,7 +552,7 @@ func Active() gin.HandlerFunc {
 		})
 
 		var err error
-		if resp.Data.Active, err = member.Active(); err != nil {
+		if resp.Data.Active, err = member.Active(c.Request.Context()); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -425,7 +564,6 @@ func Active() gin.HandlerFunc {
 // Activate handles the member signup activation status update request.
 func Activate() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		body := new(struct {
 			Activate bool `json:"activate"`
 		})
@@ -443,23 +581,7 @@ func Activate() gin.HandlerFunc {
 			return
 		}
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		if resp.Data.Active, err = member.Activate(body.Activate); err != nil {
+		if resp.Data.Active, err = member.Activate(c.Request.Context(), body.Activate); err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
 			return
@@ -471,7 +593,6 @@ func Activate() gin.HandlerFunc {
 // Graduates handles the graduate list request.
 func Graduates() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
 		resp := new(struct {
 			Data struct {
 				Graduates member.Members `json:"graduates"`
@@ -479,24 +600,8 @@ func Graduates() gin.HandlerFunc {
 			Error string `json:"error,omitempty"`
 		})
 
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.MemberManagement {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
 		var err error
-		resp.Data.Graduates, err = member.Graduates()
+		resp.Data.Graduates, err = member.Graduates(c.Request.Context())
 		if err != nil {
 			resp.Error = err.Error()
 			c.JSON(http.StatusInternalServerError, resp)
@@ -505,46 +610,3 @@ func Graduates() gin.HandlerFunc {
 		c.JSON(http.StatusOK, resp)
 	}
 }
-
-// UpdateRole handles the role update request.
-func UpdateRole() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := oauth2.Token(c.Request.Header.Get("Authorization"))
-		body := new(struct {
-			ID   string      `json:"id"`
-			Role member.Role `json:"role"`
-		})
-		resp := new(struct {
-			Error string `json:"error,omitempty"`
-		})
-
-		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusBadRequest, resp)
-			return
-		}
-
-		if err := token.Valid(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusUnauthorized, resp)
-			return
-		}
-
-		if role, err := token.Role(); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		} else if !role.Master {
-			resp.Error = member.ErrPermissionDenied.Error()
-			c.JSON(http.StatusForbidden, resp)
-			return
-		}
-
-		if err := member.UpdateRole(body.ID, body.Role); err != nil {
-			resp.Error = err.Error()
-			c.JSON(http.StatusInternalServerError, resp)
-			return
-		}
-		c.JSON(http.StatusOK, resp)
-	}
-}
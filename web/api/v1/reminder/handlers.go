@@ -0,0 +1,142 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reminder defines the router layer of the payment reminder of the Buddy System.
+package reminder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/pkg/reminder"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
+)
+
+// Preference handles the reminder preference request.
+func Preference() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Preference *reminder.Preference `json:"preference"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		var err error
+		if resp.Data.Preference, err = reminder.PreferenceOf(c.Request.Context(), auth.Member(c).ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// OptOut handles the reminder opt-out request.
+func OptOut() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			OptOut bool `json:"opt_out"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := reminder.OptOut(c.Request.Context(), auth.Member(c).ID, body.OptOut); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Deliveries handles the reminder delivery log request.
+func Deliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Deliveries reminder.Deliveries `json:"deliveries"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+		resp.Data.Deliveries = reminder.Deliveries{}
+
+		filter := reminder.Filter{
+			MemberID: c.Query("member_id"),
+			Statuses: c.QueryArray("status"),
+		}
+		if len(filter.Statuses) == 0 {
+			filter.Statuses = nil
+		}
+
+		var (
+			year, semester int64
+			err            error
+		)
+		if year, err = integer(c, "year"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if semester, err = integer(c, "semester"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if filter.Since, err = integer(c, "since"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		if filter.Until, err = integer(c, "until"); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		filter.Year, filter.Semester = int(year), int(semester)
+
+		deliveries, err := reminder.Search(c.Request.Context(), filter)
+		if err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+
+		resp.Data.Deliveries = deliveries
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// integer returns the integer value of the query key, or zero if it is absent.
+func integer(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return n, nil
+}
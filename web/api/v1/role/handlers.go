@@ -0,0 +1,237 @@
+// Copyright 2021 KMU KCC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package role defines the router layer of the member roles of the Buddy System.
+package role
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kmu-kcc/buddy-backend/pkg/rbac"
+	"github.com/kmu-kcc/buddy-backend/web/api/v1/auth"
+)
+
+// List handles the role list request.
+func List() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Roles rbac.Roles `json:"roles"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		var err error
+		if resp.Data.Roles, err = rbac.List(c.Request.Context()); err != nil {
+			resp.Error = err.Error()
+			resp.Data.Roles = rbac.Roles{}
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Permissions handles the permission list request.
+func Permissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := new(struct {
+			Data struct {
+				Permissions rbac.Permissions `json:"permissions"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		resp.Data.Permissions = rbac.All
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Create handles the role creation request.
+func Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Name        string           `json:"name"`
+			Description string           `json:"description"`
+			Permissions rbac.Permissions `json:"permissions"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := rbac.New(body.Name, body.Description, body.Permissions).Create(c.Request.Context()); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Update handles the role update request.
+func Update() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Name        string           `json:"name"`
+			Description string           `json:"description"`
+			Permissions rbac.Permissions `json:"permissions"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := rbac.Update(c.Request.Context(), body.Name, body.Description, body.Permissions); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Delete handles the role deletion request.
+func Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Name string `json:"name"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := rbac.Delete(c.Request.Context(), body.Name); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Assign handles the role assignment request.
+func Assign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Name      string   `json:"name"`
+			IDs       []string `json:"ids"`
+			ExpiredAt int64    `json:"expired_at,string"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := rbac.Assign(c.Request.Context(), body.Name, body.IDs, body.ExpiredAt, auth.Member(c).ID); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Unassign handles the role unassignment request.
+func Unassign() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := new(struct {
+			Name string   `json:"name"`
+			IDs  []string `json:"ids"`
+		})
+		resp := new(struct {
+			Error string `json:"error,omitempty"`
+		})
+
+		if err := json.NewDecoder(c.Request.Body).Decode(body); err != nil {
+			resp.Error = err.Error()
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+
+		if err := rbac.Unassign(c.Request.Context(), body.Name, body.IDs); err != nil {
+			resp.Error = err.Error()
+			c.JSON(status(err), resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Grants handles the role grant list request.
+func Grants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := rbac.GrantFilter{}
+		if name, ok := c.GetQuery("role"); ok {
+			filter.Roles = []string{name}
+		}
+		if id, ok := c.GetQuery("member_id"); ok {
+			filter.MemberIDs = []string{id}
+		}
+		resp := new(struct {
+			Data struct {
+				Grants rbac.Grants `json:"grants"`
+			} `json:"data"`
+			Error string `json:"error,omitempty"`
+		})
+
+		var err error
+		if resp.Data.Grants, err = rbac.Find(c.Request.Context(), filter); err != nil {
+			resp.Error = err.Error()
+			resp.Data.Grants = rbac.Grants{}
+			c.JSON(http.StatusInternalServerError, resp)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// status returns the HTTP status code of err.
+func status(err error) int {
+	switch {
+	case errors.Is(err, rbac.ErrInvalidRoleName), errors.Is(err, rbac.ErrUnknownPermission), err == rbac.ErrInvalidExpiry:
+		return http.StatusBadRequest
+	case err == rbac.ErrBuiltInRole:
+		return http.StatusForbidden
+	case err == rbac.ErrRoleNotFound:
+		return http.StatusNotFound
+	case err == rbac.ErrRoleExists:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}